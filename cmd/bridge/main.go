@@ -14,14 +14,20 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/openshift/console/pkg/auth"
 	"github.com/openshift/console/pkg/bridge"
 	"github.com/openshift/console/pkg/knative"
+	"github.com/openshift/console/pkg/kubeconfig"
+	"github.com/openshift/console/pkg/plugins"
+	"github.com/openshift/console/pkg/podexec"
 	"github.com/openshift/console/pkg/proxy"
+	"github.com/openshift/console/pkg/recording"
 	"github.com/openshift/console/pkg/server"
 	"github.com/openshift/console/pkg/serverconfig"
 	"github.com/openshift/console/pkg/serverutils"
+	"github.com/openshift/console/pkg/terminal"
 	oscrypto "github.com/openshift/library-go/pkg/crypto"
 
 	"k8s.io/klog"
@@ -81,19 +87,34 @@ func main() {
 	fUserAuthOIDCClientID := fs.String("user-auth-oidc-client-id", "", "The OIDC OAuth2 Client ID.")
 	fUserAuthOIDCClientSecret := fs.String("user-auth-oidc-client-secret", "", "The OIDC OAuth2 Client Secret.")
 	fUserAuthOIDCClientSecretFile := fs.String("user-auth-oidc-client-secret-file", "", "File containing the OIDC OAuth2 Client Secret.")
+	fUserAuthOIDCUsernameClaim := fs.String("user-auth-oidc-username-claim", auth.DefaultClaimMapping.UsernameClaim, "The OIDC claim to use as the username.")
+	fUserAuthOIDCUsernamePrefix := fs.String("user-auth-oidc-username-prefix", "", "Prefix prepended to usernames, as with the kube-apiserver --oidc-username-prefix flag.")
+	fUserAuthOIDCGroupsClaim := fs.String("user-auth-oidc-groups-claim", auth.DefaultClaimMapping.GroupsClaim, "The OIDC claim holding the user's groups.")
+	fUserAuthOIDCGroupsPrefix := fs.String("user-auth-oidc-groups-prefix", "", "Prefix prepended to groups, as with the kube-apiserver --oidc-groups-prefix flag.")
+	fUserAuthOIDCDisplayNameClaim := fs.String("user-auth-oidc-display-name-claim", auth.DefaultClaimMapping.DisplayNameClaim, "The OIDC claim to use as the user's display name.")
+	fUserAuthOIDCAllowedGroups := fs.String("user-auth-oidc-allowed-groups", "", "Comma-separated list of groups, including the groups prefix, allowed to log in. All users are allowed if empty.")
+	fUserAuthOIDCLogoutConfigMap := fs.String("user-auth-oidc-logout-configmap", "", "namespace/name of the ConfigMap through which console replicas share OIDC back-channel logouts. Logouts are kept in memory if empty, which is only enough for a single replica.")
+	fUserAuthTokenRequestClientID := fs.String("user-auth-token-request-client-id", "", "The OAuth2 client_id issuing tokens for command line tools. When set, the console runs its own token request flow instead of linking to the OpenShift OAuth server's token request page.")
+	fUserAuthTokenRequestClientSecretFile := fs.String("user-auth-token-request-client-secret-file", "", "File containing the OAuth2 client_secret issuing tokens for command line tools.")
 	fUserAuthLogoutRedirect := fs.String("user-auth-logout-redirect", "", "Optional redirect URL on logout needed for some single sign-on identity providers.")
 
 	fInactivityTimeout := fs.Int("inactivity-timeout", 0, "Number of seconds, after which user will be logged out if inactive. Ignored if less than 300 seconds (5 minutes).")
+	fCookieAuthenticationKeyFile := fs.String("cookie-authentication-key-file", "", "File containing the key signing the activity cookies of the inactivity timeout. It must be the same on all console replicas. A random key is used if empty, which only works for a single replica.")
+	fTrustForwardedFor := fs.Bool("trust-forwarded-for", false, "Record the last X-Forwarded-For address as the client address of sessions. Only enable this if a router in front of the console appends the header, otherwise clients can choose the address.")
 
-	fK8sMode := fs.String("k8s-mode", "in-cluster", "in-cluster | off-cluster")
+	fK8sMode := fs.String("k8s-mode", "in-cluster", "in-cluster | off-cluster | kubeconfig")
 	fK8sModeOffClusterEndpoint := fs.String("k8s-mode-off-cluster-endpoint", "", "URL of the Kubernetes API server.")
 	fK8sModeOffClusterSkipVerifyTLS := fs.Bool("k8s-mode-off-cluster-skip-verify-tls", false, "DEV ONLY. When true, skip verification of certs presented by k8s API server.")
 	fK8sModeOffClusterThanos := fs.String("k8s-mode-off-cluster-thanos", "", "DEV ONLY. URL of the cluster's Thanos server.")
 	fK8sModeOffClusterAlertmanager := fs.String("k8s-mode-off-cluster-alertmanager", "", "DEV ONLY. URL of the cluster's AlertManager server.")
 	fK8sModeOffClusterMetering := fs.String("k8s-mode-off-cluster-metering", "", "DEV ONLY. URL of the cluster's metering server.")
+	fK8sModeKubeconfig := fs.String("k8s-mode-kubeconfig", "", "DEV ONLY. Path to the kubeconfig file. Defaults to $KUBECONFIG or ~/.kube/config.")
+	fK8sModeKubeconfigContext := fs.String("k8s-mode-kubeconfig-context", "", "DEV ONLY. Kubeconfig context of the local cluster. Defaults to the current context.")
+	fK8sModeKubeconfigManagedClusters := fs.Bool("k8s-mode-kubeconfig-managed-clusters", false, "DEV ONLY. When true, add the other kubeconfig contexts as managed clusters. Requires --user-auth=disabled.")
 
 	fK8sAuth := fs.String("k8s-auth", "service-account", "service-account | bearer-token | oidc | openshift")
 	fK8sAuthBearerToken := fs.String("k8s-auth-bearer-token", "", "Authorization token to send with proxied Kubernetes API requests.")
+	fK8sAuthBearerTokenFile := fs.String("k8s-auth-bearer-token-file", "", "Path to a file holding the authorization token to send with proxied Kubernetes API requests. The file is re-read periodically, so the token can be rotated.")
 
 	fK8sModeOffClusterGitOps := fs.String("k8s-mode-off-cluster-gitops", "", "DEV ONLY. URL of the GitOps backend service")
 
@@ -123,6 +144,9 @@ func main() {
 	consolePluginsFlags := serverconfig.MultiKeyValue{}
 	fs.Var(&consolePluginsFlags, "plugins", "List of plugin entries that are enabled for the console. Each entry consist of plugin-name as a key and plugin-endpoint as a value.")
 	fPluginProxy := fs.String("plugin-proxy", "", "Defines various service types to which will console proxy plugins requests. (JSON as string)")
+	fPluginAssetCacheMaxSize := fs.Int64("plugin-asset-cache-max-size", 64<<20, "Size in bytes of the in-memory cache of plugin assets. Zero disables the cache.")
+	fPluginAssetCacheMaxEntrySize := fs.Int64("plugin-asset-cache-max-entry-size", 8<<20, "Size in bytes of the largest plugin asset that is cached.")
+	fPluginIntegrity := fs.String("plugin-integrity", "", "Digests and manifest signing keys the assets of plugins are verified with, by plugin name. (JSON as string)")
 
 	fLoadTestFactor := fs.Int("load-test-factor", 0, "DEV ONLY. The factor used to multiply k8s API list responses for load testing purposes.")
 
@@ -134,6 +158,25 @@ func main() {
 	fManagedClusterConfigs := fs.String("managed-clusters", "", "List of managed cluster configurations. (JSON as string)")
 	fControlPlaneTopology := fs.String("control-plane-topology-mode", "", "Defines the topology mode of the control/infra nodes (External | HighlyAvailable | SingleReplica)")
 
+	fTerminalAdminNamespace := fs.String("terminal-admin-namespace", "openshift-terminal", "Namespace cluster admins' web terminals must run in.")
+	fTerminalIdleTimeout := fs.Duration("terminal-idle-timeout", 0, "Cull web terminals that have had no activity for this long. The console service account needs to list, patch and delete devworkspaces in all namespaces. Zero disables culling.")
+	fTerminalIdleAction := fs.String("terminal-idle-action", terminal.IdleActionStop, "How idle web terminals are culled. (stop | delete)")
+
+	fTerminalRecordingSink := fs.String("terminal-recording-sink", "", "Record pod exec and web terminal sessions in the asciicast v2 format and store them in this sink. (dir | s3)")
+	fTerminalRecordingDir := fs.String("terminal-recording-dir", "", "Directory the dir sink stores terminal recordings in.")
+	fTerminalRecordingS3Endpoint := fs.String("terminal-recording-s3-endpoint", "", "URL of the S3 compatible object store the s3 sink stores terminal recordings in.")
+	fTerminalRecordingS3Bucket := fs.String("terminal-recording-s3-bucket", "", "Bucket the s3 sink stores terminal recordings in.")
+	fTerminalRecordingS3Prefix := fs.String("terminal-recording-s3-prefix", "", "Prefix of the keys of terminal recordings in the bucket.")
+	fTerminalRecordingS3Region := fs.String("terminal-recording-s3-region", "us-east-1", "Region of the bucket.")
+	fTerminalRecordingS3AccessKeyIDFile := fs.String("terminal-recording-s3-access-key-id-file", "", "File containing the access key ID of the s3 sink.")
+	fTerminalRecordingS3SecretAccessKeyFile := fs.String("terminal-recording-s3-secret-access-key-file", "", "File containing the secret access key of the s3 sink.")
+	fTerminalRecordingRetention := fs.Duration("terminal-recording-retention", 0, "How long terminal recordings are kept. Zero keeps them forever.")
+	fTerminalRecordingMaxCount := fs.Int("terminal-recording-max-count", 0, "How many terminal recordings are kept. The oldest are deleted first. Zero keeps all of them.")
+	fTerminalRecordingMaxSize := fs.Int64("terminal-recording-max-size", 100<<20, "Size in bytes after which a terminal recording is truncated, which bounds the temporary file of each recorded session. Zero doesn't limit it.")
+
+	fPodExecDeniedNamespaces := fs.String("pod-exec-denied-namespaces", "", "Comma separated glob patterns of namespaces, like openshift-*, that exec and attach sessions opened with the pod exec endpoint are denied in.")
+	fPodExecRequireReason := fs.Bool("pod-exec-require-reason", false, "Require a reason for exec and attach sessions opened with the pod exec endpoint.")
+
 	if err := serverconfig.Parse(fs, os.Args[1:], "BRIDGE"); err != nil {
 		fmt.Fprintln(os.Stderr, err.Error())
 		os.Exit(1)
@@ -209,9 +252,11 @@ func main() {
 		}
 	}
 
+	var inactivityTimeout time.Duration
 	if *fInactivityTimeout < 300 {
 		klog.Warning("Flag inactivity-timeout is set to less then 300 seconds and will be ignored!")
 	} else {
+		inactivityTimeout = time.Duration(*fInactivityTimeout) * time.Second
 		if *fK8sAuth != "oidc" && *fK8sAuth != "openshift" {
 			fmt.Fprintln(os.Stderr, "In order activate the user inactivity timout, flag --user-auth must be one of: oidc, openshift")
 			os.Exit(1)
@@ -219,6 +264,18 @@ func main() {
 		klog.Infof("Setting user inactivity timout to %d seconds", *fInactivityTimeout)
 	}
 
+	var cookieAuthenticationKey []byte
+	if *fCookieAuthenticationKeyFile != "" {
+		key, err := ioutil.ReadFile(*fCookieAuthenticationKeyFile)
+		if err != nil {
+			bridge.FlagFatalf("cookie-authentication-key-file", "%v", err)
+		}
+		if len(key) < 32 {
+			bridge.FlagFatalf("cookie-authentication-key-file", "must contain a key of at least 32 bytes")
+		}
+		cookieAuthenticationKey = key
+	}
+
 	consolePluginsMap := consolePluginsFlags.ToMap()
 	if len(consolePluginsMap) > 0 {
 		klog.Infoln("The following console plugins are enabled:")
@@ -252,6 +309,7 @@ func main() {
 		ProjectAccessClusterRoles: *fProjectAccessClusterRoles,
 		K8sProxyConfigs:           make(map[string]*proxy.Config),
 		K8sClients:                make(map[string]*http.Client),
+		KubeconfigClusters:        make(map[string]server.KubeconfigCluster),
 	}
 
 	managedClusterConfigs := []serverconfig.ManagedClusterConfig{}
@@ -306,6 +364,11 @@ func main() {
 					TLSClientConfig: managedClusterTLSConfig,
 				},
 			}
+
+			srv.KubeconfigClusters[managedCluster.Name] = server.KubeconfigCluster{
+				Server: managedCluster.APIServer.URL,
+				CAData: managedClusterCertPEM,
+			}
 		}
 	}
 
@@ -335,7 +398,8 @@ func main() {
 	)
 
 	var (
-		k8sAuthServiceAccountBearerToken string
+		// Bound service account tokens expire and are rotated on disk by the kubelet.
+		k8sAuthServiceAccountTokenSource = auth.NewStaticTokenSource("")
 	)
 
 	var secureCookies bool
@@ -365,7 +429,7 @@ func main() {
 			RootCAs: rootCAs,
 		})
 
-		bearerToken, err := ioutil.ReadFile(k8sInClusterBearerToken)
+		k8sAuthServiceAccountTokenSource, err = auth.NewFileTokenSource(k8sInClusterBearerToken)
 		if err != nil {
 			klog.Fatalf("failed to read bearer token: %v", err)
 		}
@@ -376,8 +440,6 @@ func main() {
 			Endpoint:        k8sEndpoint,
 		}
 
-		k8sAuthServiceAccountBearerToken = string(bearerToken)
-
 		// If running in an OpenShift cluster, set up a proxy to the prometheus-k8s service running in the openshift-monitoring namespace.
 		if *fServiceCAFile != "" {
 			serviceCertPEM, err := ioutil.ReadFile(*fServiceCAFile)
@@ -499,8 +561,63 @@ func main() {
 			}
 		}
 
+	case "kubeconfig":
+		if *fK8sModeKubeconfigManagedClusters {
+			// Users log in to managed clusters with their OAuth configuration,
+			// which a kubeconfig doesn't have.
+			bridge.ValidateFlagIs("user-auth", *fUserAuth, "disabled")
+		}
+		cluster, managedClusters, err := kubeconfig.Load(*fK8sModeKubeconfig, *fK8sModeKubeconfigContext, *fK8sModeKubeconfigManagedClusters)
+		if err != nil {
+			klog.Fatalf("Error loading kubeconfig: %v", err)
+		}
+		klog.Infof("Using kubeconfig context %s for the local cluster", cluster.Name)
+		if cluster.ClientCertificate {
+			// The API server authenticates the client certificate before the
+			// bearer token of a user, so every user would act as the kubeconfig user.
+			bridge.ValidateFlagIs("user-auth", *fUserAuth, "disabled")
+		}
+
+		k8sEndpoint = cluster.Endpoint
+		k8sCertPEM = cluster.CAData
+		k8sAuthServiceAccountTokenSource = cluster.TokenSource
+		srv.K8sProxyConfigs[serverutils.LocalClusterName] = &proxy.Config{
+			TLSClientConfig: cluster.TLSConfig,
+			HeaderBlacklist: []string{"Cookie", "X-CSRFToken"},
+			Endpoint:        k8sEndpoint,
+		}
+
+		serviceProxyTLSConfig := oscrypto.SecureTLSConfig(&tls.Config{})
+		srv.TerminalProxyTLSConfig = serviceProxyTLSConfig
+		srv.PluginsProxyTLSConfig = serviceProxyTLSConfig
+
+		srv.ManagedClusterTokenSources = make(map[string]auth.TokenSource)
+		for _, managedCluster := range managedClusters {
+			if _, ok := srv.K8sProxyConfigs[managedCluster.Name]; ok {
+				klog.Errorf("Error configuring managed cluster %s from kubeconfig. A cluster with that name already exists", managedCluster.Name)
+				continue
+			}
+			klog.Infof("Configuring managed cluster %s from kubeconfig", managedCluster.Name)
+			srv.K8sProxyConfigs[managedCluster.Name] = &proxy.Config{
+				TLSClientConfig: managedCluster.TLSConfig,
+				HeaderBlacklist: []string{"Cookie", "X-CSRFToken"},
+				Endpoint:        managedCluster.Endpoint,
+			}
+			srv.K8sClients[managedCluster.Name] = &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: managedCluster.TLSConfig,
+				},
+			}
+			srv.ManagedClusterTokenSources[managedCluster.Name] = managedCluster.TokenSource
+			srv.KubeconfigClusters[managedCluster.Name] = server.KubeconfigCluster{
+				Server:                managedCluster.Endpoint.String(),
+				CAData:                managedCluster.CAData,
+				InsecureSkipTLSVerify: managedCluster.TLSConfig.InsecureSkipVerify,
+			}
+		}
+
 	default:
-		bridge.FlagFatalf("k8s-mode", "must be one of: in-cluster, off-cluster")
+		bridge.FlagFatalf("k8s-mode", "must be one of: in-cluster, off-cluster, kubeconfig")
 	}
 
 	apiServerEndpoint := *fK8sPublicEndpoint
@@ -508,6 +625,12 @@ func main() {
 		apiServerEndpoint = srv.K8sProxyConfigs[serverutils.LocalClusterName].Endpoint.String()
 	}
 	srv.KubeAPIServerURL = apiServerEndpoint
+	srv.KubeconfigClusters[serverutils.LocalClusterName] = server.KubeconfigCluster{
+		Server: apiServerEndpoint,
+		CAData: k8sCertPEM,
+		// Only skip verification where bridge itself doesn't verify the endpoint.
+		InsecureSkipTLSVerify: *fK8sPublicEndpoint == "" && srv.K8sProxyConfigs[serverutils.LocalClusterName].TLSClientConfig.InsecureSkipVerify,
+	}
 	srv.K8sClients[serverutils.LocalClusterName] = &http.Client{
 		Transport: &http.Transport{
 			TLSClientConfig: srv.K8sProxyConfigs[serverutils.LocalClusterName].TLSClientConfig,
@@ -545,7 +668,7 @@ func main() {
 			authLoginErrorEndpoint   = proxy.SingleJoiningSlash(srv.BaseURL.String(), server.AuthLoginErrorEndpoint)
 			authLoginSuccessEndpoint = proxy.SingleJoiningSlash(srv.BaseURL.String(), server.AuthLoginSuccessEndpoint)
 			oidcClientSecret         = *fUserAuthOIDCClientSecret
-			// Abstraction leak required by NewAuthenticator. We only want the browser to send the auth token for paths starting with basePath/api.
+			// Abstraction leak required by StartAuthenticator. We only want the browser to send the auth token for paths starting with basePath/api.
 			cookiePath  = proxy.SingleJoiningSlash(srv.BaseURL.Path, "/api/")
 			refererPath = srv.BaseURL.String()
 		)
@@ -576,6 +699,44 @@ func main() {
 			oidcClientSecret = string(buf)
 		}
 
+		var tokenRequestClientSecret string
+		if *fUserAuthTokenRequestClientSecretFile != "" {
+			bridge.ValidateFlagNotEmpty("user-auth-token-request-client-id", *fUserAuthTokenRequestClientID)
+			buf, err := ioutil.ReadFile(*fUserAuthTokenRequestClientSecretFile)
+			if err != nil {
+				klog.Fatalf("Failed to read token request client secret file: %v", err)
+			}
+			tokenRequestClientSecret = strings.TrimSpace(string(buf))
+		}
+
+		var allowedGroups []string
+		for _, group := range strings.Split(*fUserAuthOIDCAllowedGroups, ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				allowedGroups = append(allowedGroups, group)
+			}
+		}
+		if len(allowedGroups) > 0 && authSource == auth.AuthSourceOpenShift {
+			bridge.FlagFatalf("user-auth-oidc-allowed-groups", "cannot be used with --user-auth=\"openshift\"")
+		}
+
+		var logoutStore auth.LogoutStore
+		if *fUserAuthOIDCLogoutConfigMap != "" {
+			if authSource == auth.AuthSourceOpenShift {
+				bridge.FlagFatalf("user-auth-oidc-logout-configmap", "cannot be used with --user-auth=\"openshift\"")
+			}
+			parts := strings.Split(*fUserAuthOIDCLogoutConfigMap, "/")
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				bridge.FlagFatalf("user-auth-oidc-logout-configmap", "must be of the form namespace/name")
+			}
+			logoutStore = auth.NewConfigMapLogoutStore(
+				srv.K8sClients[serverutils.LocalClusterName],
+				srv.K8sProxyConfigs[serverutils.LocalClusterName].Endpoint,
+				k8sAuthServiceAccountTokenSource,
+				parts[0],
+				parts[1],
+			)
+		}
+
 		// Config for logging into console.
 		oidcClientConfig := &auth.Config{
 			AuthSource:   authSource,
@@ -597,6 +758,32 @@ func main() {
 			RefererPath:   refererPath,
 			SecureCookies: secureCookies,
 			ClusterName:   serverutils.LocalClusterName,
+
+			InactivityTimeout:       inactivityTimeout,
+			CookieAuthenticationKey: cookieAuthenticationKey,
+			TrustForwardedFor:       *fTrustForwardedFor,
+
+			ClaimMapping: auth.ClaimMapping{
+				UsernameClaim:    *fUserAuthOIDCUsernameClaim,
+				UsernamePrefix:   *fUserAuthOIDCUsernamePrefix,
+				GroupsClaim:      *fUserAuthOIDCGroupsClaim,
+				GroupsPrefix:     *fUserAuthOIDCGroupsPrefix,
+				DisplayNameClaim: *fUserAuthOIDCDisplayNameClaim,
+			},
+			AllowedGroups: allowedGroups,
+
+			// Validate bearer tokens of automation with the console service account.
+			TokenReviewer: auth.NewTokenReviewer(
+				srv.K8sClients[serverutils.LocalClusterName],
+				srv.K8sProxyConfigs[serverutils.LocalClusterName].Endpoint,
+				k8sAuthServiceAccountTokenSource,
+			),
+
+			TokenRequestClientID:     *fUserAuthTokenRequestClientID,
+			TokenRequestClientSecret: tokenRequestClientSecret,
+			TokenRequestRedirectURL:  proxy.SingleJoiningSlash(srv.BaseURL.String(), server.AuthTokenRequestCallbackEndpoint),
+
+			LogoutStore: logoutStore,
 		}
 
 		// NOTE: This won't work when using the OpenShift auth mode.
@@ -614,8 +801,10 @@ func main() {
 
 		}
 
+		// Authenticators contact their identity provider in the background, so an
+		// unreachable provider only makes login to its own cluster unavailable.
 		srv.Authers = make(map[string]*auth.Authenticator)
-		if srv.Authers[serverutils.LocalClusterName], err = auth.NewAuthenticator(context.Background(), oidcClientConfig); err != nil {
+		if srv.Authers[serverutils.LocalClusterName], err = auth.StartAuthenticator(context.Background(), oidcClientConfig); err != nil {
 			klog.Fatalf("Error initializing authenticator: %v", err)
 		}
 
@@ -641,9 +830,32 @@ func main() {
 					RefererPath:   refererPath,
 					SecureCookies: secureCookies,
 					ClusterName:   managedCluster.Name,
+
+					InactivityTimeout:       inactivityTimeout,
+					CookieAuthenticationKey: cookieAuthenticationKey,
+					TrustForwardedFor:       *fTrustForwardedFor,
+
+					ClaimMapping:  oidcClientConfig.ClaimMapping,
+					AllowedGroups: allowedGroups,
+
+					TokenRequestClientID:     managedCluster.OAuth.TokenRequestClientID,
+					TokenRequestClientSecret: managedCluster.OAuth.TokenRequestClientSecret,
+					TokenRequestRedirectURL:  proxy.SingleJoiningSlash(srv.BaseURL.String(), fmt.Sprintf("%s/%s", server.AuthTokenRequestCallbackEndpoint, managedCluster.Name)),
+
+					LogoutStore: logoutStore,
+				}
+
+				// Bridge has no service account on managed clusters, so the bearer
+				// tokens there must be allowed to create token reviews themselves.
+				if managedClusterProxyConfig, ok := srv.K8sProxyConfigs[managedCluster.Name]; ok {
+					managedClusterOIDCClientConfig.TokenReviewer = auth.NewTokenReviewer(
+						srv.K8sClients[managedCluster.Name],
+						managedClusterProxyConfig.Endpoint,
+						nil,
+					)
 				}
 
-				if srv.Authers[managedCluster.Name], err = auth.NewAuthenticator(context.Background(), managedClusterOIDCClientConfig); err != nil {
+				if srv.Authers[managedCluster.Name], err = auth.StartAuthenticator(context.Background(), managedClusterOIDCClientConfig); err != nil {
 					klog.Fatalf("Error initializing managed cluster authenticator: %v", err)
 				}
 			}
@@ -656,26 +868,32 @@ func main() {
 
 	switch *fK8sAuth {
 	case "service-account":
-		bridge.ValidateFlagIs("k8s-mode", *fK8sMode, "in-cluster")
-		srv.StaticUser = &auth.User{
-			Token: k8sAuthServiceAccountBearerToken,
-		}
-		srv.ServiceAccountToken = k8sAuthServiceAccountBearerToken
+		// In kubeconfig mode, the user of the kubeconfig context acts as the service account.
+		bridge.ValidateFlagIs("k8s-mode", *fK8sMode, "in-cluster", "kubeconfig")
+		srv.ServiceAccountTokenSource = k8sAuthServiceAccountTokenSource
 	case "bearer-token":
-		bridge.ValidateFlagNotEmpty("k8s-auth-bearer-token", *fK8sAuthBearerToken)
-		srv.StaticUser = &auth.User{
-			Token: *fK8sAuthBearerToken,
+		switch {
+		case *fK8sAuthBearerToken != "" && *fK8sAuthBearerTokenFile != "":
+			bridge.FlagFatalf("k8s-auth-bearer-token-file", "cannot be used with --k8s-auth-bearer-token")
+		case *fK8sAuthBearerTokenFile != "":
+			tokenSource, err := auth.NewFileTokenSource(*fK8sAuthBearerTokenFile)
+			if err != nil {
+				bridge.FlagFatalf("k8s-auth-bearer-token-file", "%v", err)
+			}
+			srv.ServiceAccountTokenSource = tokenSource
+		default:
+			bridge.ValidateFlagNotEmpty("k8s-auth-bearer-token", *fK8sAuthBearerToken)
+			srv.ServiceAccountTokenSource = auth.NewStaticTokenSource(*fK8sAuthBearerToken)
 		}
-		srv.ServiceAccountToken = *fK8sAuthBearerToken
 	case "oidc", "openshift":
 		bridge.ValidateFlagIs("user-auth", *fUserAuth, "oidc", "openshift")
-		srv.ServiceAccountToken = k8sAuthServiceAccountBearerToken
+		srv.ServiceAccountTokenSource = k8sAuthServiceAccountTokenSource
 	default:
 		bridge.FlagFatalf("k8s-mode", "must be one of: service-account, bearer-token, oidc, openshift")
 	}
 
 	srv.MonitoringDashboardConfigMapLister = server.NewResourceLister(
-		srv.ServiceAccountToken,
+		srv.ServiceAccountTokenSource,
 		&url.URL{
 			Scheme: k8sEndpoint.Scheme,
 			Host:   k8sEndpoint.Host,
@@ -693,7 +911,7 @@ func main() {
 	)
 
 	srv.KnativeEventSourceCRDLister = server.NewResourceLister(
-		srv.ServiceAccountToken,
+		srv.ServiceAccountTokenSource,
 		&url.URL{
 			Scheme: k8sEndpoint.Scheme,
 			Host:   k8sEndpoint.Host,
@@ -711,7 +929,7 @@ func main() {
 	)
 
 	srv.KnativeChannelCRDLister = server.NewResourceLister(
-		srv.ServiceAccountToken,
+		srv.ServiceAccountTokenSource,
 		&url.URL{
 			Scheme: k8sEndpoint.Scheme,
 			Host:   k8sEndpoint.Host,
@@ -728,6 +946,107 @@ func main() {
 		knative.ChannelFilter,
 	)
 
+	bridge.ValidateFlagNotEmpty("terminal-admin-namespace", *fTerminalAdminNamespace)
+	srv.TerminalAdminNamespace = *fTerminalAdminNamespace
+	if *fTerminalIdleTimeout > 0 {
+		reaper, err := terminal.NewReaper(
+			srv.K8sProxyConfigs[serverutils.LocalClusterName],
+			srv.K8sClients[serverutils.LocalClusterName],
+			srv.ServiceAccountTokenSource,
+			*fTerminalIdleTimeout,
+			*fTerminalIdleAction,
+		)
+		if err != nil {
+			bridge.FlagFatalf("terminal-idle-action", "%v", err)
+		}
+		go reaper.Run(context.Background())
+	}
+
+	srv.PluginManifestChecker = plugins.NewManifestChecker(
+		&http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: srv.PluginsProxyTLSConfig},
+		},
+		srv.EnabledConsolePlugins,
+	)
+	go srv.PluginManifestChecker.Run(context.Background())
+	if *fPluginAssetCacheMaxSize > 0 {
+		srv.PluginAssetCache = plugins.NewAssetCache(*fPluginAssetCacheMaxSize, *fPluginAssetCacheMaxEntrySize)
+	}
+	if *fPluginIntegrity != "" {
+		pluginIntegrity, err := plugins.ParsePluginIntegrityConfig(*fPluginIntegrity)
+		if err != nil {
+			bridge.FlagFatalf("plugin-integrity", "%v", err)
+		}
+		srv.PluginIntegrityVerifier, err = plugins.NewIntegrityVerifier(
+			&http.Client{
+				Timeout:   10 * time.Second,
+				Transport: &http.Transport{TLSClientConfig: srv.PluginsProxyTLSConfig},
+			},
+			srv.EnabledConsolePlugins,
+			pluginIntegrity,
+		)
+		if err != nil {
+			bridge.FlagFatalf("plugin-integrity", "%v", err)
+		}
+	}
+
+	var terminalRecordingSink recording.Sink
+	switch *fTerminalRecordingSink {
+	case "":
+	case "dir":
+		bridge.ValidateFlagNotEmpty("terminal-recording-dir", *fTerminalRecordingDir)
+		sink, err := recording.NewDirSink(*fTerminalRecordingDir)
+		if err != nil {
+			klog.Fatalf("Failed to create terminal recording dir: %v", err)
+		}
+		terminalRecordingSink = sink
+	case "s3":
+		s3Endpoint := bridge.ValidateFlagIsURL("terminal-recording-s3-endpoint", *fTerminalRecordingS3Endpoint)
+		bridge.ValidateFlagNotEmpty("terminal-recording-s3-bucket", *fTerminalRecordingS3Bucket)
+		bridge.ValidateFlagNotEmpty("terminal-recording-s3-access-key-id-file", *fTerminalRecordingS3AccessKeyIDFile)
+		bridge.ValidateFlagNotEmpty("terminal-recording-s3-secret-access-key-file", *fTerminalRecordingS3SecretAccessKeyFile)
+		accessKeyID, err := ioutil.ReadFile(*fTerminalRecordingS3AccessKeyIDFile)
+		if err != nil {
+			klog.Fatalf("Failed to read terminal recording access key ID file: %v", err)
+		}
+		secretAccessKey, err := ioutil.ReadFile(*fTerminalRecordingS3SecretAccessKeyFile)
+		if err != nil {
+			klog.Fatalf("Failed to read terminal recording secret access key file: %v", err)
+		}
+		terminalRecordingSink = recording.NewS3Sink(
+			&http.Client{
+				Transport: &http.Transport{
+					Proxy:           http.ProxyFromEnvironment,
+					TLSClientConfig: oscrypto.SecureTLSConfig(&tls.Config{}),
+				},
+			},
+			s3Endpoint,
+			*fTerminalRecordingS3Bucket,
+			*fTerminalRecordingS3Prefix,
+			*fTerminalRecordingS3Region,
+			strings.TrimSpace(string(accessKeyID)),
+			strings.TrimSpace(string(secretAccessKey)),
+		)
+	default:
+		bridge.FlagFatalf("terminal-recording-sink", "must be one of: dir, s3")
+	}
+	if terminalRecordingSink != nil {
+		srv.TerminalRecorder = recording.NewRecorder(terminalRecordingSink, recording.Retention{
+			MaxAge:   *fTerminalRecordingRetention,
+			MaxCount: *fTerminalRecordingMaxCount,
+		}, *fTerminalRecordingMaxSize)
+	}
+
+	podExecDeniedNamespaces, err := podexec.ParseNamespacePatterns(*fPodExecDeniedNamespaces)
+	if err != nil {
+		bridge.FlagFatalf("pod-exec-denied-namespaces", "%v", err)
+	}
+	srv.PodExecPolicy = podexec.Policy{
+		DeniedNamespaces: podExecDeniedNamespaces,
+		RequireReason:    *fPodExecRequireReason,
+	}
+
 	listenURL := bridge.ValidateFlagIsURL("listen", *fListen)
 	switch listenURL.Scheme {
 	case "http":
@@ -3,11 +3,11 @@ import { Button, EmptyState, EmptyStateBody } from '@patternfly/react-core';
 import { Base64 } from 'js-base64';
 import { useTranslation } from 'react-i18next';
 import { connect, Dispatch } from 'react-redux';
-import { impersonateStateToProps } from '@console/dynamic-plugin-sdk';
-import { PodModel } from '@console/internal/models';
-import { resourceURL, K8sKind } from '@console/internal/module/k8s';
+import { getActiveCluster, impersonateStateToProps } from '@console/dynamic-plugin-sdk';
+import { K8sKind } from '@console/internal/module/k8s';
 import { WSFactory } from '@console/internal/module/ws-factory';
 import { connectToFlags, WithFlagsProps } from '@console/internal/reducers/connectToFlags';
+import store from '@console/internal/redux';
 import { FLAGS } from '@console/shared';
 import { setCloudShellActive } from '../../redux/actions/cloud-shell-actions';
 import {
@@ -120,21 +120,17 @@ const CloudShellExec: React.FC<CloudShellExecProps> = ({
     const cmd = shcommand || ['sh', '-i', '-c', 'TERM=xterm sh'];
     const subprotocols = (impersonate?.subprotocols || []).concat('base64.channel.k8s.io');
 
-    const urlOpts = {
-      ns: namespace,
-      name: podname,
-      path: 'exec',
-      queryParams: {
-        stdout: '1',
-        stdin: '1',
-        stderr: '1',
-        tty: '1',
-        container,
-        command: cmd.map((c) => encodeURIComponent(c)).join('&command='),
-      },
-    };
-
-    const path = resourceURL(PodModel, urlOpts);
+    // Like other exec sessions, the terminal goes through the console's pod
+    // exec endpoint, which enforces the exec policy.
+    const query = new URLSearchParams({ container, tty: 'true' });
+    cmd.forEach((c) => query.append('command', c));
+    const cluster = getActiveCluster(store.getState());
+    if (cluster) {
+      query.set('cluster', cluster);
+    }
+    const path = `${window.SERVER_FLAGS.basePath}api/pod-exec/${encodeURIComponent(
+      namespace,
+    )}/${encodeURIComponent(podname)}/exec?${query.toString()}`;
     const wsOpts = {
       host: 'auto',
       reconnect: true,
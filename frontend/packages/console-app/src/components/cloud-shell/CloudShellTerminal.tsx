@@ -13,7 +13,12 @@ import {
 } from '@console/shared';
 import { FLAG_V1ALPHA2DEVWORKSPACE } from '../../consts';
 import { v1alpha1WorkspaceModel, WorkspaceModel } from '../../models';
-import { TerminalInitData, initTerminal, startWorkspace } from './cloud-shell-utils';
+import {
+  CLOUD_SHELL_PROTECTED_NAMESPACE,
+  TerminalInitData,
+  initTerminal,
+  startWorkspace,
+} from './cloud-shell-utils';
 import CloudshellExec from './CloudShellExec';
 import { CLOUD_SHELL_NAMESPACE, CLOUD_SHELL_NAMESPACE_CONFIG_STORAGE_KEY } from './const';
 import CloudShellAdminSetup from './setup/CloudShellAdminSetup';
@@ -47,7 +52,7 @@ const CloudShellTerminal: React.FC<CloudShellTerminalProps &
   const [initData, setInitData] = React.useState<TerminalInitData>();
   const [initError, setInitError] = React.useState<string>();
   const [isAdmin, isAdminCheckLoading] = useAccessReview2({
-    namespace: 'openshift-terminal',
+    namespace: CLOUD_SHELL_PROTECTED_NAMESPACE,
     verb: 'create',
     resource: 'pods',
   });
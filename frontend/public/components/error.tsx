@@ -33,6 +33,12 @@ const getMessage = (type: string, id: string): string => {
       invalid_state: i18next.t(
         'public~There was an error verifying your session. Please log out and try again.',
       ),
+      access_denied: i18next.t(
+        'public~You are not a member of a group that is allowed to use the console. Contact your administrator for access.',
+      ),
+      auth_unavailable: i18next.t(
+        'public~Login is unavailable because the identity provider of this cluster cannot be reached. Please try again later.',
+      ),
       logout_error: i18next.t('public~There was an error logging you out. Please try again.'),
       /* eslint-enable camelcase */
       default: i18next.t(
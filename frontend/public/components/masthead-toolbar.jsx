@@ -139,6 +139,7 @@ class MastheadToolbarContents_ extends React.Component {
 
   _resetInactivityTimeout() {
     const { flags, user } = this.props;
+    authSvc.reportActivity();
     clearTimeout(this.userInactivityTimeout);
     this.userInactivityTimeout = setTimeout(() => {
       if (isMultiClusterEnabled()) {
@@ -12,8 +12,6 @@ import { connectToFlags } from '../reducers/connectToFlags';
 import { FLAGS } from '@console/shared';
 import { Terminal } from './terminal';
 import { WSFactory } from '../module/ws-factory';
-import { resourceURL } from '../module/k8s';
-import { PodModel } from '../models';
 import { isWindowsPod } from '../module/k8s/pods';
 
 const nameWithIcon = (name) => (
@@ -57,20 +55,7 @@ const PodExec_ = connectToFlags(FLAGS.OPENSHIFT)(
       const { activeContainer } = this.state;
       const usedClient = this.props.flags[FLAGS.OPENSHIFT] ? 'oc' : 'kubectl';
       const command = isWindowsPod(this.props.obj) ? ['cmd'] : ['sh', '-i', '-c', 'TERM=xterm sh'];
-      const params = {
-        ns: namespace,
-        name,
-        path: 'exec',
-        queryParams: {
-          stdout: 1,
-          stdin: 1,
-          stderr: 1,
-          tty: 1,
-          container: activeContainer,
-          command: command.map((c) => encodeURIComponent(c)).join('&command='),
-          cluster: getActiveCluster(store.getState()),
-        },
-      };
+      const cluster = getActiveCluster(store.getState());
 
       if (this.ws) {
         this.ws.destroy();
@@ -81,11 +66,22 @@ const PodExec_ = connectToFlags(FLAGS.OPENSHIFT)(
       const impersonate = getImpersonate(store.getState()) || {};
       const subprotocols = (impersonate.subprotocols || []).concat('base64.channel.k8s.io');
 
+      // Sessions go through the console's pod exec endpoint, which enforces the
+      // exec policy. It impersonates like the k8s proxy, from the subprotocols.
+      const query = new URLSearchParams({ container: activeContainer, tty: 'true' });
+      command.forEach((c) => query.append('command', c));
+      if (cluster) {
+        query.set('cluster', cluster);
+      }
+      const path = `${window.SERVER_FLAGS.basePath}api/pod-exec/${encodeURIComponent(
+        namespace,
+      )}/${encodeURIComponent(name)}/exec?${query.toString()}`;
+
       let previous;
       this.ws = new WSFactory(`${name}-terminal`, {
         host: 'auto',
         reconnect: true,
-        path: resourceURL(PodModel, params),
+        path,
         jsonParse: false,
         subprotocols,
       })
@@ -61,10 +61,14 @@ export const authSvc = {
       cluster ? `${window.SERVER_FLAGS.logoutURL}/${cluster}` : window.SERVER_FLAGS.logoutURL,
       { method: 'POST' },
     )
+      // The response holds the URL to end the identity provider session at, if it supports it.
+      .then((response) => (response.status === 200 ? response.json() : {}))
       // eslint-disable-next-line no-console
       .catch((e) => console.error('Error logging out', e))
-      .then(() => {
-        if (window.SERVER_FLAGS.logoutRedirect && !next) {
+      .then((json) => {
+        if (json?.endSessionURL && !next) {
+          window.location = json.endSessionURL;
+        } else if (window.SERVER_FLAGS.logoutRedirect && !next) {
           window.location = window.SERVER_FLAGS.logoutRedirect;
         } else {
           authSvc.login(cluster);
@@ -72,25 +76,25 @@ export const authSvc = {
       });
   }),
 
-  // Extra steps are needed if this is OpenShift to delete the user's access
-  // token and logout the kube:admin user.
+  // The console server deletes the user's access tokens on logout. An extra
+  // step is needed to logout the kube:admin user.
   logoutOpenShift: (isKubeAdmin = false) => {
-    return authSvc.deleteOpenShiftToken().then(() => {
-      if (isKubeAdmin) {
-        authSvc.logoutKubeAdmin();
-      } else {
-        authSvc.logout();
-      }
-    });
+    if (isKubeAdmin) {
+      authSvc.logoutKubeAdmin();
+    } else {
+      authSvc.logout();
+    }
   },
 
-  deleteOpenShiftToken: () => {
-    return (
-      coFetch('/api/openshift/delete-token', { method: 'POST' })
+  // Let the console server know the user is still active, so that it doesn't
+  // expire the session when an inactivity timeout is configured.
+  reportActivity: _.throttle(
+    () =>
+      coFetch('/api/console/activity', { method: 'POST' })
         // eslint-disable-next-line no-console
-        .catch((e) => console.error('Error deleting token', e))
-    );
-  },
+        .catch((e) => console.error('Error reporting user activity', e)),
+    60 * 1000,
+  ),
 
   // The kube:admin user has a special logout flow. The OAuth server has a
   // session cookie that must be cleared by POSTing to the kube:admin logout
@@ -122,9 +126,22 @@ export const authSvc = {
       });
   },
 
+  // Logging out of all clusters is a POST, so that it is CSRF protected. The
+  // console server answers with the logout page.
   logoutMulticluster: () => {
     clearLocalStorage([...clearLocalStorageKeys, lastClusterKey]);
-    window.location = window.SERVER_FLAGS.multiclusterLogoutRedirect;
+    coFetch(window.SERVER_FLAGS.multiclusterLogoutRedirect, { method: 'POST' })
+      .then((response) => response.text())
+      .then((html) => {
+        document.open();
+        document.write(html);
+        document.close();
+      })
+      .catch((e) => {
+        // eslint-disable-next-line no-console
+        console.error('Error logging out', e);
+        authSvc.login();
+      });
   },
 
   login: (cluster) => {
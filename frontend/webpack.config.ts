@@ -224,6 +224,12 @@ const config: Configuration = {
       inject: false,
       chunksSortMode: 'none',
     }),
+    new HtmlWebpackPlugin({
+      filename: './token-request.html',
+      template: './public/token-request.html',
+      inject: false,
+      chunksSortMode: 'none',
+    }),
     new HtmlWebpackPlugin({
       filename: './index.html',
       template: './public/index.html',
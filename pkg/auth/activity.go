@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UserActivityEndpoint is the console API path the frontend calls to report
+// user interaction (clicks, key presses) with the console.
+const UserActivityEndpoint = "/api/console/activity"
+
+// activityCookieSuffix names the cookie holding the last user activity of a
+// session, after the session cookie.
+const activityCookieSuffix = "-activity"
+
+// activityCookieGranularity is how often the activity cookie is rewritten
+// while the user is active, so that not every request sets it.
+const activityCookieGranularity = time.Minute
+
+// activityTracker records the last user activity of sessions so that sessions
+// can be expired server-side after a period of inactivity.
+//
+// The last activity is kept in a cookie rather than in memory, so that every
+// console replica sees the same idle period. The cookie holds the time of the
+// last activity and the session it belongs to, signed with a key only the
+// console replicas know, so that it can't be forged or moved to another session.
+type activityTracker struct {
+	timeout time.Duration
+	key     []byte
+	now     nowFunc
+}
+
+// newActivityTracker returns a tracker signing activity cookies with key. A
+// random key is used if empty, which only works for a single console replica.
+func newActivityTracker(timeout time.Duration, key []byte) *activityTracker {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic(fmt.Sprintf("FATAL ERROR: Unable to get random bytes for activity cookie key: %v", err))
+		}
+	}
+	return &activityTracker{
+		timeout: timeout,
+		key:     key,
+		now:     defaultNow,
+	}
+}
+
+// lastActivity returns the time of the last user activity of the session
+// recorded in the activity cookie value, or false if the value isn't valid
+// for the session.
+func (t *activityTracker) lastActivity(value, session string) (time.Time, bool) {
+	i := strings.Index(value, ".")
+	if i == -1 {
+		return time.Time{}, false
+	}
+	timestamp, mac := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(mac), []byte(t.mac(timestamp, session))) {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// isIdle reports whether a session last active at lastActivity has been idle
+// for longer than the timeout.
+func (t *activityTracker) isIdle(lastActivity time.Time) bool {
+	return t.now().Sub(lastActivity) > t.timeout
+}
+
+// needsTouch reports whether the activity cookie should be rewritten to record
+// user activity of a session last active at lastActivity.
+func (t *activityTracker) needsTouch(lastActivity time.Time) bool {
+	return t.now().Sub(lastActivity) >= activityCookieGranularity
+}
+
+// cookieValue returns the activity cookie value recording user activity of the
+// session at lastActivity.
+func (t *activityTracker) cookieValue(session string, lastActivity time.Time) string {
+	timestamp := strconv.FormatInt(lastActivity.Unix(), 10)
+	return timestamp + "." + t.mac(timestamp, session)
+}
+
+func (t *activityTracker) mac(timestamp, session string) string {
+	mac := hmac.New(sha256.New, t.key)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{0})
+	mac.Write([]byte(session))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// isUserActivity reports whether a request was triggered by the user rather
+// than by background polling or watches. Only explicit activity reports from
+// the frontend and mutating requests count as user activity.
+func isUserActivity(r *http.Request) bool {
+	for _, upgrade := range r.Header["Upgrade"] {
+		if strings.EqualFold(upgrade, "websocket") {
+			return false
+		}
+	}
+	if strings.HasSuffix(r.URL.Path, UserActivityEndpoint) {
+		return true
+	}
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return false
+	}
+	return true
+}
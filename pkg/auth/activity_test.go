@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestActivityTracker(t *testing.T) {
+	now := time.Now()
+	key := []byte("0123456789abcdef0123456789abcdef")
+	tracker := newActivityTracker(10*time.Minute, key)
+	tracker.now = func() time.Time { return now }
+
+	value := tracker.cookieValue("session", now)
+	// A replica with the same key reading the cookie sees the same activity.
+	other := newActivityTracker(10*time.Minute, key)
+	lastActivity, ok := other.lastActivity(value, "session")
+	if !ok || lastActivity.Unix() != now.Unix() {
+		t.Fatalf("expected the activity cookie to hold %v, got %v (valid: %v)", now, lastActivity, ok)
+	}
+
+	if _, ok := tracker.lastActivity(value, "other-session"); ok {
+		t.Fatal("activity cookie should not be valid for another session")
+	}
+	if _, ok := tracker.lastActivity(strconv.FormatInt(now.Add(time.Hour).Unix(), 10)+value[strings.Index(value, "."):], "session"); ok {
+		t.Fatal("activity cookie with a forged time should not be valid")
+	}
+	if _, ok := newActivityTracker(10*time.Minute, nil).lastActivity(value, "session"); ok {
+		t.Fatal("activity cookie should not be valid with another key")
+	}
+
+	now = now.Add(9 * time.Minute)
+	if tracker.isIdle(lastActivity) {
+		t.Fatal("session should not be idle before the timeout")
+	}
+	if !tracker.needsTouch(lastActivity) {
+		t.Fatal("activity cookie should be rewritten on activity after a minute")
+	}
+
+	now = now.Add(2 * time.Minute)
+	if !tracker.isIdle(lastActivity) {
+		t.Fatal("session should be idle after the timeout")
+	}
+}
+
+func TestInactivityTimeout(t *testing.T) {
+	p := &mockOpenShiftProvider{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/apis/user.openshift.io/v1/users/~":
+			fmt.Fprint(w, `{"metadata":{"name":"alice","uid":"uid-alice"}}`)
+		case strings.HasPrefix(r.URL.Path, "/apis/oauth.openshift.io/v1/oauthaccesstokens/"):
+		default:
+			p.handleDiscovery(w, r)
+		}
+	}))
+	defer s.Close()
+	p.issuer = s.URL
+
+	a, err := NewAuthenticator(context.Background(), &Config{
+		AuthSource:        AuthSourceOpenShift,
+		ClientID:          "fake-client-id",
+		ClientSecret:      "fake-secret",
+		RedirectURL:       "http://example.com/callback",
+		IssuerURL:         p.issuer,
+		CookiePath:        "/",
+		RefererPath:       "http://auth.example.com/",
+		ClusterName:       "local-cluster",
+		InactivityTimeout: 10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	a.activity.now = func() time.Time { return now }
+
+	_, lm := a.authFunc()
+	if _, err := lm.login(httptest.NewRecorder(), &oauth2.Token{AccessToken: "sha256~alice", Expiry: now.Add(time.Hour)}, ""); err != nil {
+		t.Fatal(err)
+	}
+	request := func(activity *http.Cookie) *http.Request {
+		r := httptest.NewRequest("GET", "http://example.com/api/kubernetes/api/v1/pods", nil)
+		r.AddCookie(&http.Cookie{Name: GetCookieName("local-cluster"), Value: "sha256~alice"})
+		if activity != nil {
+			r.AddCookie(activity)
+		}
+		return r
+	}
+
+	// Dropping the activity cookie doesn't restart the idle period.
+	now = now.Add(5 * time.Minute)
+	rr := httptest.NewRecorder()
+	if _, err := a.Authenticate(rr, request(nil)); err != nil {
+		t.Fatal(err)
+	}
+	var activity *http.Cookie
+	for _, cookie := range rr.Result().Cookies() {
+		if cookie.Name == a.activityCookieName() {
+			activity = cookie
+		}
+	}
+	if activity == nil {
+		t.Fatal("expected the activity cookie to be set")
+	}
+	if lastActivity, ok := a.activity.lastActivity(activity.Value, "sha256~alice"); !ok || now.Sub(lastActivity) < 5*time.Minute-time.Second {
+		t.Errorf("expected the activity cookie to record the creation of the session, got %v", lastActivity)
+	}
+
+	now = now.Add(6 * time.Minute)
+	if _, err := a.Authenticate(httptest.NewRecorder(), request(activity)); err == nil {
+		t.Error("expected the session to be idle")
+	}
+	if _, err := a.Authenticate(httptest.NewRecorder(), request(nil)); err == nil {
+		t.Error("expected the session without an activity cookie to be idle")
+	}
+}
+
+func TestIsUserActivity(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		upgrade  string
+		activity bool
+	}{
+		{"POST", "/api/console/activity", "", true},
+		{"POST", "/base-path/api/console/activity", "", true},
+		{"GET", "/api/kubernetes/api/v1/pods", "", false},
+		{"GET", "/api/kubernetes/api/v1/pods?watch=true", "websocket", false},
+		{"POST", "/api/kubernetes/api/v1/namespaces/default/pods", "", true},
+		{"DELETE", "/api/helm/release", "", true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if tt.upgrade != "" {
+			r.Header.Set("Upgrade", tt.upgrade)
+		}
+		if got := isUserActivity(r); got != tt.activity {
+			t.Errorf("%s %s: want user activity %v, got %v", tt.method, tt.path, tt.activity, got)
+		}
+	}
+}
@@ -2,13 +2,11 @@ package auth
 
 import (
 	"context"
-	"crypto/rand"
 	"crypto/subtle"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -22,6 +20,8 @@ import (
 	oscrypto "github.com/openshift/library-go/pkg/crypto"
 
 	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/serverutils"
 )
 
 const (
@@ -36,6 +36,16 @@ const (
 	errorMissingState = "missing_state"
 	errorInvalidCode  = "invalid_code"
 	errorInvalidState = "invalid_state"
+	errorAccessDenied = "access_denied"
+
+	errorUnavailable = "auth_unavailable"
+
+	// tokenRefreshThreshold is how long before expiry bridge refreshes a user's
+	// token, provided the session holds a refresh token.
+	tokenRefreshThreshold = 5 * time.Minute
+	// discoveryBackoff is how long to wait before contacting an unreachable
+	// identity provider again.
+	discoveryBackoff = 10 * time.Second
 )
 
 var (
@@ -48,15 +58,39 @@ var (
 )
 
 type Authenticator struct {
+	// authFunc is nil until the identity provider was contacted. Use getAuthFunc.
 	authFunc func() (*oauth2.Config, loginMethod)
 
 	clientFunc func() *http.Client
 
 	// userFunc returns the User associated with the cookie from a request.
 	// This is not part of loginMethod to avoid creating an unnecessary
-	// HTTP client for every call.
+	// HTTP client for every call. Use getUserFunc.
 	userFunc func(*http.Request) (*User, error)
 
+	// statusMux guards authFunc, userFunc and status, which are set in the
+	// background by StartAuthenticator.
+	statusMux sync.RWMutex
+	status    Status
+
+	// sessions holds server-side login state, including refresh tokens.
+	sessions *SessionStore
+	// sessionCookieName is the name of the cookie that identifies a session in sessions.
+	sessionCookieName string
+	// refreshLocks serializes the token refreshes of each session so a refresh
+	// token is only redeemed once, without holding up other sessions.
+	refreshLocks sessionLocks
+	// activity tracks user activity of sessions when an inactivity timeout is configured.
+	activity *activityTracker
+	// trustForwardedFor takes the client address of new sessions from the
+	// X-Forwarded-For header.
+	trustForwardedFor bool
+
+	authSource    AuthSource
+	clusterName   string
+	tokenReviewer *TokenReviewer
+	tokenRequest  tokenRequestClient
+
 	errorURL      string
 	successURL    string
 	cookiePath    string
@@ -64,6 +98,15 @@ type Authenticator struct {
 	secureCookies bool
 }
 
+// Status reports whether an authenticator was able to contact its identity
+// provider. Logging in is unavailable until it is ready.
+type Status struct {
+	Cluster     string    `json:"cluster"`
+	Ready       bool      `json:"ready"`
+	Error       string    `json:"error,omitempty"`
+	LastAttempt time.Time `json:"lastAttempt"`
+}
+
 type SpecialAuthURLs struct {
 	// RequestToken is a special page in the OpenShift integrated OAuth server for requesting a token.
 	RequestToken string
@@ -78,10 +121,16 @@ type SpecialAuthURLs struct {
 // support. It should not be made public or exposed to other packages.
 type loginMethod interface {
 	// login turns on oauth2 token response into a user session and associates a
-	// cookie with the user.
-	login(http.ResponseWriter, *oauth2.Token) (*loginState, error)
-	// logout deletes any cookies associated with the user.
-	logout(http.ResponseWriter, *http.Request)
+	// cookie with the user. The nonce, if not empty, must match the one in the ID token.
+	login(w http.ResponseWriter, token *oauth2.Token, nonce string) (*loginState, error)
+	// refresh replaces the current login state with one built from a refreshed
+	// oauth2 token response and reissues the session cookie.
+	refresh(w http.ResponseWriter, current *loginState, token *oauth2.Token) (*loginState, error)
+	// logout deletes any cookies associated with the user. It returns the URL
+	// to end the user's session with the identity provider at, if any.
+	logout(http.ResponseWriter, *http.Request) string
+	// revokeToken invalidates the token with the identity provider, if supported.
+	revokeToken(ctx context.Context, token string) error
 	getSpecialURLs() SpecialAuthURLs
 }
 
@@ -114,6 +163,40 @@ type Config struct {
 	CookiePath    string
 	SecureCookies bool
 	ClusterName   string
+
+	// InactivityTimeout is the idle period after which a session is expired
+	// server-side. Zero disables the timeout.
+	InactivityTimeout time.Duration
+	// CookieAuthenticationKey signs the cookies that must not be forged, like
+	// the activity cookie. It must be the same on all console replicas. A
+	// random key is used if empty.
+	CookieAuthenticationKey []byte
+	// TrustForwardedFor records the last X-Forwarded-For address as the client
+	// address of sessions instead of the peer address. Only set it if a router
+	// in front of the console appends the header.
+	TrustForwardedFor bool
+
+	// ClaimMapping selects the ID token claims identifying OIDC users.
+	ClaimMapping ClaimMapping
+	// AllowedGroups, if not empty, restricts OIDC login to members of at
+	// least one of these groups (including the groups prefix).
+	AllowedGroups []string
+
+	// TokenReviewer validates bearer tokens of API requests made without a
+	// session, e.g. by automation. Nil disables bearer token authentication.
+	TokenReviewer *TokenReviewer
+
+	// TokenRequestClientID and TokenRequestClientSecret identify a separate
+	// OAuth client that issues tokens for command line tools, so they are
+	// independent of console sessions. An empty client ID disables the token
+	// request flow.
+	TokenRequestClientID     string
+	TokenRequestClientSecret string
+	TokenRequestRedirectURL  string
+
+	// LogoutStore shares OIDC back-channel logouts between console replicas.
+	// Nil keeps them in memory, which is only enough for a single replica.
+	LogoutStore LogoutStore
 }
 
 func newHTTPClient(issuerCA string, includeSystemRoots bool) (*http.Client, error) {
@@ -168,95 +251,147 @@ func newHTTPClient(issuerCA string, includeSystemRoots bool) (*http.Client, erro
 // NewAuthenticator initializes an Authenticator struct. It blocks until the authenticator is
 // able to contact the provider.
 func NewAuthenticator(ctx context.Context, c *Config) (*Authenticator, error) {
-	// Retry connecting to the identity provider every 10s for 5 minutes
-	const (
-		backoff  = time.Second * 10
-		maxSteps = 30
-	)
-	steps := 0
+	a, err := newUnstartedAuthenticator(c)
+	if err != nil {
+		return nil, err
+	}
 
-	for {
-		a, err := newUnstartedAuthenticator(c)
-		if err != nil {
+	// Retry connecting to the identity provider every 10s for 5 minutes
+	const maxSteps = 30
+	for steps := 0; ; steps++ {
+		err := a.discover(ctx, c)
+		if err == nil {
+			return a, nil
+		}
+		if steps >= maxSteps {
+			klog.Errorf("error contacting auth provider: %v", err)
 			return nil, err
 		}
+		klog.Errorf("error contacting auth provider (retrying in %s): %v", discoveryBackoff, err)
+		time.Sleep(discoveryBackoff)
+	}
+}
 
-		var authSourceFunc func() (oauth2.Endpoint, loginMethod, error)
-		switch c.AuthSource {
-		case AuthSourceOpenShift:
-			a.userFunc = getOpenShiftUser
-			authSourceFunc = func() (oauth2.Endpoint, loginMethod, error) {
-				// Use the k8s CA for OAuth metadata discovery.
-				k8sClient, errK8Client := newHTTPClient(c.K8sCA, true)
-				if errK8Client != nil {
-					return oauth2.Endpoint{}, nil, errK8Client
-				}
-
-				return newOpenShiftAuth(ctx, &openShiftConfig{
-					k8sClient:     k8sClient,
-					oauthClient:   a.clientFunc(),
-					issuerURL:     c.IssuerURL,
-					cookiePath:    c.CookiePath,
-					secureCookies: c.SecureCookies,
-					clusterName:   c.ClusterName,
-				})
+// StartAuthenticator initializes an Authenticator struct without waiting for
+// the provider. The provider is contacted in the background until it succeeds
+// or ctx is done. Until then, logging in is unavailable and Status reports the
+// last error.
+func StartAuthenticator(ctx context.Context, c *Config) (*Authenticator, error) {
+	a, err := newUnstartedAuthenticator(c)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			err := a.discover(ctx, c)
+			if err == nil {
+				klog.Infof("authenticator for cluster %s is ready", c.ClusterName)
+				return
 			}
-		default:
-			// OIDC auth source is stateful, so only create it once.
-			endpoint, oidcAuthSource, err := newOIDCAuth(ctx, &oidcConfig{
-				client:        a.clientFunc(),
+			klog.Errorf("error contacting auth provider of cluster %s (retrying in %s): %v", c.ClusterName, discoveryBackoff, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(discoveryBackoff):
+			}
+		}
+	}()
+	return a, nil
+}
+
+// discover contacts the identity provider and, if that succeeds, makes login
+// available.
+func (a *Authenticator) discover(ctx context.Context, c *Config) error {
+	var (
+		authSourceFunc func() (oauth2.Endpoint, loginMethod, error)
+		userFunc       func(*http.Request) (*User, error)
+	)
+	switch c.AuthSource {
+	case AuthSourceOpenShift:
+		userFunc = getOpenShiftUser
+		authSourceFunc = func() (oauth2.Endpoint, loginMethod, error) {
+			// Use the k8s CA for OAuth metadata discovery.
+			k8sClient, errK8Client := newHTTPClient(c.K8sCA, true)
+			if errK8Client != nil {
+				return oauth2.Endpoint{}, nil, errK8Client
+			}
+
+			return newOpenShiftAuth(ctx, &openShiftConfig{
+				k8sClient:     k8sClient,
+				oauthClient:   a.clientFunc(),
 				issuerURL:     c.IssuerURL,
-				clientID:      c.ClientID,
 				cookiePath:    c.CookiePath,
 				secureCookies: c.SecureCookies,
+				clusterName:   c.ClusterName,
+				sessions:      a.sessions,
 			})
-			a.userFunc = func(r *http.Request) (*User, error) {
-				if oidcAuthSource == nil {
-					return nil, fmt.Errorf("OIDC auth source is not intialized")
-				}
-				return oidcAuthSource.authenticate(r)
-			}
-			authSourceFunc = func() (oauth2.Endpoint, loginMethod, error) {
-				return endpoint, oidcAuthSource, err
-			}
 		}
-
-		fallbackEndpoint, fallbackLoginMethod, err := authSourceFunc()
-		if err != nil {
-			steps++
-			if steps > maxSteps {
-				klog.Errorf("error contacting auth provider: %v", err)
-				return nil, err
+	default:
+		logouts := c.LogoutStore
+		if logouts == nil {
+			logouts = newMemoryLogoutStore()
+		}
+		// OIDC auth source is stateful, so only create it once.
+		endpoint, oidcAuthSource, err := newOIDCAuth(ctx, &oidcConfig{
+			client:        a.clientFunc(),
+			issuerURL:     c.IssuerURL,
+			clientID:      c.ClientID,
+			cookiePath:    c.CookiePath,
+			secureCookies: c.SecureCookies,
+			sessions:      a.sessions,
+			claimMapping:  c.ClaimMapping,
+			allowedGroups: c.AllowedGroups,
+			// Send users back to the console after logging out at the provider.
+			postLogoutRedirectURL: a.successURL,
+			logouts:               logouts,
+		})
+		if err == nil && c.LogoutStore != nil {
+			go oidcAuthSource.syncLogouts(ctx)
+		}
+		userFunc = func(r *http.Request) (*User, error) {
+			if oidcAuthSource == nil {
+				return nil, fmt.Errorf("OIDC auth source is not intialized")
 			}
-
-			klog.Errorf("error contacting auth provider (retrying in %s): %v", backoff, err)
-
-			time.Sleep(backoff)
-			continue
+			return oidcAuthSource.authenticate(r)
+		}
+		authSourceFunc = func() (oauth2.Endpoint, loginMethod, error) {
+			return endpoint, oidcAuthSource, err
 		}
+	}
 
-		a.authFunc = func() (*oauth2.Config, loginMethod) {
-			// rebuild non-pointer struct each time to prevent any mutation
-			baseOAuth2Config := oauth2.Config{
-				ClientID:     c.ClientID,
-				ClientSecret: c.ClientSecret,
-				RedirectURL:  c.RedirectURL,
-				Scopes:       c.Scope,
-				Endpoint:     fallbackEndpoint,
-			}
+	fallbackEndpoint, fallbackLoginMethod, err := authSourceFunc()
+	if err != nil {
+		a.setStatus(false, err)
+		return err
+	}
 
-			currentEndpoint, currentLoginMethod, errAuthSource := authSourceFunc()
-			if errAuthSource != nil {
-				klog.Errorf("failed to get latest auth source data: %v", errAuthSource)
-				return &baseOAuth2Config, fallbackLoginMethod
-			}
+	authFunc := func() (*oauth2.Config, loginMethod) {
+		// rebuild non-pointer struct each time to prevent any mutation
+		baseOAuth2Config := oauth2.Config{
+			ClientID:     c.ClientID,
+			ClientSecret: c.ClientSecret,
+			RedirectURL:  c.RedirectURL,
+			Scopes:       c.Scope,
+			Endpoint:     fallbackEndpoint,
+		}
 
-			baseOAuth2Config.Endpoint = currentEndpoint
-			return &baseOAuth2Config, currentLoginMethod
+		currentEndpoint, currentLoginMethod, errAuthSource := authSourceFunc()
+		if errAuthSource != nil {
+			klog.Errorf("failed to get latest auth source data: %v", errAuthSource)
+			return &baseOAuth2Config, fallbackLoginMethod
 		}
 
-		return a, nil
+		baseOAuth2Config.Endpoint = currentEndpoint
+		return &baseOAuth2Config, currentLoginMethod
 	}
+
+	a.statusMux.Lock()
+	a.authFunc = authFunc
+	a.userFunc = userFunc
+	a.statusMux.Unlock()
+	a.setStatus(true, nil)
+	return nil
 }
 
 func newUnstartedAuthenticator(c *Config) (*Authenticator, error) {
@@ -294,55 +429,447 @@ func newUnstartedAuthenticator(c *Config) (*Authenticator, error) {
 		return nil, err
 	}
 
+	var activity *activityTracker
+	if c.InactivityTimeout > 0 {
+		activity = newActivityTracker(c.InactivityTimeout, c.CookieAuthenticationKey)
+	}
+
+	sessionCookieName := openshiftAccessTokenCookieName
+	userFunc := func(*http.Request) (*User, error) {
+		return nil, errors.New("authenticator is not ready")
+	}
+	if c.AuthSource == AuthSourceOpenShift {
+		sessionCookieName = GetCookieName(c.ClusterName)
+		// The cookie holds the access token, so existing sessions keep working
+		// while the OAuth server can't be reached.
+		userFunc = getOpenShiftUser
+	}
+
 	return &Authenticator{
-		clientFunc:    clientFunc,
-		errorURL:      errURL,
-		successURL:    sucURL,
-		cookiePath:    c.CookiePath,
-		refererURL:    refUrl,
-		secureCookies: c.SecureCookies,
+		clientFunc:        clientFunc,
+		userFunc:          userFunc,
+		status:            Status{Cluster: c.ClusterName},
+		sessions:          NewSessionStore(32768),
+		sessionCookieName: sessionCookieName,
+		activity:          activity,
+		trustForwardedFor: c.TrustForwardedFor,
+		authSource:        c.AuthSource,
+		clusterName:       c.ClusterName,
+		tokenReviewer:     c.TokenReviewer,
+		errorURL:          errURL,
+		successURL:        sucURL,
+		cookiePath:        c.CookiePath,
+		refererURL:        refUrl,
+		secureCookies:     c.SecureCookies,
+		tokenRequest: tokenRequestClient{
+			clientID:     c.TokenRequestClientID,
+			clientSecret: c.TokenRequestClientSecret,
+			redirectURL:  c.TokenRequestRedirectURL,
+		},
 	}, nil
 }
 
+// Status reports whether the authenticator is ready and the last error
+// contacting the identity provider.
+func (a *Authenticator) Status() Status {
+	a.statusMux.RLock()
+	defer a.statusMux.RUnlock()
+	return a.status
+}
+
+// Healthy returns an error until the authenticator is ready, so that it can be
+// used as a readiness check.
+func (a *Authenticator) Healthy() error {
+	if status := a.Status(); !status.Ready {
+		return fmt.Errorf("authenticator for cluster %s is not ready: %s", status.Cluster, status.Error)
+	}
+	return nil
+}
+
+func (a *Authenticator) setStatus(ready bool, err error) {
+	a.statusMux.Lock()
+	defer a.statusMux.Unlock()
+	a.status.Ready = ready
+	a.status.Error = ""
+	if err != nil {
+		a.status.Error = err.Error()
+	}
+	a.status.LastAttempt = time.Now()
+}
+
+// getAuthFunc returns authFunc, or nil if the authenticator isn't ready.
+func (a *Authenticator) getAuthFunc() func() (*oauth2.Config, loginMethod) {
+	a.statusMux.RLock()
+	defer a.statusMux.RUnlock()
+	return a.authFunc
+}
+
+func (a *Authenticator) getUserFunc() func(*http.Request) (*User, error) {
+	a.statusMux.RLock()
+	defer a.statusMux.RUnlock()
+	return a.userFunc
+}
+
 // User holds fields representing a user.
 type User struct {
 	ID       string
 	Username string
+	Groups   []string
 	Token    string
 }
 
-func (a *Authenticator) Authenticate(r *http.Request) (*User, error) {
-	return a.userFunc(r)
+// Authenticate returns the User associated with the request. Sessions holding
+// a refresh token are refreshed shortly before they expire, in which case the
+// updated session cookie is written to w. When an inactivity timeout is
+// configured, idle sessions are expired and their token revoked.
+func (a *Authenticator) Authenticate(w http.ResponseWriter, r *http.Request) (*User, error) {
+	user, session, err := a.authenticate(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.activity != nil {
+		if cookie, err := r.Cookie(a.sessionCookieName); err == nil && cookie.Value != "" {
+			lastActivity, ok := time.Time{}, false
+			if activityCookie, err := r.Cookie(a.activityCookieName()); err == nil {
+				lastActivity, ok = a.activity.lastActivity(activityCookie.Value, cookie.Value)
+			}
+			// Dropping the activity cookie doesn't restart the idle period.
+			// Without it, the session was last active when it was created, and
+			// sessions of unknown age are idle.
+			if !ok {
+				lastActivity, _ = a.sessions.sessionCreated(cookie.Value)
+			}
+			if a.activity.isIdle(lastActivity) {
+				a.expireIdleSession(w, r, user)
+				return nil, fmt.Errorf("session expired after %s of inactivity", a.activity.timeout)
+			}
+			touch := isUserActivity(r) && a.activity.needsTouch(lastActivity)
+			if touch {
+				lastActivity = a.activity.now()
+			}
+			// The cookie is also rewritten for the new session of a refresh.
+			if touch || !ok || session != cookie.Value {
+				a.setActivityCookie(w, session, lastActivity)
+			}
+		}
+	}
+	a.touchSession(r, user)
+	return user, nil
+}
+
+// touchSession records the use of the request's session for the session
+// management API and fills in the username if the login method couldn't.
+func (a *Authenticator) touchSession(r *http.Request, user *User) {
+	cookie, err := r.Cookie(a.sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return
+	}
+	if username, ok := a.sessions.touchSession(cookie.Value); ok && user.Username == "" {
+		user.Username = username
+	}
+}
+
+// BearerTokenEnabled reports whether requests can authenticate with an
+// `Authorization: Bearer` token instead of a session.
+func (a *Authenticator) BearerTokenEnabled() bool {
+	return a.tokenReviewer != nil
 }
 
-// LoginFunc redirects to the OIDC provider for user login.
-func (a *Authenticator) LoginFunc(w http.ResponseWriter, r *http.Request) {
-	var randData [4]byte
-	if _, err := io.ReadFull(rand.Reader, randData[:]); err != nil {
-		panic(err)
+// AuthenticateBearerToken returns the User the `Authorization: Bearer` token of
+// the request belongs to. Bearer tokens aren't subject to the inactivity timeout.
+func (a *Authenticator) AuthenticateBearerToken(r *http.Request) (*User, error) {
+	if a.tokenReviewer == nil {
+		return nil, fmt.Errorf("bearer token authentication is not enabled")
 	}
-	state := hex.EncodeToString(randData[:])
+	token := GetBearerToken(r)
+	if token == "" {
+		return nil, fmt.Errorf("no bearer token in request")
+	}
+	return a.tokenReviewer.Review(r.Context(), token)
+}
 
-	cookie := http.Cookie{
-		Name:     stateCookieName,
-		Value:    state,
+// authenticate returns the User associated with the request and the session
+// cookie value the client holds afterwards, which changes if the session is
+// refreshed.
+func (a *Authenticator) authenticate(w http.ResponseWriter, r *http.Request) (*User, string, error) {
+	session := ""
+	if cookie, err := r.Cookie(a.sessionCookieName); err == nil {
+		session = cookie.Value
+	}
+	ls := a.getRefreshableSession(r)
+	if ls == nil {
+		user, err := a.getUserFunc()(r)
+		return user, session, err
+	}
+
+	refreshed, err := a.refreshSession(w, ls, tokenRefreshThreshold)
+	if err != nil {
+		// Users removed from the allowed groups lose their session right away.
+		if errors.Is(err, errAccessDenied) {
+			if a.sessions.getSession(ls.sessionToken) != nil {
+				a.sessions.deleteSession(ls.sessionToken)
+			}
+			a.clearSessionCookie(w)
+			return nil, "", err
+		}
+		if ls.isExpired() {
+			if a.sessions.getSession(ls.sessionToken) != nil {
+				a.sessions.deleteSession(ls.sessionToken)
+			}
+			return nil, "", fmt.Errorf("session expired and could not be refreshed: %v", err)
+		}
+		klog.Errorf("failed to refresh session, using the current token until it expires: %v", err)
+		user, err := a.getUserFunc()(r)
+		return user, session, err
+	}
+	return refreshed.toUser(), refreshed.sessionToken, nil
+}
+
+// expireIdleSession revokes the token of an idle session and removes the
+// session cookie. The token is revoked so that the session ends on every
+// replica, not only on the one that found it idle.
+func (a *Authenticator) expireIdleSession(w http.ResponseWriter, r *http.Request, user *User) {
+	if lm := a.getLoginMethod(); lm != nil {
+		if err := lm.revokeToken(r.Context(), user.Token); err != nil {
+			klog.Errorf("failed to revoke token of idle session: %v", err)
+		}
+	}
+
+	if cookie, err := r.Cookie(a.sessionCookieName); err == nil {
+		if a.sessions.getSession(cookie.Value) != nil {
+			a.sessions.deleteSession(cookie.Value)
+		}
+	}
+	a.clearSessionCookie(w)
+	klog.V(4).Info("expired idle session")
+}
+
+func (a *Authenticator) clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     a.sessionCookieName,
+		Value:    "",
+		MaxAge:   -1,
 		HttpOnly: true,
+		Path:     a.cookiePath,
 		Secure:   a.secureCookies,
-		// Make sure cookie path matches multi-cluster login paths
-		Path: "/",
+	})
+	if a.activity != nil {
+		http.SetCookie(w, &http.Cookie{
+			Name:     a.activityCookieName(),
+			Value:    "",
+			MaxAge:   -1,
+			HttpOnly: true,
+			Path:     a.cookiePath,
+			Secure:   a.secureCookies,
+		})
 	}
-	http.SetCookie(w, &cookie)
-	http.Redirect(w, r, a.getOAuth2Config().AuthCodeURL(state), http.StatusSeeOther)
 }
 
-// LogoutFunc cleans up session cookies.
-func (a *Authenticator) LogoutFunc(w http.ResponseWriter, r *http.Request) {
-	a.getLoginMethod().logout(w, r)
+func (a *Authenticator) activityCookieName() string {
+	return a.sessionCookieName + activityCookieSuffix
+}
+
+// setActivityCookie records user activity of the session at lastActivity.
+func (a *Authenticator) setActivityCookie(w http.ResponseWriter, session string, lastActivity time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     a.activityCookieName(),
+		Value:    a.activity.cookieValue(session, lastActivity),
+		HttpOnly: true,
+		Path:     a.cookiePath,
+		Secure:   a.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// getRefreshableSession returns the login state of the request's session if it
+// is due for a refresh, nil otherwise.
+func (a *Authenticator) getRefreshableSession(r *http.Request) *loginState {
+	if a.sessions == nil || a.sessionCookieName == "" {
+		return nil
+	}
+	cookie, err := r.Cookie(a.sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+	ls := a.sessions.getSession(cookie.Value)
+	if ls == nil || !ls.needsRefresh(tokenRefreshThreshold) {
+		return nil
+	}
+	return ls
+}
+
+// refreshSession redeems the refresh token of ls and stores the resulting login
+// state, unless the session was already refreshed and now expires later than
+// the threshold.
+func (a *Authenticator) refreshSession(w http.ResponseWriter, ls *loginState, threshold time.Duration) (*loginState, error) {
+	defer a.refreshLocks.lock(ls.sessionToken)()
+
+	// Another request might have refreshed the session while we were waiting.
+	current := a.sessions.getSession(ls.sessionToken)
+	if current == nil {
+		return nil, fmt.Errorf("session was replaced or removed during refresh")
+	}
+	if !current.needsRefresh(threshold) {
+		return current, nil
+	}
+
+	authFunc := a.getAuthFunc()
+	if authFunc == nil {
+		return nil, errors.New("authenticator is not ready")
+	}
+	ctx := oidc.ClientContext(context.TODO(), a.clientFunc())
+	oauthConfig, lm := authFunc()
+	// Leave out the access token so the token source always asks for a new one.
+	token, err := oauthConfig.TokenSource(ctx, &oauth2.Token{RefreshToken: current.refreshToken}).Token()
+	if err != nil {
+		return nil, fmt.Errorf("unable to refresh token with issuer: %v", err)
+	}
+
+	refreshed, err := lm.refresh(w, current, token)
+	if err != nil {
+		return nil, fmt.Errorf("error constructing refreshed login state: %w", err)
+	}
+	a.sessions.transferSession(current, refreshed)
+	klog.V(4).Info("refreshed session token")
+	return refreshed, nil
+}
+
+// LoginFunc redirects to the OIDC provider for user login. An optional `then`
+// query parameter holds a console path to return to after login.
+func (a *Authenticator) LoginFunc(w http.ResponseWriter, r *http.Request) {
+	oauthConfig := a.getOAuth2Config()
+	if oauthConfig == nil {
+		klog.Errorf("login to cluster %s is unavailable until its identity provider can be reached", a.clusterName)
+		a.redirectAuthError(w, errorUnavailable)
+		return
+	}
+	flow, err := newLoginFlow(a.authSource != AuthSourceOpenShift)
+	if err != nil {
+		klog.Errorf("failed to start login flow: %v", err)
+		a.redirectAuthError(w, errorInternal)
+		return
+	}
+	if then := r.URL.Query().Get("then"); then != "" {
+		if _, err := thenURL(a.successURL, then); err != nil {
+			// Not fatal, the user lands on the default page instead.
+			klog.Warningf("ignoring invalid then parameter: %v", err)
+		} else {
+			flow.Then = then
+		}
+	}
+	if err := a.setLoginFlowCookie(w, stateCookieName, flow); err != nil {
+		klog.Errorf("failed to set state cookie: %v", err)
+		a.redirectAuthError(w, errorInternal)
+		return
+	}
+	http.Redirect(w, r, oauthConfig.AuthCodeURL(flow.State, flow.authCodeOptions()...), http.StatusSeeOther)
+}
+
+// LogoutResult reports the outcome of logging out of a cluster.
+type LogoutResult struct {
+	Cluster      string `json:"cluster"`
+	TokenRevoked bool   `json:"tokenRevoked"`
+	Error        string `json:"error,omitempty"`
+	// EndSessionURL is where to end the user's session with the identity
+	// provider, if it supports RP-initiated logout.
+	EndSessionURL string `json:"endSessionURL,omitempty"`
+}
+
+// HasSession reports whether the request carries a session cookie for this
+// authenticator's cluster.
+func (a *Authenticator) HasSession(r *http.Request) bool {
+	cookie, err := r.Cookie(a.sessionCookieName)
+	return err == nil && cookie.Value != ""
+}
+
+// Logout revokes the user's token, if the identity provider supports it, and
+// deletes the session and its cookie.
+func (a *Authenticator) Logout(w http.ResponseWriter, r *http.Request) *LogoutResult {
+	result := &LogoutResult{Cluster: a.clusterName}
+	lm := a.getLoginMethod()
+	if lm == nil {
+		// No session can have been started, other than an OpenShift access token
+		// cookie, which can't be revoked without the OAuth server.
+		a.clearSessionCookie(w)
+		result.Error = "authenticator is not ready"
+		return result
+	}
+	if token := a.sessionToken(r); token != "" {
+		if err := lm.revokeToken(r.Context(), token); err != nil {
+			klog.Errorf("failed to revoke token on logout from cluster %s: %v", a.clusterName, err)
+			result.Error = err.Error()
+		} else {
+			result.TokenRevoked = a.authSource == AuthSourceOpenShift
+		}
+	}
+	result.EndSessionURL = lm.logout(w, r)
+	return result
+}
+
+// sessionToken returns the token of the request's session, if any.
+func (a *Authenticator) sessionToken(r *http.Request) string {
+	cookie, err := r.Cookie(a.sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return ""
+	}
+	if ls := a.sessions.getSession(cookie.Value); ls != nil {
+		return ls.rawToken
+	}
+	// The OpenShift cookie is the access token itself.
+	if a.authSource == AuthSourceOpenShift {
+		return cookie.Value
+	}
+	return ""
+}
+
+// backChannelLogoutHandler is implemented by login methods supporting OIDC
+// back-channel logout.
+type backChannelLogoutHandler interface {
+	backChannelLogout(ctx context.Context, logoutToken string) error
+}
+
+// BackChannelLogoutFunc receives logout tokens from the identity provider and
+// deletes the sessions they refer to.
+// https://openid.net/specs/openid-connect-backchannel-1_0.html#BCRequest
+func (a *Authenticator) BackChannelLogoutFunc(w http.ResponseWriter, r *http.Request) {
+	lm := a.getLoginMethod()
+	if lm == nil {
+		serverutils.SendResponse(w, http.StatusServiceUnavailable, serverutils.ApiError{Err: "authenticator is not ready"})
+		return
+	}
+	handler, ok := lm.(backChannelLogoutHandler)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		serverutils.SendResponse(w, http.StatusMethodNotAllowed, serverutils.ApiError{Err: "Invalid method: only POST is allowed"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	logoutToken := r.PostFormValue("logout_token")
+	if logoutToken == "" {
+		serverutils.SendResponse(w, http.StatusBadRequest, serverutils.ApiError{Err: "missing logout_token"})
+		return
+	}
+	if err := handler.backChannelLogout(r.Context(), logoutToken); err != nil {
+		klog.Errorf("invalid back-channel logout request: %v", err)
+		serverutils.SendResponse(w, http.StatusBadRequest, serverutils.ApiError{Err: "invalid logout_token"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
 }
 
 // GetKubeAdminLogoutURL returns the logout URL for the special kube:admin user in OpenShift
 func (a *Authenticator) GetSpecialURLs() SpecialAuthURLs {
-	return a.getLoginMethod().getSpecialURLs()
+	lm := a.getLoginMethod()
+	if lm == nil {
+		return SpecialAuthURLs{}
+	}
+	return lm.getSpecialURLs()
 }
 
 // CallbackFunc handles OAuth2 callbacks and code/token exchange.
@@ -354,7 +881,7 @@ func (a *Authenticator) CallbackFunc(fn func(loginInfo LoginJSON, successURL str
 		code := q.Get("code")
 		urlState := q.Get("state")
 
-		cookieState, err := r.Cookie(stateCookieName)
+		flow, err := a.getLoginFlow(r, stateCookieName)
 		if err != nil {
 			klog.Errorf("failed to parse state cookie: %v", err)
 			a.redirectAuthError(w, errorMissingState)
@@ -373,39 +900,77 @@ func (a *Authenticator) CallbackFunc(fn func(loginInfo LoginJSON, successURL str
 			return
 		}
 
-		if urlState != cookieState.Value {
-			klog.Error("state in url does not match State cookie")
+		if err := flow.verifyState(urlState); err != nil {
+			klog.Error(err)
 			a.redirectAuthError(w, errorInvalidState)
 			return
 		}
+		// The flow secrets are single use.
+		a.clearLoginFlowCookie(w, stateCookieName)
+
+		authFunc := a.getAuthFunc()
+		if authFunc == nil {
+			a.redirectAuthError(w, errorUnavailable)
+			return
+		}
 		ctx := oidc.ClientContext(context.TODO(), a.clientFunc())
-		oauthConfig, lm := a.authFunc()
-		token, err := oauthConfig.Exchange(ctx, code)
+		oauthConfig, lm := authFunc()
+		token, err := oauthConfig.Exchange(ctx, code, flow.exchangeOptions()...)
 		if err != nil {
 			klog.Errorf("unable to verify auth code with issuer: %v", err)
 			a.redirectAuthError(w, errorInvalidCode)
 			return
 		}
 
-		ls, err := lm.login(w, token)
+		ls, err := lm.login(w, token, flow.Nonce)
+		if errors.Is(err, errAccessDenied) {
+			klog.Infof("login rejected: %v", err)
+			a.redirectAuthError(w, errorAccessDenied)
+			return
+		}
 		if err != nil {
 			klog.Errorf("error constructing login state: %v", err)
 			a.redirectAuthError(w, errorInternal)
 			return
 		}
 
-		klog.Infof("oauth success, redirecting to: %q", a.successURL)
-		fn(ls.toLoginJSON(), a.successURL, w)
+		a.sessions.describeSession(ls.sessionToken, clientIP(r, a.trustForwardedFor), r.UserAgent())
+		if a.activity != nil {
+			a.setActivityCookie(w, ls.sessionToken, a.activity.now())
+		}
+
+		successURL := a.successURL
+		if flow.Then != "" {
+			// Validate again, the cookie can't be trusted more than the query parameter.
+			if u, err := thenURL(a.successURL, flow.Then); err != nil {
+				klog.Warningf("ignoring invalid then parameter: %v", err)
+			} else {
+				successURL = u
+			}
+		}
+
+		klog.Infof("oauth success, redirecting to: %q", successURL)
+		fn(ls.toLoginJSON(), successURL, w)
 	}
 }
 
+// getOAuth2Config returns nil if the authenticator isn't ready.
 func (a *Authenticator) getOAuth2Config() *oauth2.Config {
-	oauthConfig, _ := a.authFunc()
+	authFunc := a.getAuthFunc()
+	if authFunc == nil {
+		return nil
+	}
+	oauthConfig, _ := authFunc()
 	return oauthConfig
 }
 
+// getLoginMethod returns nil if the authenticator isn't ready.
 func (a *Authenticator) getLoginMethod() loginMethod {
-	_, lm := a.authFunc()
+	authFunc := a.getAuthFunc()
+	if authFunc == nil {
+		return nil
+	}
+	_, lm := authFunc()
 	return lm
 }
 
@@ -2,18 +2,29 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"time"
 
 	oidc "github.com/coreos/go-oidc"
 	"golang.org/x/oauth2"
+	"k8s.io/klog"
 )
 
 type oidcAuth struct {
 	verifier *oidc.IDTokenVerifier
+	// logoutVerifier verifies back-channel logout tokens, which need not expire.
+	logoutVerifier *oidc.IDTokenVerifier
+
+	// endSessionEndpoint is the provider's RP-initiated logout endpoint, if any.
+	// https://openid.net/specs/openid-connect-rpinitiated-1_0.html
+	endSessionEndpoint    string
+	clientID              string
+	postLogoutRedirectURL string
 
 	// This preserves the old logic of associating users with session keys
 	// and requires smart routing when running multiple backend instances.
@@ -21,6 +32,13 @@ type oidcAuth struct {
 
 	cookiePath    string
 	secureCookies bool
+
+	claimMapping  ClaimMapping
+	allowedGroups []string
+
+	issuerURL string
+	// logouts shares back-channel logouts with the other console replicas.
+	logouts LogoutStore
 }
 
 type oidcConfig struct {
@@ -29,8 +47,21 @@ type oidcConfig struct {
 	clientID      string
 	cookiePath    string
 	secureCookies bool
+	sessions      *SessionStore
+	claimMapping  ClaimMapping
+	allowedGroups []string
+	// postLogoutRedirectURL is where the provider sends users after logout.
+	postLogoutRedirectURL string
+	logouts               LogoutStore
 }
 
+// backChannelLogoutEvent is the event a logout token must carry.
+const backChannelLogoutEvent = "http://schemas.openid.net/event/backchannel-logout"
+
+// errAccessDenied is returned for users who authenticated successfully but
+// aren't allowed to use the console.
+var errAccessDenied = errors.New("access denied")
+
 func newOIDCAuth(ctx context.Context, c *oidcConfig) (oauth2.Endpoint, *oidcAuth, error) {
 	ctx = oidc.ClientContext(ctx, c.client)
 	p, err := oidc.NewProvider(ctx, c.issuerURL)
@@ -38,17 +69,78 @@ func newOIDCAuth(ctx context.Context, c *oidcConfig) (oauth2.Endpoint, *oidcAuth
 		return oauth2.Endpoint{}, nil, err
 	}
 
+	var metadata struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}
+	if err := p.Claims(&metadata); err != nil {
+		return oauth2.Endpoint{}, nil, err
+	}
+
 	return p.Endpoint(), &oidcAuth{
 		verifier: p.Verifier(&oidc.Config{
 			ClientID: c.clientID,
 		}),
-		sessions:      NewSessionStore(32768),
-		cookiePath:    c.cookiePath,
-		secureCookies: c.secureCookies,
+		logoutVerifier: p.Verifier(&oidc.Config{
+			ClientID:        c.clientID,
+			SkipExpiryCheck: true,
+		}),
+		endSessionEndpoint:    metadata.EndSessionEndpoint,
+		clientID:              c.clientID,
+		postLogoutRedirectURL: c.postLogoutRedirectURL,
+		sessions:              c.sessions,
+		cookiePath:            c.cookiePath,
+		secureCookies:         c.secureCookies,
+		claimMapping:          c.claimMapping,
+		allowedGroups:         c.allowedGroups,
+		issuerURL:             c.issuerURL,
+		logouts:               c.logouts,
 	}, nil
 }
 
-func (o *oidcAuth) login(w http.ResponseWriter, token *oauth2.Token) (*loginState, error) {
+func (o *oidcAuth) login(w http.ResponseWriter, token *oauth2.Token, nonce string) (*loginState, error) {
+	ls, err := o.verifyToken(token, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.sessions.addSession(ls); err != nil {
+		return nil, err
+	}
+	o.setSessionCookie(w, ls)
+
+	o.sessions.pruneSessions()
+	return ls, nil
+}
+
+func (o *oidcAuth) refresh(w http.ResponseWriter, current *loginState, token *oauth2.Token) (*loginState, error) {
+	var ls *loginState
+	if _, ok := token.Extra("id_token").(string); ok {
+		var err error
+		ls, err = o.verifyToken(token, "")
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Refresh responses need not carry an ID token (OIDC Core 12.2), in
+		// which case the user is still who the session says.
+		refreshed := *current
+		ls = &refreshed
+		ls.rawToken = token.AccessToken
+		ls.refreshToken = token.RefreshToken
+		if !token.Expiry.IsZero() {
+			ls.exp = token.Expiry
+		}
+	}
+	// Keep the session token so the browser cookie stays valid.
+	ls.sessionToken = current.sessionToken
+	o.sessions.replaceSession(current.sessionToken, ls)
+	o.setSessionCookie(w, ls)
+	return ls, nil
+}
+
+// verifyToken verifies the ID token contained in an OAuth2 token response
+// and turns it into a new login state. If nonce is not empty, the ID token
+// must carry the same nonce.
+func (o *oidcAuth) verifyToken(token *oauth2.Token, nonce string) (*loginState, error) {
 	rawIDToken, ok := token.Extra("id_token").(string)
 	if !ok {
 		return nil, errors.New("token response did not have an id_token field")
@@ -58,18 +150,26 @@ func (o *oidcAuth) login(w http.ResponseWriter, token *oauth2.Token) (*loginStat
 	if err != nil {
 		return nil, err
 	}
+	if nonce != "" && subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonce)) != 1 {
+		return nil, errors.New("id_token nonce does not match the nonce of the login request")
+	}
 	var c json.RawMessage
 	if err := idToken.Claims(&c); err != nil {
 		return nil, fmt.Errorf("parsing claims: %v", err)
 	}
-	ls, err := newLoginState(rawIDToken, []byte(c))
+	ls, err := newLoginState(rawIDToken, []byte(c), o.claimMapping)
 	if err != nil {
 		return nil, err
 	}
-	if err := o.sessions.addSession(ls); err != nil {
-		return nil, err
+	// Checked on refresh too, so removing a user from the groups ends their session.
+	if len(o.allowedGroups) > 0 && !ls.inAnyGroup(o.allowedGroups) {
+		return nil, fmt.Errorf("%w: user %q is not a member of an allowed group", errAccessDenied, ls.Username)
 	}
+	ls.refreshToken = token.RefreshToken
+	return ls, nil
+}
 
+func (o *oidcAuth) setSessionCookie(w http.ResponseWriter, ls *loginState) {
 	cookie := http.Cookie{
 		Name:     openshiftAccessTokenCookieName,
 		Value:    ls.sessionToken,
@@ -79,14 +179,14 @@ func (o *oidcAuth) login(w http.ResponseWriter, token *oauth2.Token) (*loginStat
 		Secure:   o.secureCookies,
 	}
 	http.SetCookie(w, &cookie)
-
-	o.sessions.pruneSessions()
-	return ls, nil
 }
 
-func (o *oidcAuth) logout(w http.ResponseWriter, r *http.Request) {
+// logout deletes the session and its cookie. If the provider supports
+// RP-initiated logout, it returns the URL to end the provider session at.
+func (o *oidcAuth) logout(w http.ResponseWriter, r *http.Request) string {
 	// The returned login state can be nil even if err == nil.
-	if ls, _ := o.getLoginState(r); ls != nil {
+	ls, _ := o.getLoginState(r)
+	if ls != nil {
 		o.sessions.deleteSession(ls.sessionToken)
 	}
 	// Delete session cookie
@@ -99,7 +199,80 @@ func (o *oidcAuth) logout(w http.ResponseWriter, r *http.Request) {
 		Secure:   o.secureCookies,
 	}
 	http.SetCookie(w, &cookie)
-	w.WriteHeader(http.StatusNoContent)
+
+	if ls == nil || o.endSessionEndpoint == "" {
+		return ""
+	}
+	endSessionURL, err := o.endSessionURL(ls)
+	if err != nil {
+		klog.Errorf("failed to build end session URL: %v", err)
+		return ""
+	}
+	return endSessionURL
+}
+
+func (o *oidcAuth) endSessionURL(ls *loginState) (string, error) {
+	u, err := url.Parse(o.endSessionEndpoint)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	q.Set("id_token_hint", ls.rawToken)
+	q.Set("client_id", o.clientID)
+	if o.postLogoutRedirectURL != "" {
+		q.Set("post_logout_redirect_uri", o.postLogoutRedirectURL)
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// backChannelLogout validates a logout token sent by the provider and deletes
+// the sessions it refers to.
+// https://openid.net/specs/openid-connect-backchannel-1_0.html#Validation
+func (o *oidcAuth) backChannelLogout(ctx context.Context, rawLogoutToken string) error {
+	token, err := o.logoutVerifier.Verify(ctx, rawLogoutToken)
+	if err != nil {
+		return err
+	}
+	var claims struct {
+		TokenID   string                     `json:"jti"`
+		SessionID string                     `json:"sid"`
+		Events    map[string]json.RawMessage `json:"events"`
+		Nonce     *string                    `json:"nonce"`
+	}
+	if err := token.Claims(&claims); err != nil {
+		return fmt.Errorf("parsing claims: %v", err)
+	}
+	if _, ok := claims.Events[backChannelLogoutEvent]; !ok {
+		return fmt.Errorf("logout token is missing the %s event", backChannelLogoutEvent)
+	}
+	// A nonce would mean an ID token is being passed off as logout token.
+	if claims.Nonce != nil {
+		return errors.New("logout token must not contain a nonce")
+	}
+	if token.Subject == "" && claims.SessionID == "" {
+		return errors.New("logout token must contain a sub or sid claim")
+	}
+	if claims.TokenID == "" {
+		return errors.New("logout token must contain a jti claim")
+	}
+	if !token.Expiry.IsZero() && token.Expiry.Before(time.Now()) {
+		return errors.New("logout token is expired")
+	}
+
+	// The other console replicas apply the logout from the store.
+	marker := &LogoutMarker{
+		Issuer:    o.issuerURL,
+		Subject:   token.Subject,
+		SessionID: claims.SessionID,
+		Received:  time.Now(),
+	}
+	if err := o.logouts.Add(ctx, claims.TokenID, marker); err != nil {
+		return err
+	}
+	deleted := o.sessions.deleteSessionsMatching(marker.matches)
+	klog.V(4).Infof("back-channel logout deleted %d sessions", len(deleted))
+	return nil
 }
 
 func (o *oidcAuth) getLoginState(r *http.Request) (*loginState, error) {
@@ -112,7 +285,7 @@ func (o *oidcAuth) getLoginState(r *http.Request) (*loginState, error) {
 	if ls == nil {
 		return nil, fmt.Errorf("No session found on server")
 	}
-	if ls.exp.Sub(ls.now()) < 0 {
+	if ls.isExpired() {
 		o.sessions.deleteSession(sessionToken)
 		return nil, fmt.Errorf("Session is expired.")
 	}
@@ -125,11 +298,12 @@ func (o *oidcAuth) authenticate(r *http.Request) (*User, error) {
 		return nil, err
 	}
 
-	return &User{
-		ID:       ls.UserID,
-		Username: ls.Name,
-		Token:    ls.rawToken,
-	}, nil
+	return ls.toUser(), nil
+}
+
+// revokeToken is a no-op, ID tokens can't be revoked.
+func (o *oidcAuth) revokeToken(ctx context.Context, token string) error {
+	return nil
 }
 
 func (o *oidcAuth) getSpecialURLs() SpecialAuthURLs {
@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// signingOIDCProvider is a test provider that signs tokens and supports
+// RP-initiated logout.
+type signingOIDCProvider struct {
+	issuer string
+	key    *rsa.PrivateKey
+	// refreshIDToken is the ID token returned by the token endpoint.
+	refreshIDToken string
+}
+
+func (m *signingOIDCProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/.well-known/openid-configuration":
+		fmt.Fprintf(w, `{
+ "issuer": "%s",
+ "authorization_endpoint": "%s/auth",
+ "token_endpoint": "%s/token",
+ "jwks_uri": "%s/keys",
+ "end_session_endpoint": "%s/logout"
+}`, m.issuer, m.issuer, m.issuer, m.issuer, m.issuer)
+	case "/token":
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "new-access-token",
+			"token_type":    "Bearer",
+			"refresh_token": "new-refresh-token",
+			"expires_in":    3600,
+			"id_token":      m.refreshIDToken,
+		})
+	case "/keys":
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &m.key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+		}})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *signingOIDCProvider) sign(t *testing.T, claims map[string]interface{}) string {
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: m.key}, (&jose.SignerOptions{}).WithHeader("kid", "test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := signer.Sign(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := signed.CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func newTestOIDCAuth(t *testing.T) (*signingOIDCProvider, *oidcAuth, func()) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &signingOIDCProvider{key: key}
+	s := httptest.NewServer(p)
+	p.issuer = s.URL
+
+	_, o, err := newOIDCAuth(context.Background(), &oidcConfig{
+		client:                s.Client(),
+		issuerURL:             p.issuer,
+		clientID:              "console",
+		cookiePath:            "/",
+		sessions:              NewSessionStore(32),
+		postLogoutRedirectURL: "https://console.example.com/",
+		logouts:               newMemoryLogoutStore(),
+	})
+	if err != nil {
+		s.Close()
+		t.Fatal(err)
+	}
+	return p, o, s.Close
+}
+
+func (m *signingOIDCProvider) addSession(t *testing.T, o *oidcAuth, sub, sid string) *loginState {
+	rawIDToken := m.sign(t, map[string]interface{}{
+		"iss": m.issuer,
+		"aud": "console",
+		"sub": sub,
+		"sid": sid,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token := (&oauth2.Token{AccessToken: "access-token"}).WithExtra(map[string]interface{}{"id_token": rawIDToken})
+	ls, err := o.verifyToken(token, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.sessions.addSession(ls); err != nil {
+		t.Fatal(err)
+	}
+	return ls
+}
+
+func TestOIDCRefreshWithoutIDToken(t *testing.T) {
+	p, o, closeProvider := newTestOIDCAuth(t)
+	defer closeProvider()
+	current := p.addSession(t, o, "alice", "")
+
+	expiry := time.Now().Add(2 * time.Hour)
+	refreshed, err := o.refresh(httptest.NewRecorder(), current, &oauth2.Token{
+		AccessToken:  "new-access-token",
+		RefreshToken: "new-refresh-token",
+		Expiry:       expiry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Username != "alice" || refreshed.sessionToken != current.sessionToken {
+		t.Errorf("expected the session of alice to be kept, got user %q", refreshed.Username)
+	}
+	if refreshed.rawToken != "new-access-token" || refreshed.refreshToken != "new-refresh-token" || !refreshed.exp.Equal(expiry) {
+		t.Errorf("expected the new tokens to be used, got %q, %q, %v", refreshed.rawToken, refreshed.refreshToken, refreshed.exp)
+	}
+	if o.sessions.getSession(current.sessionToken) != refreshed {
+		t.Error("expected the refreshed session to replace the current one")
+	}
+}
+
+func TestOIDCRefreshDeniedEndsSession(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &signingOIDCProvider{key: key}
+	s := httptest.NewServer(p)
+	defer s.Close()
+	p.issuer = s.URL
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a, err := NewAuthenticator(ctx, &Config{
+		ClientID:      "console",
+		ClientSecret:  "fake-secret",
+		RedirectURL:   "http://example.com/callback",
+		IssuerURL:     p.issuer,
+		CookiePath:    "/",
+		RefererPath:   "http://auth.example.com/",
+		AllowedGroups: []string{"admins"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idToken := func(groups ...string) string {
+		return p.sign(t, map[string]interface{}{
+			"iss":    p.issuer,
+			"aud":    "console",
+			"sub":    "alice",
+			"groups": groups,
+			"exp":    time.Now().Add(time.Minute).Unix(),
+		})
+	}
+	_, lm := a.authFunc()
+	ls, err := lm.login(httptest.NewRecorder(), (&oauth2.Token{
+		AccessToken:  "access-token",
+		RefreshToken: "refresh-token",
+	}).WithExtra(map[string]interface{}{"id_token": idToken("admins")}), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice was removed from the admins group since she logged in.
+	p.refreshIDToken = idToken("developers")
+	req := httptest.NewRequest("GET", "http://example.com/api/kubernetes/", nil)
+	req.AddCookie(&http.Cookie{Name: a.sessionCookieName, Value: ls.sessionToken})
+	rr := httptest.NewRecorder()
+	if _, err := a.Authenticate(rr, req); err == nil {
+		t.Fatal("expected the refresh of a user outside the allowed groups to fail")
+	}
+	if a.sessions.getSession(ls.sessionToken) != nil {
+		t.Error("expected the session to be deleted")
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) == 0 || cookies[0].Name != a.sessionCookieName || cookies[0].MaxAge >= 0 {
+		t.Errorf("expected the session cookie to be cleared, got %v", cookies)
+	}
+}
+
+func TestOIDCLogout(t *testing.T) {
+	p, o, closeProvider := newTestOIDCAuth(t)
+	defer closeProvider()
+
+	ls := p.addSession(t, o, "user-id", "session-1")
+
+	r := httptest.NewRequest("POST", "/auth/logout", nil)
+	r.AddCookie(&http.Cookie{Name: openshiftAccessTokenCookieName, Value: ls.sessionToken})
+	endSessionURL := o.logout(httptest.NewRecorder(), r)
+
+	if o.sessions.getSession(ls.sessionToken) != nil {
+		t.Error("expected the session to be deleted")
+	}
+	u, err := url.Parse(endSessionURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/logout" || u.Query().Get("id_token_hint") != ls.rawToken || u.Query().Get("post_logout_redirect_uri") != "https://console.example.com/" {
+		t.Errorf("unexpected end session URL: %s", endSessionURL)
+	}
+}
+
+func TestOIDCBackChannelLogout(t *testing.T) {
+	p, o, closeProvider := newTestOIDCAuth(t)
+	defer closeProvider()
+
+	tokenIDs := 0
+	logoutToken := func(claims map[string]interface{}) string {
+		tokenIDs++
+		base := map[string]interface{}{
+			"iss":    p.issuer,
+			"aud":    "console",
+			"iat":    time.Now().Unix(),
+			"jti":    fmt.Sprintf("logout-token-%d", tokenIDs),
+			"events": map[string]interface{}{backChannelLogoutEvent: map[string]interface{}{}},
+		}
+		for k, v := range claims {
+			base[k] = v
+		}
+		return p.sign(t, base)
+	}
+
+	first := p.addSession(t, o, "user-id", "session-1")
+	second := p.addSession(t, o, "user-id", "session-2")
+	other := p.addSession(t, o, "other-user-id", "session-3")
+
+	invalid := []string{
+		logoutToken(map[string]interface{}{"sub": "user-id", "nonce": "abc"}),
+		logoutToken(map[string]interface{}{"sub": "user-id", "events": map[string]interface{}{}}),
+		logoutToken(map[string]interface{}{}),
+		logoutToken(map[string]interface{}{"sub": "user-id", "jti": ""}),
+		"not-a-jwt",
+	}
+	for _, token := range invalid {
+		if err := o.backChannelLogout(context.Background(), token); err == nil {
+			t.Errorf("expected logout token %q to be rejected", token)
+		}
+	}
+
+	sidLogout := logoutToken(map[string]interface{}{"sid": "session-1"})
+	if err := o.backChannelLogout(context.Background(), sidLogout); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if o.sessions.getSession(first.sessionToken) != nil || o.sessions.getSession(second.sessionToken) == nil {
+		t.Error("expected only the session with the matching sid to be deleted")
+	}
+	if err := o.backChannelLogout(context.Background(), sidLogout); err == nil {
+		t.Error("expected a replayed logout token to be rejected")
+	}
+
+	if err := o.backChannelLogout(context.Background(), logoutToken(map[string]interface{}{"sub": "user-id"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if o.sessions.getSession(second.sessionToken) != nil || o.sessions.getSession(other.sessionToken) == nil {
+		t.Error("expected only the sessions of the matching sub to be deleted")
+	}
+
+	// Another replica sharing the logouts ends its own sessions of the user,
+	// but not the ones created after the logout.
+	replica := *o
+	replica.sessions = NewSessionStore(32)
+	before := p.addSession(t, &replica, "user-id", "session-4")
+	if err := o.backChannelLogout(context.Background(), logoutToken(map[string]interface{}{"sub": "user-id"})); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	after := p.addSession(t, &replica, "user-id", "session-5")
+	replica.applyLogouts(context.Background())
+	if replica.sessions.getSession(before.sessionToken) != nil {
+		t.Error("expected the logout to end the session on the other replica")
+	}
+	if replica.sessions.getSession(after.sessionToken) == nil {
+		t.Error("expected the logout not to end sessions created after it")
+	}
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -11,10 +13,14 @@ import (
 
 	"golang.org/x/oauth2"
 
+	"k8s.io/klog"
+
 	"github.com/openshift/console/pkg/proxy"
 	"github.com/openshift/console/pkg/serverutils"
 )
 
+const sha256Prefix = "sha256~"
+
 // openShiftAuth implements OpenShift Authentication as defined in:
 // https://access.redhat.com/documentation/en-us/openshift_container_platform/4.9/html/authentication_and_authorization/understanding-authentication
 type openShiftAuth struct {
@@ -22,6 +28,14 @@ type openShiftAuth struct {
 	secureCookies bool
 	specialURLs   SpecialAuthURLs
 	clusterName   string
+	// sessions holds the login state of users, including refresh tokens if their
+	// token response included one. The access token cookie remains the source of
+	// truth for authentication, so a backend instance without the session simply
+	// won't refresh the token or list the session.
+	sessions *SessionStore
+	// k8sClient and k8sURL are used to delete OAuthAccessTokens from the API server.
+	k8sClient *http.Client
+	k8sURL    string
 }
 
 type openShiftConfig struct {
@@ -31,6 +45,7 @@ type openShiftConfig struct {
 	cookiePath    string
 	secureCookies bool
 	clusterName   string
+	sessions      *SessionStore
 }
 
 func validateAbsURL(value string) error {
@@ -103,8 +118,8 @@ func newOpenShiftAuth(ctx context.Context, c *openShiftConfig) (oauth2.Endpoint,
 	}
 	defer resp.Body.Close()
 
-	// Special page on the integrated OAuth server for requesting a token.
-	// TODO: We will need to implement this directly console to support external OAuth servers.
+	// Special page on the integrated OAuth server for requesting a token. With
+	// external OAuth servers, configure a token request client instead.
 	requestTokenURL := proxy.SingleJoiningSlash(metadata.Token, "/request")
 	kubeAdminLogoutURL := proxy.SingleJoiningSlash(metadata.Issuer, "/logout")
 	return oauth2.Endpoint{
@@ -118,22 +133,38 @@ func newOpenShiftAuth(ctx context.Context, c *openShiftConfig) (oauth2.Endpoint,
 				kubeAdminLogoutURL,
 			},
 			c.clusterName,
+			c.sessions,
+			c.k8sClient,
+			c.issuerURL,
 		}, nil
 }
 
-func (o *openShiftAuth) login(w http.ResponseWriter, token *oauth2.Token) (*loginState, error) {
+func (o *openShiftAuth) login(w http.ResponseWriter, token *oauth2.Token, _ string) (*loginState, error) {
 	if token.AccessToken == "" {
 		return nil, fmt.Errorf("token response did not contain an access token %#v", token)
 	}
 	ls := &loginState{
-		// Not clear if there's another way to fill in information like the user's name.
-		rawToken: token.AccessToken,
+		rawToken:     token.AccessToken,
+		refreshToken: token.RefreshToken,
+		now:          defaultNow,
+	}
+	// The username identifies the user's sessions in the session management API.
+	if err := o.getUser(context.TODO(), ls); err != nil {
+		klog.Errorf("failed to get the user of the new session: %v", err)
 	}
 
 	expiresIn := (time.Hour * 24).Seconds()
 	if !token.Expiry.IsZero() {
 		expiresIn = token.Expiry.Sub(time.Now()).Seconds()
 	}
+	ls.exp = time.Now().Add(time.Duration(expiresIn) * time.Second)
+
+	// Keep server-side state for refreshing the token and listing the session.
+	if o.sessions != nil {
+		ls.sessionToken = ls.rawToken
+		o.sessions.storeSession(ls)
+		o.sessions.pruneSessions()
+	}
 
 	// NOTE: In Tectonic, we previously had issues with tokens being bigger than
 	// cookies can handle. Since OpenShift doesn't store groups in the token, the
@@ -157,9 +188,28 @@ func (o *openShiftAuth) login(w http.ResponseWriter, token *oauth2.Token) (*logi
 	return ls, nil
 }
 
-func (o *openShiftAuth) logout(w http.ResponseWriter, r *http.Request) {
+func (o *openShiftAuth) refresh(w http.ResponseWriter, current *loginState, token *oauth2.Token) (*loginState, error) {
+	ls, err := o.login(w, token, "")
+	if err != nil {
+		return nil, err
+	}
+	// The session is keyed by the access token, which changed.
+	if ls.sessionToken != current.sessionToken {
+		o.sessions.deleteSession(current.sessionToken)
+	}
+	return ls, nil
+}
+
+func (o *openShiftAuth) logout(w http.ResponseWriter, r *http.Request) string {
 	// NOTE: cookies are going away, this should be removed in the future
 
+	// Forget the refresh token, if we have one.
+	if cookie, err := r.Cookie(GetCookieName(o.clusterName)); err == nil && o.sessions != nil {
+		if o.sessions.getSession(cookie.Value) != nil {
+			o.sessions.deleteSession(cookie.Value)
+		}
+	}
+
 	// Delete session cookie
 	cookie := http.Cookie{
 		Name:     GetCookieName(o.clusterName),
@@ -170,7 +220,74 @@ func (o *openShiftAuth) logout(w http.ResponseWriter, r *http.Request) {
 		Secure:   o.secureCookies,
 	}
 	http.SetCookie(w, &cookie)
-	w.WriteHeader(http.StatusNoContent)
+	return ""
+}
+
+// getUser fills in the name and UID of the user the login state's token belongs to.
+func (o *openShiftAuth) getUser(ctx context.Context, ls *loginState) error {
+	req, err := http.NewRequest(http.MethodGet, proxy.SingleJoiningSlash(o.k8sURL, "/apis/user.openshift.io/v1/users/~"), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ls.rawToken))
+
+	resp, err := o.k8sClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get the current user: %s", resp.Status)
+	}
+	var user struct {
+		Metadata struct {
+			Name string `json:"name"`
+			UID  string `json:"uid"`
+		} `json:"metadata"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return fmt.Errorf("failed to decode the current user: %v", err)
+	}
+	ls.Username = user.Metadata.Name
+	ls.UserID = user.Metadata.UID
+	return nil
+}
+
+// revokeToken deletes the OAuthAccessToken backing token from the API server,
+// authenticating as the token's owner.
+func (o *openShiftAuth) revokeToken(ctx context.Context, token string) error {
+	tokenName := token
+	if strings.HasPrefix(tokenName, sha256Prefix) {
+		tokenName = TokenToObjectName(tokenName)
+	}
+
+	path := "/apis/oauth.openshift.io/v1/oauthaccesstokens/" + tokenName
+	req, err := http.NewRequest(http.MethodDelete, proxy.SingleJoiningSlash(o.k8sURL, path), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create token DELETE request: %v", err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	resp, err := o.k8sClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	// The token is already gone if the API server doesn't accept it anymore.
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound && resp.StatusCode != http.StatusUnauthorized {
+		return fmt.Errorf("failed to delete token: %s", resp.Status)
+	}
+	return nil
+}
+
+// TokenToObjectName returns the oauthaccesstokens object name for the given raw token,
+// i.e. the sha256 hash prefixed with "sha256~".
+func TokenToObjectName(token string) string {
+	name := strings.TrimPrefix(token, sha256Prefix)
+	h := sha256.Sum256([]byte(name))
+	return sha256Prefix + base64.RawURLEncoding.EncodeToString(h[0:])
 }
 
 func getOpenShiftUser(r *http.Request) (*User, error) {
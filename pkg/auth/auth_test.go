@@ -6,7 +6,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
 )
 
 // mockOpenShiftProvider is test OpenShift provider that only supports discovery
@@ -98,6 +102,36 @@ func TestNewAuthenticator(t *testing.T) {
 	if got != p.issuer+"/auth" {
 		t.Errorf("redirect didn't go to %s/auth, got %s", p.issuer+"/auth", u)
 	}
+
+	flow, err := a.getLoginFlow(&http.Request{Header: http.Header{"Cookie": rr.HeaderMap["Set-Cookie"]}}, stateCookieName)
+	if err != nil {
+		t.Fatalf("failed to read login flow cookie: %v", err)
+	}
+	q := u.Query()
+	if q.Get("state") != flow.State || len(flow.State) < 43 {
+		t.Errorf("expected a state of at least 32 bytes matching the cookie, got %q", q.Get("state"))
+	}
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		t.Errorf("expected an S256 PKCE code challenge, got %q", u.RawQuery)
+	}
+	if q.Get("nonce") == "" || q.Get("nonce") != flow.Nonce {
+		t.Errorf("expected nonce %q, got %q", flow.Nonce, q.Get("nonce"))
+	}
+	cookie := rr.Result().Cookies()[0]
+	if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("expected an HttpOnly, Secure, SameSite=Lax state cookie, got %v", cookie)
+	}
+
+	// A callback whose state doesn't match the cookie must be rejected.
+	callback := httptest.NewRequest("GET", "http://example.com/callback?code=code&state=wrong", nil)
+	callback.AddCookie(cookie)
+	rr = httptest.NewRecorder()
+	a.CallbackFunc(func(LoginJSON, string, http.ResponseWriter) {
+		t.Error("callback with invalid state should not log the user in")
+	})(rr, callback)
+	if loc := rr.HeaderMap.Get("Location"); !strings.Contains(loc, "error="+errorInvalidState) {
+		t.Errorf("expected redirect to the invalid state error, got %q", loc)
+	}
 }
 
 func TestNewOpenShiftAuthenticator(t *testing.T) {
@@ -311,3 +345,219 @@ func TestCSRF(t *testing.T) {
 	testCSRF(t, "", "b", false)
 	testCSRF(t, "", "", false)
 }
+
+func TestRefreshOpenShiftSession(t *testing.T) {
+	p := &mockOpenShiftProvider{}
+
+	var refreshRequests int
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/token" {
+			p.handleDiscovery(w, r)
+			return
+		}
+		refreshRequests++
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("failed to parse token request: %v", err)
+		}
+		if got := r.PostForm.Get("refresh_token"); got != "refresh-token" {
+			t.Errorf("unexpected refresh token, want: %q, got: %q", "refresh-token", got)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "new-access-token", "token_type": "Bearer", "expires_in": 3600}`)
+	}))
+	defer s.Close()
+	p.issuer = s.URL
+
+	ccfg := &Config{
+		AuthSource:   AuthSourceOpenShift,
+		ClientID:     "fake-client-id",
+		ClientSecret: "fake-secret",
+		RedirectURL:  "http://example.com/callback",
+		IssuerURL:    p.issuer,
+		CookiePath:   "/",
+		RefererPath:  "http://auth.example.com/",
+		ClusterName:  "local-cluster",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	a, err := NewAuthenticator(ctx, ccfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, lm := a.authFunc()
+	_, err = lm.login(httptest.NewRecorder(), &oauth2.Token{
+		AccessToken:  "old-access-token",
+		RefreshToken: "refresh-token",
+		Expiry:       time.Now().Add(time.Minute),
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com/api/kubernetes/", nil)
+	req.AddCookie(&http.Cookie{Name: GetCookieName("local-cluster"), Value: "old-access-token"})
+	rr := httptest.NewRecorder()
+
+	user, err := a.Authenticate(rr, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Token != "new-access-token" {
+		t.Errorf("token was not refreshed, want: %q, got: %q", "new-access-token", user.Token)
+	}
+	if refreshRequests != 1 {
+		t.Errorf("unexpected number of refresh requests, want: 1, got: %d", refreshRequests)
+	}
+
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "new-access-token" {
+		t.Errorf("refreshed session cookie was not set, got: %v", cookies)
+	}
+
+	// The refreshed token isn't due for another refresh.
+	req = httptest.NewRequest("GET", "http://example.com/api/kubernetes/", nil)
+	req.AddCookie(&http.Cookie{Name: GetCookieName("local-cluster"), Value: "new-access-token"})
+	if _, err := a.Authenticate(httptest.NewRecorder(), req); err != nil {
+		t.Fatal(err)
+	}
+	if refreshRequests != 1 {
+		t.Errorf("unexpected number of refresh requests, want: 1, got: %d", refreshRequests)
+	}
+}
+
+func TestLogoutOpenShift(t *testing.T) {
+	p := &mockOpenShiftProvider{}
+
+	var deleted []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const tokensPath = "/apis/oauth.openshift.io/v1/oauthaccesstokens/"
+		if !strings.HasPrefix(r.URL.Path, tokensPath) {
+			p.handleDiscovery(w, r)
+			return
+		}
+		if r.Method != http.MethodDelete {
+			t.Errorf("unexpected method %s", r.Method)
+		}
+		// The token must be deleted with the user's own credentials.
+		if got := r.Header.Get("Authorization"); got != "Bearer sha256~access-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		deleted = append(deleted, strings.TrimPrefix(r.URL.Path, tokensPath))
+	}))
+	defer s.Close()
+	p.issuer = s.URL
+
+	a, err := NewAuthenticator(context.Background(), &Config{
+		AuthSource:   AuthSourceOpenShift,
+		ClientID:     "fake-client-id",
+		ClientSecret: "fake-secret",
+		RedirectURL:  "http://example.com/callback",
+		IssuerURL:    p.issuer,
+		CookiePath:   "/",
+		RefererPath:  "http://auth.example.com/",
+		ClusterName:  "local-cluster",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("POST", "http://example.com/auth/logout", nil)
+	if a.HasSession(req) {
+		t.Error("request without a cookie should have no session")
+	}
+	req.AddCookie(&http.Cookie{Name: GetCookieName("local-cluster"), Value: "sha256~access-token"})
+	if !a.HasSession(req) {
+		t.Error("request with a cookie should have a session")
+	}
+
+	rr := httptest.NewRecorder()
+	result := a.Logout(rr, req)
+	if !result.TokenRevoked || result.Error != "" || result.Cluster != "local-cluster" {
+		t.Errorf("unexpected logout result: %#v", result)
+	}
+	if len(deleted) != 1 || deleted[0] != TokenToObjectName("sha256~access-token") {
+		t.Errorf("expected the access token object to be deleted, got %v", deleted)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != "" {
+		t.Errorf("expected the session cookie to be cleared, got %v", cookies)
+	}
+}
+
+func TestStartAuthenticator(t *testing.T) {
+	p := &mockOpenShiftProvider{}
+	available := false
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		p.handleDiscovery(w, r)
+	}))
+	defer s.Close()
+	p.issuer = s.URL
+
+	c := &Config{
+		AuthSource:   AuthSourceOpenShift,
+		ClientID:     "fake-client-id",
+		ClientSecret: "fake-secret",
+		RedirectURL:  "http://example.com/callback",
+		IssuerURL:    p.issuer,
+		ErrorURL:     "https://console.example.com/error",
+		CookiePath:   "/",
+		RefererPath:  "http://auth.example.com/",
+		ClusterName:  "managed-cluster",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	started, err := StartAuthenticator(ctx, c)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if started.Status().Cluster != "managed-cluster" || started.Healthy() == nil {
+		t.Errorf("expected the authenticator not to be ready, got %#v", started.Status())
+	}
+
+	a, err := newUnstartedAuthenticator(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.discover(context.Background(), c); err == nil {
+		t.Fatal("expected discovery to fail")
+	}
+	if status := a.Status(); status.Ready || status.Error == "" || status.LastAttempt.IsZero() {
+		t.Errorf("unexpected status: %#v", status)
+	}
+
+	rr := httptest.NewRecorder()
+	a.LoginFunc(rr, httptest.NewRequest("GET", "/auth/login", nil))
+	if location := rr.Result().Header.Get("Location"); !strings.Contains(location, "error="+errorUnavailable) {
+		t.Errorf("expected login to be unavailable, got redirect to %q", location)
+	}
+
+	// Existing OpenShift sessions keep working without the OAuth server.
+	req := httptest.NewRequest("GET", "http://example.com/api/kubernetes/", nil)
+	req.Header.Set("X-Cluster", "managed-cluster")
+	req.AddCookie(&http.Cookie{Name: GetCookieName("managed-cluster"), Value: "access-token"})
+	if user, err := a.Authenticate(httptest.NewRecorder(), req); err != nil || user.Token != "access-token" {
+		t.Errorf("expected the session to be authenticated, got %v, %v", user, err)
+	}
+
+	available = true
+	if err := a.discover(context.Background(), c); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := a.Healthy(); err != nil {
+		t.Errorf("expected the authenticator to be ready: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	a.LoginFunc(rr, httptest.NewRequest("GET", "/auth/login", nil))
+	if location := rr.Result().Header.Get("Location"); !strings.HasPrefix(location, p.issuer+"/auth") {
+		t.Errorf("expected a redirect to the OAuth server, got %q", location)
+	}
+}
@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"golang.org/x/oauth2"
+)
+
+const (
+	// loginFlowEntropy is the number of random bytes used for the state,
+	// PKCE code verifier and nonce of an authorization code flow.
+	loginFlowEntropy = 32
+	// loginFlowMaxAge bounds how long a user can take to complete a login.
+	loginFlowMaxAge = 10 * 60
+)
+
+// loginFlow holds the secrets of a single authorization code flow. It is kept
+// in an HttpOnly cookie between the redirect to the identity provider and the
+// callback, so any backend instance can complete the flow.
+type loginFlow struct {
+	State        string `json:"state"`
+	CodeVerifier string `json:"codeVerifier"`
+	Nonce        string `json:"nonce,omitempty"`
+	// Then is the page the user is returned to after login.
+	Then string `json:"then,omitempty"`
+	// Kubeconfig tells whether a token request ends with a kubeconfig file
+	// instead of the token page.
+	Kubeconfig bool `json:"kubeconfig,omitempty"`
+	// KubeconfigChain identifies the kubeconfig file with a context for every
+	// cluster the token is requested for, if any.
+	KubeconfigChain string `json:"kubeconfigChain,omitempty"`
+}
+
+func newLoginFlow(withNonce bool) (*loginFlow, error) {
+	var err error
+	f := &loginFlow{}
+	if f.State, err = randomURLSafeString(loginFlowEntropy); err != nil {
+		return nil, err
+	}
+	if f.CodeVerifier, err = randomURLSafeString(loginFlowEntropy); err != nil {
+		return nil, err
+	}
+	if withNonce {
+		if f.Nonce, err = randomURLSafeString(loginFlowEntropy); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// authCodeOptions returns the PKCE and nonce parameters of the authorization request.
+// https://datatracker.ietf.org/doc/html/rfc7636#section-4.3
+func (f *loginFlow) authCodeOptions() []oauth2.AuthCodeOption {
+	challenge := sha256.Sum256([]byte(f.CodeVerifier))
+	opts := []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	}
+	if f.Nonce != "" {
+		opts = append(opts, oauth2.SetAuthURLParam("nonce", f.Nonce))
+	}
+	return opts
+}
+
+// exchangeOptions returns the PKCE parameters of the token request.
+// https://datatracker.ietf.org/doc/html/rfc7636#section-4.5
+func (f *loginFlow) exchangeOptions() []oauth2.AuthCodeOption {
+	return []oauth2.AuthCodeOption{
+		oauth2.SetAuthURLParam("code_verifier", f.CodeVerifier),
+	}
+}
+
+func (f *loginFlow) verifyState(state string) error {
+	if f.State == "" || subtle.ConstantTimeCompare([]byte(f.State), []byte(state)) != 1 {
+		return fmt.Errorf("state in url does not match state cookie")
+	}
+	return nil
+}
+
+// thenURL validates a `then` parameter and resolves it against the success URL.
+// Only paths on the console's own origin and below its base path are accepted, so
+// the login flow can't be used as an open redirect. Auth endpoints are rejected
+// to avoid login loops.
+func thenURL(successURL, then string) (string, error) {
+	base, err := url.Parse(successURL)
+	if err != nil {
+		return "", err
+	}
+	// Browsers treat backslashes like slashes, so "/\evil.com" is protocol-relative.
+	if strings.ContainsAny(then, "\\\x00\r\n\t") || !strings.HasPrefix(then, "/") || strings.HasPrefix(then, "//") {
+		return "", fmt.Errorf("then must be an absolute path: %q", then)
+	}
+	u, err := url.Parse(then)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "" || u.Host != "" || u.User != nil || u.Opaque != "" {
+		return "", fmt.Errorf("then must be a same-origin path: %q", then)
+	}
+	basePath := base.Path
+	if !strings.HasSuffix(basePath, "/") {
+		basePath += "/"
+	}
+	cleaned := path.Clean(u.Path)
+	if cleaned != strings.TrimSuffix(basePath, "/") && !strings.HasPrefix(cleaned+"/", basePath) {
+		return "", fmt.Errorf("then must be below the base path %q: %q", basePath, then)
+	}
+	if strings.HasPrefix(cleaned+"/", basePath+"auth/") {
+		return "", fmt.Errorf("then must not be an auth endpoint: %q", then)
+	}
+	return (&url.URL{
+		Scheme:   base.Scheme,
+		Host:     base.Host,
+		Path:     u.Path,
+		RawQuery: u.RawQuery,
+	}).String(), nil
+}
+
+func (a *Authenticator) setLoginFlowCookie(w http.ResponseWriter, name string, f *loginFlow) error {
+	value, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		MaxAge:   loginFlowMaxAge,
+		HttpOnly: true,
+		Secure:   a.secureCookies,
+		// The callback is a top-level navigation from the identity provider,
+		// which Strict would exclude.
+		SameSite: http.SameSiteLaxMode,
+		// Make sure cookie path matches multi-cluster login paths
+		Path: "/",
+	})
+	return nil
+}
+
+func (a *Authenticator) getLoginFlow(r *http.Request, name string) (*loginFlow, error) {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return nil, err
+	}
+	value, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode state cookie: %v", err)
+	}
+	f := &loginFlow{}
+	if err := json.Unmarshal(value, f); err != nil {
+		return nil, fmt.Errorf("failed to parse state cookie: %v", err)
+	}
+	return f, nil
+}
+
+func (a *Authenticator) clearLoginFlowCookie(w http.ResponseWriter, name string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    "",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   a.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+		Path:     "/",
+	})
+}
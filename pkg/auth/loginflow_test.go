@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestThenURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		successURL string
+		then       string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "page below the root",
+			successURL: "https://console.example.com/",
+			then:       "/k8s/ns/default/pods?rowFilter=running",
+			want:       "https://console.example.com/k8s/ns/default/pods?rowFilter=running",
+		},
+		{
+			name:       "page below the base path",
+			successURL: "https://example.com/console/",
+			then:       "/console/monitoring/alerts",
+			want:       "https://example.com/console/monitoring/alerts",
+		},
+		{
+			name:       "managed cluster page",
+			successURL: "https://console.example.com/",
+			then:       "/k8s/cluster/projects?cluster=managed",
+			want:       "https://console.example.com/k8s/cluster/projects?cluster=managed",
+		},
+		{
+			name:       "outside of the base path",
+			successURL: "https://example.com/console/",
+			then:       "/other/app",
+			wantErr:    true,
+		},
+		{
+			name:       "dot segments escaping the base path",
+			successURL: "https://example.com/console/",
+			then:       "/console/../other/app",
+			wantErr:    true,
+		},
+		{
+			name:       "absolute URL",
+			successURL: "https://console.example.com/",
+			then:       "https://evil.example.com/",
+			wantErr:    true,
+		},
+		{
+			name:       "protocol-relative URL",
+			successURL: "https://console.example.com/",
+			then:       "//evil.example.com/",
+			wantErr:    true,
+		},
+		{
+			name:       "backslash",
+			successURL: "https://console.example.com/",
+			then:       "/\\evil.example.com/",
+			wantErr:    true,
+		},
+		{
+			name:       "relative path",
+			successURL: "https://console.example.com/",
+			then:       "k8s/ns/default/pods",
+			wantErr:    true,
+		},
+		{
+			name:       "auth endpoint",
+			successURL: "https://console.example.com/",
+			then:       "/auth/login",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := thenURL(tt.successURL, tt.then)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
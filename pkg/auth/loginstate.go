@@ -11,12 +11,20 @@ import (
 // and should be safe to send as a non-http-only cookie.
 type loginState struct {
 	UserID       string
+	Username     string
+	Groups       []string
 	Name         string
 	Email        string
 	exp          time.Time
 	now          nowFunc
 	sessionToken string
 	rawToken     string
+	refreshToken string
+	// sid is the identity provider's session ID, used by back-channel logout.
+	sid string
+	// meta describes the session for the session management API. It is set
+	// when the session is stored and only accessed with the store locked.
+	meta *sessionMeta
 }
 
 type LoginJSON struct {
@@ -26,18 +34,50 @@ type LoginJSON struct {
 	Exp    int64  `json:"exp"`
 }
 
+// ClaimMapping selects the ID token claims that identify a user. The claims
+// and prefixes work like the --oidc-* flags of kube-apiserver, so that
+// usernames and groups match the ones the API server sees.
+type ClaimMapping struct {
+	UsernameClaim    string
+	UsernamePrefix   string
+	GroupsClaim      string
+	GroupsPrefix     string
+	DisplayNameClaim string
+}
+
+// DefaultClaimMapping reads the standard OIDC claims.
+var DefaultClaimMapping = ClaimMapping{
+	UsernameClaim:    "sub",
+	GroupsClaim:      "groups",
+	DisplayNameClaim: "name",
+}
+
+func (m ClaimMapping) withDefaults() ClaimMapping {
+	if m.UsernameClaim == "" {
+		m.UsernameClaim = DefaultClaimMapping.UsernameClaim
+	}
+	if m.GroupsClaim == "" {
+		m.GroupsClaim = DefaultClaimMapping.GroupsClaim
+	}
+	if m.DisplayNameClaim == "" {
+		m.DisplayNameClaim = DefaultClaimMapping.DisplayNameClaim
+	}
+	return m
+}
+
 // newLoginState unpacks a token and generates a new loginState from it.
-func newLoginState(rawToken string, claims []byte) (*loginState, error) {
+func newLoginState(rawToken string, claims []byte, mapping ClaimMapping) (*loginState, error) {
 	ls := &loginState{
 		now:      defaultNow,
 		rawToken: rawToken,
 	}
 
 	var c struct {
-		Subject string   `json:"sub"`
-		Expiry  jsonTime `json:"exp"`
-		Email   string   `json:"email"`
-		Name    string   `json:"name"`
+		Subject       string   `json:"sub"`
+		Expiry        jsonTime `json:"exp"`
+		Email         string   `json:"email"`
+		EmailVerified *bool    `json:"email_verified"`
+		SessionID     string   `json:"sid"`
 	}
 
 	if err := json.Unmarshal(claims, &c); err != nil {
@@ -48,13 +88,94 @@ func newLoginState(rawToken string, claims []byte) (*loginState, error) {
 		return nil, fmt.Errorf("token missing require claim 'sub'")
 	}
 
+	var all map[string]interface{}
+	if err := json.Unmarshal(claims, &all); err != nil {
+		return nil, fmt.Errorf("error getting claims from token: %v", err)
+	}
+
+	mapping = mapping.withDefaults()
+	username, ok := all[mapping.UsernameClaim].(string)
+	if !ok || username == "" {
+		return nil, fmt.Errorf("token missing required claim '%s'", mapping.UsernameClaim)
+	}
+	// Like kube-apiserver, only trust verified email addresses as usernames.
+	if mapping.UsernameClaim == "email" && c.EmailVerified != nil && !*c.EmailVerified {
+		return nil, fmt.Errorf("email %q is not verified", username)
+	}
+
+	groups, err := stringsClaim(all, mapping.GroupsClaim)
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		groups[i] = mapping.GroupsPrefix + groups[i]
+	}
+	name, _ := all[mapping.DisplayNameClaim].(string)
+
 	ls.UserID = c.Subject
+	ls.Username = mapping.UsernamePrefix + username
+	ls.Groups = groups
 	ls.Email = c.Email
 	ls.exp = time.Time(c.Expiry)
-	ls.Name = c.Name
+	ls.Name = name
+	ls.sid = c.SessionID
 	return ls, nil
 }
 
+// stringsClaim reads a claim holding a string or a list of strings.
+func stringsClaim(claims map[string]interface{}, claim string) ([]string, error) {
+	switch v := claims[claim].(type) {
+	case nil:
+		return []string{}, nil
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("claim '%s' must be a string or a list of strings", claim)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("claim '%s' must be a string or a list of strings", claim)
+	}
+}
+
+// inAnyGroup reports whether the login state belongs to one of the groups.
+func (ls *loginState) inAnyGroup(groups []string) bool {
+	for _, allowed := range groups {
+		for _, group := range ls.Groups {
+			if group == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isExpired reports whether the token held by the login state has expired.
+func (ls *loginState) isExpired() bool {
+	return ls.exp.Sub(ls.now()) < 0
+}
+
+// needsRefresh reports whether the login state can be refreshed and expires
+// within the given threshold.
+func (ls *loginState) needsRefresh(threshold time.Duration) bool {
+	return ls.refreshToken != "" && ls.exp.Sub(ls.now()) < threshold
+}
+
+func (ls *loginState) toUser() *User {
+	return &User{
+		ID:       ls.UserID,
+		Username: ls.Username,
+		Groups:   ls.Groups,
+		Token:    ls.rawToken,
+	}
+}
+
 func (ls *loginState) toLoginJSON() LoginJSON {
 	return LoginJSON{
 		UserID: ls.UserID,
@@ -41,7 +41,7 @@ func TestNewLoginState(t *testing.T) {
 	}
 
 	for i, tt := range tests {
-		ls, err := newLoginState(tt.encoded, []byte(tt.claims))
+		ls, err := newLoginState(tt.encoded, []byte(tt.claims), DefaultClaimMapping)
 		if err != nil {
 			if tt.wantErr {
 				continue
@@ -66,3 +66,42 @@ func TestNewLoginState(t *testing.T) {
 		}
 	}
 }
+
+func TestNewLoginStateClaimMapping(t *testing.T) {
+	claims := fmt.Sprintf(`{
+		"sub": "user-id",
+		"preferred_username": "penny",
+		"given_name": "Penny",
+		"email": "penny@example.com",
+		"email_verified": false,
+		"realm_groups": ["admins", "devs"],
+		"exp": %d
+	}`, time.Now().Unix())
+
+	ls, err := newLoginState("rando-token-string", []byte(claims), ClaimMapping{
+		UsernameClaim:    "preferred_username",
+		UsernamePrefix:   "keycloak:",
+		GroupsClaim:      "realm_groups",
+		GroupsPrefix:     "keycloak:",
+		DisplayNameClaim: "given_name",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ls.UserID != "user-id" || ls.Username != "keycloak:penny" || ls.Name != "Penny" {
+		t.Errorf("unexpected user: id %q, username %q, name %q", ls.UserID, ls.Username, ls.Name)
+	}
+	if len(ls.Groups) != 2 || ls.Groups[0] != "keycloak:admins" || ls.Groups[1] != "keycloak:devs" {
+		t.Errorf("unexpected groups: %v", ls.Groups)
+	}
+	if !ls.inAnyGroup([]string{"keycloak:devs"}) || ls.inAnyGroup([]string{"devs"}) {
+		t.Errorf("unexpected group membership for %v", ls.Groups)
+	}
+
+	if _, err := newLoginState("rando-token-string", []byte(claims), ClaimMapping{UsernameClaim: "email"}); err == nil {
+		t.Error("expected an unverified email to be rejected as username")
+	}
+	if _, err := newLoginState("rando-token-string", []byte(claims), ClaimMapping{UsernameClaim: "nickname"}); err == nil {
+		t.Error("expected a missing username claim to be rejected")
+	}
+}
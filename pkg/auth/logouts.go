@@ -0,0 +1,258 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog"
+)
+
+const (
+	// logoutMarkerTTL is how long back-channel logouts are remembered. It
+	// exceeds the lifetime of ID tokens, after which sessions are refreshed with
+	// the identity provider, which refuses to refresh sessions it ended.
+	logoutMarkerTTL = 24 * time.Hour
+	// logoutSyncInterval is how often the logouts received by other console
+	// replicas are applied.
+	logoutSyncInterval = 10 * time.Second
+	// logoutStoreUpdateAttempts bounds the retries of conflicting updates of the
+	// shared logouts.
+	logoutStoreUpdateAttempts = 5
+)
+
+// errLogoutReplayed is returned for logout tokens that were received before.
+var errLogoutReplayed = errors.New("logout token was already received")
+
+// LogoutMarker records a back-channel logout, so that every console replica
+// ends the sessions it refers to.
+type LogoutMarker struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub,omitempty"`
+	SessionID string `json:"sid,omitempty"`
+	// Received is when the logout was received. Sessions created later, like
+	// the next login of the user, aren't ended.
+	Received time.Time `json:"received"`
+}
+
+// matches tells whether the marker ends the session. It must be called with
+// the session store locked.
+func (m *LogoutMarker) matches(ls *loginState) bool {
+	if m.SessionID != "" && ls.sid != m.SessionID {
+		return false
+	}
+	if m.Subject != "" && ls.UserID != m.Subject {
+		return false
+	}
+	return ls.meta == nil || ls.meta.created.Before(m.Received)
+}
+
+// LogoutStore keeps the back-channel logouts of the last day, by the issuer
+// and ID of their logout token.
+type LogoutStore interface {
+	// Add records a logout. It fails with errLogoutReplayed if the logout
+	// token was received before.
+	Add(ctx context.Context, tokenID string, marker *LogoutMarker) error
+	// List returns the logouts of the issuer.
+	List(ctx context.Context, issuer string) ([]*LogoutMarker, error)
+}
+
+// logoutKey identifies a logout token. Token IDs are only unique per issuer.
+func logoutKey(issuer, tokenID string) string {
+	sum := sha256.Sum256([]byte(issuer + "\x00" + tokenID))
+	return hex.EncodeToString(sum[:])
+}
+
+// memoryLogoutStore is the LogoutStore of a single console replica.
+type memoryLogoutStore struct {
+	mux     sync.Mutex
+	markers map[string]*LogoutMarker
+}
+
+func newMemoryLogoutStore() *memoryLogoutStore {
+	return &memoryLogoutStore{markers: make(map[string]*LogoutMarker)}
+}
+
+func (s *memoryLogoutStore) Add(ctx context.Context, tokenID string, marker *LogoutMarker) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for key, m := range s.markers {
+		if time.Since(m.Received) > logoutMarkerTTL {
+			delete(s.markers, key)
+		}
+	}
+	key := logoutKey(marker.Issuer, tokenID)
+	if _, ok := s.markers[key]; ok {
+		return errLogoutReplayed
+	}
+	s.markers[key] = marker
+	return nil
+}
+
+func (s *memoryLogoutStore) List(ctx context.Context, issuer string) ([]*LogoutMarker, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	markers := []*LogoutMarker{}
+	for _, m := range s.markers {
+		if m.Issuer == issuer && time.Since(m.Received) <= logoutMarkerTTL {
+			markers = append(markers, m)
+		}
+	}
+	return markers, nil
+}
+
+// ConfigMapLogoutStore shares the back-channel logouts of console replicas
+// through a ConfigMap, which the console service account must be allowed to
+// get, create and update.
+type ConfigMapLogoutStore struct {
+	namespace string
+	name      string
+	newClient func() (kubernetes.Interface, error)
+}
+
+// NewConfigMapLogoutStore returns a LogoutStore keeping the logouts in the
+// namespace/name ConfigMap of the API server at endpoint.
+func NewConfigMapLogoutStore(client *http.Client, endpoint *url.URL, tokenSource TokenSource, namespace, name string) *ConfigMapLogoutStore {
+	return &ConfigMapLogoutStore{
+		namespace: namespace,
+		name:      name,
+		newClient: func() (kubernetes.Interface, error) {
+			token, err := tokenSource.Token()
+			if err != nil {
+				return nil, err
+			}
+			return kubernetes.NewForConfig(&rest.Config{
+				Host:        endpoint.String(),
+				BearerToken: token,
+				Transport:   client.Transport,
+			})
+		},
+	}
+}
+
+func (s *ConfigMapLogoutStore) Add(ctx context.Context, tokenID string, marker *LogoutMarker) error {
+	client, err := s.newClient()
+	if err != nil {
+		return err
+	}
+	value, err := json.Marshal(marker)
+	if err != nil {
+		return err
+	}
+	key := logoutKey(marker.Issuer, tokenID)
+	configMaps := client.CoreV1().ConfigMaps(s.namespace)
+	for attempt := 0; attempt < logoutStoreUpdateAttempts; attempt++ {
+		configMap, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			configMap = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: s.name, Namespace: s.namespace},
+				Data:       map[string]string{key: string(value)},
+			}
+			if _, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{}); apierrors.IsAlreadyExists(err) {
+				continue
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if _, ok := configMap.Data[key]; ok {
+			return errLogoutReplayed
+		}
+		if configMap.Data == nil {
+			configMap.Data = map[string]string{}
+		}
+		for k, v := range configMap.Data {
+			if m, err := parseLogoutMarker(v); err != nil || time.Since(m.Received) > logoutMarkerTTL {
+				delete(configMap.Data, k)
+			}
+		}
+		configMap.Data[key] = string(value)
+		if _, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{}); apierrors.IsConflict(err) {
+			continue
+		}
+		return err
+	}
+	return fmt.Errorf("failed to record logout in ConfigMap %s/%s: too many conflicts", s.namespace, s.name)
+}
+
+func (s *ConfigMapLogoutStore) List(ctx context.Context, issuer string) ([]*LogoutMarker, error) {
+	client, err := s.newClient()
+	if err != nil {
+		return nil, err
+	}
+	configMap, err := client.CoreV1().ConfigMaps(s.namespace).Get(ctx, s.name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return []*LogoutMarker{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	markers := []*LogoutMarker{}
+	for _, v := range configMap.Data {
+		m, err := parseLogoutMarker(v)
+		if err != nil || m.Issuer != issuer || time.Since(m.Received) > logoutMarkerTTL {
+			continue
+		}
+		markers = append(markers, m)
+	}
+	return markers, nil
+}
+
+func parseLogoutMarker(value string) (*LogoutMarker, error) {
+	m := &LogoutMarker{}
+	if err := json.Unmarshal([]byte(value), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// applyLogouts ends the sessions of the logouts in the store, which other
+// console replicas may have received.
+func (o *oidcAuth) applyLogouts(ctx context.Context) {
+	markers, err := o.logouts.List(ctx, o.issuerURL)
+	if err != nil {
+		klog.Errorf("failed to get back-channel logouts: %v", err)
+		return
+	}
+	if len(markers) == 0 {
+		return
+	}
+	deleted := o.sessions.deleteSessionsMatching(func(ls *loginState) bool {
+		for _, m := range markers {
+			if m.matches(ls) {
+				return true
+			}
+		}
+		return false
+	})
+	if len(deleted) > 0 {
+		klog.V(4).Infof("back-channel logouts deleted %d sessions", len(deleted))
+	}
+}
+
+// syncLogouts applies the logouts in the store periodically until the context is done.
+func (o *oidcAuth) syncLogouts(ctx context.Context) {
+	ticker := time.NewTicker(logoutSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.applyLogouts(ctx)
+		}
+	}
+}
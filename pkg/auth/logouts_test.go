@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestConfigMapLogoutStore(t *testing.T) {
+	stale, err := json.Marshal(&LogoutMarker{Issuer: "https://idp.example.com", Subject: "bob", Received: time.Now().Add(-2 * logoutMarkerTTL)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewSimpleClientset()
+	store := &ConfigMapLogoutStore{
+		namespace: "openshift-console",
+		name:      "console-logouts",
+		newClient: func() (kubernetes.Interface, error) { return client, nil },
+	}
+	ctx := context.Background()
+
+	markers, err := store.List(ctx, "https://idp.example.com")
+	if err != nil || len(markers) != 0 {
+		t.Fatalf("expected no logouts before the ConfigMap exists, got %v, %v", markers, err)
+	}
+
+	marker := &LogoutMarker{Issuer: "https://idp.example.com", Subject: "alice", Received: time.Now()}
+	if err := store.Add(ctx, "token-1", marker); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add(ctx, "token-1", marker); err != errLogoutReplayed {
+		t.Errorf("expected a replayed logout token to be rejected, got %v", err)
+	}
+	// Token IDs are only unique per issuer.
+	if err := store.Add(ctx, "token-1", &LogoutMarker{Issuer: "https://other.example.com", Subject: "alice", Received: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	configMaps := client.CoreV1().ConfigMaps("openshift-console")
+	configMap, err := configMaps.Get(ctx, "console-logouts", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMap.Data["stale"] = string(stale)
+	if _, err := configMaps.Update(ctx, configMap, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add(ctx, "token-2", &LogoutMarker{Issuer: "https://idp.example.com", SessionID: "session-1", Received: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	markers, err = store.List(ctx, "https://idp.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(markers) != 2 {
+		t.Errorf("expected the 2 logouts of the issuer, got %v", markers)
+	}
+	configMap, err = configMaps.Get(ctx, "console-logouts", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := configMap.Data["stale"]; ok || len(configMap.Data) != 3 {
+		t.Errorf("expected stale logouts to be removed, got %v", configMap.Data)
+	}
+}
+
+func TestLogoutMarkerMatches(t *testing.T) {
+	received := time.Now()
+	session := func(sub, sid string, created time.Time) *loginState {
+		return &loginState{UserID: sub, sid: sid, meta: &sessionMeta{created: created}}
+	}
+	bySub := &LogoutMarker{Subject: "alice", Received: received}
+	bySid := &LogoutMarker{SessionID: "session-1", Received: received}
+	tests := []struct {
+		marker  *LogoutMarker
+		session *loginState
+		matches bool
+	}{
+		{bySub, session("alice", "session-1", received.Add(-time.Minute)), true},
+		{bySub, session("bob", "session-1", received.Add(-time.Minute)), false},
+		{bySub, session("alice", "session-2", received.Add(time.Minute)), false},
+		{bySid, session("bob", "session-1", received.Add(-time.Minute)), true},
+		{bySid, session("bob", "session-2", received.Add(-time.Minute)), false},
+	}
+	for _, tt := range tests {
+		if got := tt.marker.matches(tt.session); got != tt.matches {
+			t.Errorf("expected %+v matching session of %s/%s created %v to be %v", tt.marker, tt.session.UserID, tt.session.sid, tt.session.meta.created, tt.matches)
+		}
+	}
+}
@@ -39,12 +39,36 @@ func (ss *SessionStore) addSession(ls *loginState) error {
 		return fmt.Errorf("Session token collision! THIS SHOULD NEVER HAPPEN! Token: %s", sessionToken)
 	}
 	ls.sessionToken = sessionToken
+	ss.storeSession(ls)
+	return nil
+}
+
+// storeSession adds loginState to session data structures under its existing sessionToken.
+func (ss *SessionStore) storeSession(ls *loginState) {
 	ss.mux.Lock()
-	ss.byToken[sessionToken] = ls
+	if ls.meta == nil {
+		ls.meta = newSessionMeta(ss.now())
+	}
+	if _, ok := ss.byToken[ls.sessionToken]; ok {
+		// Storing a session again replaces its age entry.
+		for i, s := range ss.byAge {
+			if s.token == ls.sessionToken {
+				ss.byAge = append(ss.byAge[:i], ss.byAge[i+1:]...)
+				break
+			}
+		}
+	}
+	ss.byToken[ls.sessionToken] = ls
 	// Assume token expiration is always the same time in the future. Should be close enough for government work.
-	ss.byAge = append(ss.byAge, oldSession{sessionToken, ls.exp})
+	ss.byAge = append(ss.byAge, oldSession{ls.sessionToken, ls.exp})
 	ss.mux.Unlock()
-	return nil
+}
+
+// replaceSession removes the session stored under oldToken and stores ls in its place.
+// The session token of ls may differ from oldToken.
+func (ss *SessionStore) replaceSession(oldToken string, ls *loginState) {
+	ss.deleteSession(oldToken)
+	ss.storeSession(ls)
 }
 
 func (ss *SessionStore) getSession(token string) *loginState {
@@ -68,6 +92,24 @@ func (ss *SessionStore) deleteSession(token string) error {
 	return fmt.Errorf("ss.byAge did not contain session %v", token)
 }
 
+// deleteSessionsMatching deletes all sessions for which match returns true and
+// returns the deleted sessions.
+func (ss *SessionStore) deleteSessionsMatching(match func(ls *loginState) bool) []*loginState {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	deleted := []*loginState{}
+	for i := 0; i < len(ss.byAge); i++ {
+		token := ss.byAge[i].token
+		if ls := ss.byToken[token]; ls != nil && match(ls) {
+			delete(ss.byToken, token)
+			ss.byAge = append(ss.byAge[:i], ss.byAge[i+1:]...)
+			i--
+			deleted = append(deleted, ls)
+		}
+	}
+	return deleted
+}
+
 func (ss *SessionStore) pruneSessions() {
 	ss.mux.Lock()
 	defer ss.mux.Unlock()
@@ -94,3 +136,42 @@ func (ss *SessionStore) pruneSessions() {
 		klog.V(4).Infof("Pruned %v old sessions.", expired+toRemove)
 	}
 }
+
+// sessionLocks holds a mutex per session, dropping the mutexes no one holds or
+// waits for. The zero value is ready to use.
+type sessionLocks struct {
+	mux   sync.Mutex
+	locks map[string]*sessionLock
+}
+
+type sessionLock struct {
+	sync.Mutex
+	// refs counts the holders and waiters of the lock.
+	refs int
+}
+
+// lock locks the mutex of the session and returns the function unlocking it.
+func (l *sessionLocks) lock(sessionToken string) func() {
+	l.mux.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*sessionLock)
+	}
+	lock, ok := l.locks[sessionToken]
+	if !ok {
+		lock = &sessionLock{}
+		l.locks[sessionToken] = lock
+	}
+	lock.refs++
+	l.mux.Unlock()
+
+	lock.Lock()
+	return func() {
+		lock.Unlock()
+		l.mux.Lock()
+		lock.refs--
+		if lock.refs == 0 {
+			delete(l.locks, sessionToken)
+		}
+		l.mux.Unlock()
+	}
+}
@@ -33,7 +33,7 @@ func TestSessions(t *testing.T) {
 	}
 
 	for _, ft := range fakeTokens {
-		ls, err := newLoginState(ft.raw, []byte(ft.claims))
+		ls, err := newLoginState(ft.raw, []byte(ft.claims), DefaultClaimMapping)
 		if err != nil {
 			t.Fatalf("newLoginState error: %v", err)
 		}
@@ -72,4 +72,48 @@ func TestSessions(t *testing.T) {
 	if len(ss.byAge) != 2 {
 		t.Fatal("ss.byAge != 2")
 	}
+
+	// Storing a session again doesn't duplicate it.
+	ss.storeSession(ss.byToken[ss.byAge[0].token])
+	checkSessions(t, ss)
+	if len(ss.byAge) != 2 {
+		t.Fatal("ss.byAge != 2 after storing a session again")
+	}
+}
+
+func TestSessionLocks(t *testing.T) {
+	var locks sessionLocks
+	unlockA := locks.lock("a")
+
+	// Other sessions aren't held up.
+	done := make(chan struct{})
+	go func() {
+		locks.lock("b")()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("locking another session should not wait")
+	}
+
+	locked, unlocked := make(chan struct{}), make(chan struct{})
+	go func() {
+		unlock := locks.lock("a")
+		close(locked)
+		unlock()
+		close(unlocked)
+	}()
+	select {
+	case <-locked:
+		t.Fatal("locking the same session should wait until it is unlocked")
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlockA()
+	<-unlocked
+
+	locks.lock("a")()
+	if len(locks.locks) != 0 {
+		t.Errorf("expected unused locks to be dropped, got %d", len(locks.locks))
+	}
 }
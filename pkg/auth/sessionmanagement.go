@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// sessionMeta describes a session for users and admins managing their sessions.
+type sessionMeta struct {
+	// id identifies the session in the API without revealing its token.
+	id        string
+	created   time.Time
+	lastSeen  time.Time
+	clientIP  string
+	userAgent string
+}
+
+func newSessionMeta(now time.Time) *sessionMeta {
+	id, err := randomURLSafeString(24)
+	if err != nil {
+		panic(fmt.Sprintf("FATAL ERROR: Unable to get random bytes for session ID: %v", err))
+	}
+	return &sessionMeta{id: id, created: now, lastSeen: now}
+}
+
+// SessionInfo describes an active console session.
+type SessionInfo struct {
+	ID        string    `json:"id"`
+	Cluster   string    `json:"cluster"`
+	Username  string    `json:"username"`
+	Created   time.Time `json:"created"`
+	LastSeen  time.Time `json:"lastSeen"`
+	ClientIP  string    `json:"clientIP"`
+	UserAgent string    `json:"userAgent"`
+	// Current is set for the session of the request listing the sessions.
+	Current bool `json:"current"`
+}
+
+// describeSession records the client that started the session stored under sessionToken.
+func (ss *SessionStore) describeSession(sessionToken, clientIP, userAgent string) {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	if ls := ss.byToken[sessionToken]; ls != nil {
+		ls.meta.clientIP = clientIP
+		ls.meta.userAgent = userAgent
+	}
+}
+
+// touchSession records that the session stored under sessionToken was just
+// used. It returns the username of the session, if known.
+func (ss *SessionStore) touchSession(sessionToken string) (string, bool) {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	ls := ss.byToken[sessionToken]
+	if ls == nil {
+		return "", false
+	}
+	ls.meta.lastSeen = ss.now()
+	return ls.Username, true
+}
+
+// sessionCreated returns when the session stored under sessionToken was
+// created, or false if the session isn't known.
+func (ss *SessionStore) sessionCreated(sessionToken string) (time.Time, bool) {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	ls := ss.byToken[sessionToken]
+	if ls == nil || ls.meta == nil {
+		return time.Time{}, false
+	}
+	return ls.meta.created, true
+}
+
+// transferSession carries the description of a session over to the login
+// state that replaced it on refresh.
+func (ss *SessionStore) transferSession(from, to *loginState) {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	to.meta = from.meta
+}
+
+// sessionInfos describes the sessions for which match returns true, most
+// recently used first. The session stored under currentToken is marked as current.
+func (ss *SessionStore) sessionInfos(cluster, currentToken string, match func(ls *loginState) bool) []SessionInfo {
+	ss.mux.Lock()
+	defer ss.mux.Unlock()
+	infos := []SessionInfo{}
+	for token, ls := range ss.byToken {
+		if ls.isExpired() || !match(ls) {
+			continue
+		}
+		info := ls.sessionInfo(cluster)
+		info.Current = currentToken != "" && token == currentToken
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].LastSeen.After(infos[j].LastSeen)
+	})
+	return infos
+}
+
+// sessionInfo describes the session. Must be called with the store locked.
+func (ls *loginState) sessionInfo(cluster string) SessionInfo {
+	return SessionInfo{
+		ID:        ls.meta.id,
+		Cluster:   cluster,
+		Username:  ls.Username,
+		Created:   ls.meta.created,
+		LastSeen:  ls.meta.lastSeen,
+		ClientIP:  ls.meta.clientIP,
+		UserAgent: ls.meta.userAgent,
+	}
+}
+
+// Sessions lists the active sessions of the user on this authenticator's
+// cluster. Sessions started before bridge was restarted aren't known.
+func (a *Authenticator) Sessions(r *http.Request, username string) []SessionInfo {
+	current := ""
+	if cookie, err := r.Cookie(a.sessionCookieName); err == nil {
+		current = cookie.Value
+	}
+	return a.sessions.sessionInfos(a.clusterName, current, func(ls *loginState) bool {
+		return ls.Username == username
+	})
+}
+
+// Session returns the active session with the given ID.
+func (a *Authenticator) Session(id string) (*SessionInfo, bool) {
+	infos := a.sessions.sessionInfos(a.clusterName, "", func(ls *loginState) bool {
+		return ls.meta.id == id
+	})
+	if len(infos) == 0 {
+		return nil, false
+	}
+	return &infos[0], true
+}
+
+// RevokeSessions ends the sessions of the user, or only the session with the
+// given ID if not empty. Their tokens are revoked with the identity provider
+// where supported, e.g. by deleting the OpenShift OAuth access token. The
+// OpenShift session cookie is the access token itself, so a session whose
+// token can't be revoked stays usable. Such sessions are kept, and an error
+// is returned along with the sessions that were ended.
+func (a *Authenticator) RevokeSessions(ctx context.Context, username, id string) ([]SessionInfo, error) {
+	deleted := a.sessions.deleteSessionsMatching(func(ls *loginState) bool {
+		return ls.Username == username && (id == "" || ls.meta.id == id)
+	})
+
+	var (
+		lm       = a.getLoginMethod()
+		revoked  = make([]SessionInfo, 0, len(deleted))
+		failed   int
+		firstErr error
+	)
+	for _, ls := range deleted {
+		err := errors.New("authenticator is not ready")
+		if lm != nil {
+			err = lm.revokeToken(ctx, ls.rawToken)
+		}
+		if err != nil {
+			klog.Errorf("failed to revoke token of session %s on cluster %s: %v", ls.meta.id, a.clusterName, err)
+			// Keep listing the session, it can still be used and revoking it retried.
+			a.sessions.storeSession(ls)
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		revoked = append(revoked, ls.sessionInfo(a.clusterName))
+	}
+	if firstErr != nil {
+		return revoked, fmt.Errorf("failed to revoke %d of %d sessions: %v", failed, len(deleted), firstErr)
+	}
+	return revoked, nil
+}
+
+// clientIP returns the address of the client that sent the request. If
+// trustForwardedFor is set, the last address of the X-Forwarded-For header is
+// preferred, which a router in front of the console appends. The addresses
+// before it are set by the client and can't be trusted. Without such a router
+// the client can set the whole header, so it is ignored by default.
+func clientIP(r *http.Request, trustForwardedFor bool) string {
+	if forwarded := r.Header.Values("X-Forwarded-For"); trustForwardedFor && len(forwarded) != 0 {
+		addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+		if address := strings.TrimSpace(addresses[len(addresses)-1]); address != "" {
+			return address
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+func TestSessionManagement(t *testing.T) {
+	p := &mockOpenShiftProvider{}
+
+	usernames := map[string]string{
+		"sha256~alice-laptop": "alice",
+		"sha256~alice-phone":  "alice",
+		"sha256~alice-tablet": "alice",
+		"sha256~bob":          "bob",
+	}
+	var deleted []string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const tokensPath = "/apis/oauth.openshift.io/v1/oauthaccesstokens/"
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		switch {
+		case r.URL.Path == "/apis/user.openshift.io/v1/users/~":
+			fmt.Fprintf(w, `{"metadata":{"name":%q,"uid":"uid-%s"}}`, usernames[token], usernames[token])
+		case strings.HasPrefix(r.URL.Path, tokensPath) && token == "sha256~alice-tablet":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case strings.HasPrefix(r.URL.Path, tokensPath):
+			if strings.TrimPrefix(r.URL.Path, tokensPath) != TokenToObjectName(token) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			deleted = append(deleted, token)
+		default:
+			p.handleDiscovery(w, r)
+		}
+	}))
+	defer s.Close()
+	p.issuer = s.URL
+
+	a, err := NewAuthenticator(context.Background(), &Config{
+		AuthSource:   AuthSourceOpenShift,
+		ClientID:     "fake-client-id",
+		ClientSecret: "fake-secret",
+		RedirectURL:  "http://example.com/callback",
+		IssuerURL:    p.issuer,
+		CookiePath:   "/",
+		RefererPath:  "http://auth.example.com/",
+		ClusterName:  "local-cluster",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(token string) *http.Request {
+		r := httptest.NewRequest("GET", "http://example.com/api/console/sessions", nil)
+		r.RemoteAddr = "10.0.0.1:12345"
+		r.Header.Set("User-Agent", "agent-"+token)
+		r.AddCookie(&http.Cookie{Name: GetCookieName("local-cluster"), Value: token})
+		return r
+	}
+
+	_, lm := a.authFunc()
+	for _, token := range []string{"sha256~alice-tablet", "sha256~alice-laptop", "sha256~alice-phone", "sha256~bob"} {
+		ls, err := lm.login(httptest.NewRecorder(), &oauth2.Token{AccessToken: token, Expiry: time.Now().Add(time.Hour)}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.sessions.describeSession(ls.sessionToken, "10.0.0.1", "agent-"+token)
+	}
+
+	user, err := a.Authenticate(httptest.NewRecorder(), request("sha256~alice-phone"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Username != "alice" {
+		t.Errorf("expected the username to be filled in from the session, got %q", user.Username)
+	}
+
+	sessions := a.Sessions(request("sha256~alice-phone"), "alice")
+	if len(sessions) != 3 {
+		t.Fatalf("expected 3 sessions, got %#v", sessions)
+	}
+	// The most recently used session comes first.
+	current := sessions[0]
+	if !current.Current || sessions[1].Current || sessions[2].Current || current.UserAgent != "agent-sha256~alice-phone" || current.ClientIP != "10.0.0.1" || current.Cluster != "local-cluster" {
+		t.Errorf("unexpected sessions: %#v", sessions)
+	}
+	if session, ok := a.Session(sessions[1].ID); !ok || session.Username != "alice" {
+		t.Errorf("expected to find the session by its ID, got %#v", session)
+	}
+
+	// Sessions of other users can't be revoked by ID.
+	if revoked, _ := a.RevokeSessions(context.Background(), "bob", current.ID); len(revoked) != 0 {
+		t.Errorf("expected no session to be revoked, got %#v", revoked)
+	}
+	revoked, err := a.RevokeSessions(context.Background(), "alice", current.ID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(revoked) != 1 || revoked[0].ID != current.ID {
+		t.Errorf("expected the current session to be revoked, got %#v", revoked)
+	}
+	if len(deleted) != 1 || deleted[0] != "sha256~alice-phone" {
+		t.Errorf("expected the access token to be deleted, got %v", deleted)
+	}
+
+	// The session whose token can't be revoked is kept, it can still be used.
+	revoked, err = a.RevokeSessions(context.Background(), "alice", "")
+	if err == nil {
+		t.Error("expected an error for the token that couldn't be revoked")
+	}
+	if len(revoked) != 1 || revoked[0].UserAgent != "agent-sha256~alice-laptop" {
+		t.Errorf("expected the laptop session to be revoked, got %#v", revoked)
+	}
+	if remaining := a.Sessions(request("sha256~alice-tablet"), "alice"); len(remaining) != 1 || remaining[0].UserAgent != "agent-sha256~alice-tablet" {
+		t.Errorf("expected the tablet session to be kept, got %#v", remaining)
+	}
+	if len(a.Sessions(request("sha256~bob"), "bob")) != 1 {
+		t.Error("expected the sessions of other users to be kept")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	for _, tt := range []struct {
+		forwarded []string
+		trusted   bool
+		expected  string
+	}{
+		{nil, true, "192.0.2.1"},
+		{[]string{"203.0.113.7"}, true, "203.0.113.7"},
+		// The client can prepend any address, only the router's is trusted.
+		{[]string{"198.51.100.9, 203.0.113.7"}, true, "203.0.113.7"},
+		{[]string{"198.51.100.9", "203.0.113.7"}, true, "203.0.113.7"},
+		// Without a router appending to it, the client sets the whole header.
+		{[]string{"203.0.113.7"}, false, "192.0.2.1"},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		for _, forwarded := range tt.forwarded {
+			r.Header.Add("X-Forwarded-For", forwarded)
+		}
+		if ip := clientIP(r, tt.trusted); ip != tt.expected {
+			t.Errorf("expected %s for X-Forwarded-For %v (trusted: %t), got %s", tt.expected, tt.forwarded, tt.trusted, ip)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	oidc "github.com/coreos/go-oidc"
+	"golang.org/x/oauth2"
+
+	"k8s.io/klog"
+)
+
+// tokenRequestStateCookieName holds the login flow of a token request. It is
+// separate from the login state cookie, so requesting a token doesn't
+// interfere with logging in to the console in another tab.
+const tokenRequestStateCookieName = "token-request-state"
+
+// tokenRequestClient is the OAuth client of the token request flow.
+type tokenRequestClient struct {
+	clientID     string
+	clientSecret string
+	redirectURL  string
+}
+
+// errTokenRequestUnavailable is returned while the identity provider can't be reached.
+var errTokenRequestUnavailable = errors.New("token requests are unavailable until the identity provider can be reached")
+
+// TokenRequest is a token issued to the user for command line tools.
+type TokenRequest struct {
+	Cluster string
+	Token   string
+	// Expiry is zero if the identity provider didn't say when the token expires.
+	Expiry time.Time
+	// WhoAmIPath is an API path that any user can get with the token.
+	WhoAmIPath string
+	// Kubeconfig tells whether the token was requested for a kubeconfig file.
+	Kubeconfig bool
+	// KubeconfigChain identifies the kubeconfig file with a context for every
+	// cluster the token was requested for, if any.
+	KubeconfigChain string
+}
+
+// TokenRequestEnabled reports whether an OAuth client is configured for the
+// token request flow.
+func (a *Authenticator) TokenRequestEnabled() bool {
+	return a.tokenRequest.clientID != ""
+}
+
+// getTokenRequestOAuth2Config returns nil if the authenticator isn't ready.
+func (a *Authenticator) getTokenRequestOAuth2Config() *oauth2.Config {
+	oauthConfig := a.getOAuth2Config()
+	if oauthConfig == nil {
+		return nil
+	}
+	// The login config is rebuilt for every call, so it can be changed.
+	oauthConfig.ClientID = a.tokenRequest.clientID
+	oauthConfig.ClientSecret = a.tokenRequest.clientSecret
+	oauthConfig.RedirectURL = a.tokenRequest.redirectURL
+	return oauthConfig
+}
+
+// TokenRequestFunc redirects to the identity provider to issue a token for
+// command line tools, like the token request page of the OpenShift integrated
+// OAuth server does.
+func (a *Authenticator) TokenRequestFunc(w http.ResponseWriter, r *http.Request) {
+	authCodeURL, err := a.StartTokenRequest(w, false, "")
+	if errors.Is(err, errTokenRequestUnavailable) {
+		klog.Errorf("token requests for cluster %s are unavailable until its identity provider can be reached", a.clusterName)
+		a.redirectAuthError(w, errorUnavailable)
+		return
+	}
+	if err != nil {
+		klog.Errorf("failed to start token request flow: %v", err)
+		a.redirectAuthError(w, errorInternal)
+		return
+	}
+	http.Redirect(w, r, authCodeURL, http.StatusSeeOther)
+}
+
+// StartTokenRequest sets the state cookie of a token request and returns the
+// URL of the identity provider to send the user to. With kubeconfig, the
+// token is handed to the callback for a kubeconfig file, which kubeconfigChain
+// identifies if it gets a context for several clusters.
+func (a *Authenticator) StartTokenRequest(w http.ResponseWriter, kubeconfig bool, kubeconfigChain string) (string, error) {
+	oauthConfig := a.getTokenRequestOAuth2Config()
+	if oauthConfig == nil {
+		return "", errTokenRequestUnavailable
+	}
+	flow, err := newLoginFlow(false)
+	if err != nil {
+		return "", err
+	}
+	flow.Kubeconfig = kubeconfig
+	flow.KubeconfigChain = kubeconfigChain
+	if err := a.setLoginFlowCookie(w, tokenRequestStateCookieName, flow); err != nil {
+		return "", fmt.Errorf("failed to set token request state cookie: %v", err)
+	}
+	return oauthConfig.AuthCodeURL(flow.State, flow.authCodeOptions()...), nil
+}
+
+// TokenRequestCallbackFunc exchanges the code of a token request for a token
+// and hands it to fn for display. No console session is created.
+func (a *Authenticator) TokenRequestCallbackFunc(fn func(tokenRequest *TokenRequest, w http.ResponseWriter, r *http.Request)) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		flow, err := a.getLoginFlow(r, tokenRequestStateCookieName)
+		if err != nil {
+			klog.Errorf("failed to parse token request state cookie: %v", err)
+			a.redirectAuthError(w, errorMissingState)
+			return
+		}
+		if q.Get("error") != "" {
+			klog.Errorf("token request failed: %s: %s", q.Get("error"), q.Get("error_description"))
+			a.redirectAuthError(w, errorOAuth)
+			return
+		}
+		code := q.Get("code")
+		if code == "" {
+			klog.Error("missing auth code in query param")
+			a.redirectAuthError(w, errorMissingCode)
+			return
+		}
+		if err := flow.verifyState(q.Get("state")); err != nil {
+			klog.Error(err)
+			a.redirectAuthError(w, errorInvalidState)
+			return
+		}
+		a.clearLoginFlowCookie(w, tokenRequestStateCookieName)
+
+		oauthConfig := a.getTokenRequestOAuth2Config()
+		if oauthConfig == nil {
+			a.redirectAuthError(w, errorUnavailable)
+			return
+		}
+		ctx := oidc.ClientContext(context.TODO(), a.clientFunc())
+		token, err := oauthConfig.Exchange(ctx, code, flow.exchangeOptions()...)
+		if err != nil {
+			klog.Errorf("unable to verify token request code with issuer: %v", err)
+			a.redirectAuthError(w, errorInvalidCode)
+			return
+		}
+
+		tokenRequest := &TokenRequest{
+			Cluster:         a.clusterName,
+			Token:           token.AccessToken,
+			Expiry:          token.Expiry,
+			WhoAmIPath:      "/apis/user.openshift.io/v1/users/~",
+			Kubeconfig:      flow.Kubeconfig,
+			KubeconfigChain: flow.KubeconfigChain,
+		}
+		if a.authSource != AuthSourceOpenShift {
+			// The API server authenticates OIDC users by their ID token. It comes
+			// straight from the token endpoint, so it needn't be verified here.
+			rawIDToken, ok := token.Extra("id_token").(string)
+			if !ok {
+				klog.Error("token response did not contain an ID token")
+				a.redirectAuthError(w, errorInvalidCode)
+				return
+			}
+			tokenRequest.Token = rawIDToken
+			// The expiry of the response is the access token's.
+			tokenRequest.Expiry = time.Time{}
+			tokenRequest.WhoAmIPath = "/api"
+		}
+		klog.V(4).Infof("issued token for command line tools on cluster %s", a.clusterName)
+		fn(tokenRequest, w, r)
+	}
+}
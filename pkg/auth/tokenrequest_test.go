@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestTokenRequest(t *testing.T) {
+	p := &mockOpenShiftProvider{}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/token" {
+			p.handleDiscovery(w, r)
+			return
+		}
+		if clientID, secret, _ := r.BasicAuth(); clientID != "token-request-client" || secret != "token-request-secret" {
+			t.Errorf("expected the code to be exchanged by the token request client, got %q", clientID)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"access_token": "sha256~cli-token", "token_type": "Bearer", "expires_in": 86400}`)
+	}))
+	defer s.Close()
+	p.issuer = s.URL
+
+	a, err := NewAuthenticator(context.Background(), &Config{
+		AuthSource:               AuthSourceOpenShift,
+		ClientID:                 "console",
+		ClientSecret:             "console-secret",
+		RedirectURL:              "http://example.com/auth/callback",
+		IssuerURL:                p.issuer,
+		ErrorURL:                 "http://example.com/error",
+		CookiePath:               "/",
+		RefererPath:              "http://example.com/",
+		ClusterName:              "local-cluster",
+		TokenRequestClientID:     "token-request-client",
+		TokenRequestClientSecret: "token-request-secret",
+		TokenRequestRedirectURL:  "http://example.com/auth/token/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !a.TokenRequestEnabled() {
+		t.Fatal("expected the token request flow to be enabled")
+	}
+
+	rr := httptest.NewRecorder()
+	a.TokenRequestFunc(rr, httptest.NewRequest("GET", "http://example.com/auth/token/request", nil))
+	u, err := url.Parse(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("client_id") != "token-request-client" || q.Get("redirect_uri") != "http://example.com/auth/token/callback" {
+		t.Errorf("expected a redirect for the token request client, got %s", u)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != tokenRequestStateCookieName {
+		t.Fatalf("expected the token request state cookie, got %v", cookies)
+	}
+
+	callback := func(state string) (*TokenRequest, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest("GET", "http://example.com/auth/token/callback?code=code&state="+state, nil)
+		r.AddCookie(cookies[0])
+		rr := httptest.NewRecorder()
+		var tokenRequest *TokenRequest
+		a.TokenRequestCallbackFunc(func(tr *TokenRequest, w http.ResponseWriter, r *http.Request) {
+			tokenRequest = tr
+		})(rr, r)
+		return tokenRequest, rr
+	}
+
+	if tokenRequest, rr := callback("wrong"); tokenRequest != nil || rr.Code != http.StatusSeeOther {
+		t.Errorf("expected a callback with an invalid state to be rejected, got %#v", tokenRequest)
+	}
+
+	tokenRequest, _ := callback(q.Get("state"))
+	if tokenRequest == nil || tokenRequest.Token != "sha256~cli-token" || tokenRequest.Cluster != "local-cluster" || tokenRequest.Expiry.IsZero() {
+		t.Fatalf("unexpected token request: %#v", tokenRequest)
+	}
+	if a.sessions.getSession("sha256~cli-token") != nil {
+		t.Error("expected no console session to be created for the token")
+	}
+	if tokenRequest.Kubeconfig {
+		t.Error("expected the token to be requested for the token page")
+	}
+
+	rr = httptest.NewRecorder()
+	authCodeURL, err := a.StartTokenRequest(rr, true, "chain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u, err = url.Parse(authCodeURL); err != nil {
+		t.Fatal(err)
+	}
+	cookies = rr.Result().Cookies()
+	if tokenRequest, _ = callback(u.Query().Get("state")); tokenRequest == nil || !tokenRequest.Kubeconfig || tokenRequest.KubeconfigChain != "chain" {
+		t.Errorf("expected the token to be requested for a kubeconfig file, got %#v", tokenRequest)
+	}
+}
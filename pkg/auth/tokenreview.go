@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"github.com/openshift/console/pkg/proxy"
+)
+
+const (
+	tokenReviewCacheSize = 1024
+	// tokenReviewCacheTTL bounds how long a revoked token can still be used
+	// against bridge endpoints.
+	tokenReviewCacheTTL = 30 * time.Second
+)
+
+// TokenReviewer validates bearer tokens sent by automation with a Kubernetes
+// TokenReview against the API server of a cluster.
+type TokenReviewer struct {
+	client   *http.Client
+	endpoint string
+	// tokenSource supplies the token authenticating the TokenReview requests. It
+	// needs permission to create tokenreviews, typically through the
+	// system:auth-delegator cluster role. When nil or empty, the token under
+	// review is used, so it needs that permission itself.
+	tokenSource TokenSource
+	reviews     *cache.LRUExpireCache
+}
+
+// NewTokenReviewer returns a TokenReviewer for the API server at endpoint.
+func NewTokenReviewer(client *http.Client, endpoint *url.URL, tokenSource TokenSource) *TokenReviewer {
+	return &TokenReviewer{
+		client:      client,
+		endpoint:    proxy.SingleJoiningSlash(endpoint.String(), "/apis/authentication.k8s.io/v1/tokenreviews"),
+		tokenSource: tokenSource,
+		reviews:     cache.NewLRUExpireCache(tokenReviewCacheSize),
+	}
+}
+
+// Review returns the user the token belongs to, or an error if the API server
+// doesn't authenticate the token. Successful reviews are cached briefly.
+func (t *TokenReviewer) Review(ctx context.Context, token string) (*User, error) {
+	key := tokenCacheKey(token)
+	if user, ok := t.reviews.Get(key); ok {
+		return user.(*User).copy(), nil
+	}
+
+	reviewed, err := t.review(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		ID:       reviewed.UID,
+		Username: reviewed.Username,
+		Groups:   nonNil(reviewed.Groups),
+		Token:    token,
+	}
+	t.reviews.Add(key, user, tokenReviewCacheTTL)
+	return user.copy(), nil
+}
+
+// copy returns a deep copy of the user, so that callers can't change the cached one.
+func (u *User) copy() *User {
+	c := *u
+	c.Groups = append([]string{}, u.Groups...)
+	return &c
+}
+
+// review creates a TokenReview for the token and returns the user it belongs to.
+func (t *TokenReviewer) review(ctx context.Context, token string) (*authenticationv1.UserInfo, error) {
+	review := &authenticationv1.TokenReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "authentication.k8s.io/v1",
+			Kind:       "TokenReview",
+		},
+		Spec: authenticationv1.TokenReviewSpec{
+			Token: token,
+		},
+	}
+	body, err := json.Marshal(review)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	credential := token
+	if t.tokenSource != nil {
+		reviewerToken, err := t.tokenSource.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token for token review: %v", err)
+		}
+		if reviewerToken != "" {
+			credential = reviewerToken
+		}
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", credential))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create token review: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to create token review: %s", resp.Status)
+	}
+
+	result := &authenticationv1.TokenReview{}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, fmt.Errorf("failed to decode token review: %v", err)
+	}
+	if !result.Status.Authenticated {
+		if result.Status.Error != "" {
+			return nil, fmt.Errorf("token not authenticated: %s", result.Status.Error)
+		}
+		return nil, fmt.Errorf("token not authenticated")
+	}
+	return &result.Status.User, nil
+}
+
+// GetBearerToken returns the token of the request's `Authorization: Bearer`
+// header, if any.
+func GetBearerToken(r *http.Request) string {
+	parts := strings.SplitN(r.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(parts[1])
+}
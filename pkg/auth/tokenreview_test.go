@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+)
+
+func TestTokenReviewer(t *testing.T) {
+	reviews := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/apis/authentication.k8s.io/v1/tokenreviews" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer service-account-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		reviews++
+		review := &authenticationv1.TokenReview{}
+		if err := json.NewDecoder(r.Body).Decode(review); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if review.Spec.Token == "valid-token" {
+			review.Status.Authenticated = true
+			review.Status.User = authenticationv1.UserInfo{UID: "1234", Username: "ci-bot", Groups: []string{"ci"}}
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(review)
+	}))
+	defer s.Close()
+
+	endpoint, _ := url.Parse(s.URL)
+	reviewer := NewTokenReviewer(s.Client(), endpoint, NewStaticTokenSource("service-account-token"))
+
+	r := httptest.NewRequest("POST", "/api/helm/release", nil)
+	r.Header.Set("Authorization", "Bearer valid-token")
+	for i := 0; i < 2; i++ {
+		user, err := reviewer.Review(r.Context(), GetBearerToken(r))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if user.Username != "ci-bot" || user.ID != "1234" || user.Token != "valid-token" || len(user.Groups) != 1 || user.Groups[0] != "ci" {
+			t.Errorf("unexpected user: %#v", user)
+		}
+		// Callers changing the user must not change the cached one.
+		user.Username = "mallory"
+		user.Groups[0] = "system:masters"
+	}
+	if reviews != 1 {
+		t.Errorf("expected successful reviews to be cached, got %d reviews", reviews)
+	}
+
+	if _, err := reviewer.Review(r.Context(), "invalid-token"); err == nil {
+		t.Error("expected invalid token to be rejected")
+	}
+}
+
+func TestGetBearerToken(t *testing.T) {
+	tests := map[string]string{
+		"Bearer abc":         "abc",
+		"bearer abc":         "abc",
+		"Basic dXNlcjpwYXNz": "",
+		"AccessToken a:b":    "",
+		"":                   "",
+	}
+	for header, want := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		if got := GetBearerToken(r); got != want {
+			t.Errorf("%q: want %q, got %q", header, want, got)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"golang.org/x/oauth2"
+
+	"k8s.io/client-go/transport"
+)
+
+// TokenSource supplies the bearer token bridge authenticates its own API
+// requests with. The token may change over time, e.g. when the kubelet rotates
+// a bound service account token on disk.
+type TokenSource interface {
+	// Token returns the current token.
+	Token() (string, error)
+}
+
+type staticTokenSource string
+
+// NewStaticTokenSource returns a TokenSource that always returns token.
+func NewStaticTokenSource(token string) TokenSource {
+	return staticTokenSource(token)
+}
+
+func (s staticTokenSource) Token() (string, error) {
+	return string(s), nil
+}
+
+type fileTokenSource struct {
+	source oauth2.TokenSource
+}
+
+// NewFileTokenSource returns a TokenSource that reads the token from the file
+// at path and re-reads it every minute. If the file can't be read, the last
+// token is used until the file is readable again. The file must be readable
+// when the token source is created.
+func NewFileTokenSource(path string) (TokenSource, error) {
+	ts := &fileTokenSource{source: transport.NewCachedFileTokenSource(path)}
+	if _, err := ts.Token(); err != nil {
+		return nil, err
+	}
+	return ts, nil
+}
+
+func (f *fileTokenSource) Token() (string, error) {
+	token, err := f.source.Token()
+	if err != nil {
+		return "", err
+	}
+	return token.AccessToken, nil
+}
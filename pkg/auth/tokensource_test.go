@@ -0,0 +1,41 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileTokenSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "token")
+	if _, err := NewFileTokenSource(path); err == nil {
+		t.Error("expected a missing token file to be rejected")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("service-account-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ts, err := NewFileTokenSource(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The token is cached, so a file that is briefly unreadable during rotation is fine.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	token, err := ts.Token()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "service-account-token" {
+		t.Errorf("unexpected token %q", token)
+	}
+}
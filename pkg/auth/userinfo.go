@@ -0,0 +1,267 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+
+	"github.com/openshift/console/pkg/proxy"
+)
+
+const (
+	userInfoCacheSize = 4096
+	// UserInfoCacheTTL is how long the identity and capabilities of a user are
+	// cached. Group membership and role changes are picked up after at most this long.
+	UserInfoCacheTTL = time.Minute
+)
+
+// ErrUnauthorized is returned when the API server doesn't accept the token of
+// the user, typically because it expired or was revoked.
+var ErrUnauthorized = errors.New("the token of the user is not valid")
+
+// Capability is a common access review answered for every user.
+type Capability struct {
+	Name string
+	authorizationv1.ResourceAttributes
+}
+
+// Capabilities are the access reviews included in UserInfo. They cover the
+// questions console plugins most often ask before rendering.
+var Capabilities = []Capability{
+	{Name: "clusterAdmin", ResourceAttributes: authorizationv1.ResourceAttributes{Verb: "*", Group: "*", Resource: "*"}},
+	{Name: "listNamespaces", ResourceAttributes: authorizationv1.ResourceAttributes{Verb: "list", Resource: "namespaces"}},
+	{Name: "createProjects", ResourceAttributes: authorizationv1.ResourceAttributes{Verb: "create", Group: "project.openshift.io", Resource: "projectrequests"}},
+	{Name: "listNodes", ResourceAttributes: authorizationv1.ResourceAttributes{Verb: "list", Resource: "nodes"}},
+	{Name: "viewClusterSettings", ResourceAttributes: authorizationv1.ResourceAttributes{Verb: "get", Group: "config.openshift.io", Resource: "clusterversions"}},
+	{Name: "installOperators", ResourceAttributes: authorizationv1.ResourceAttributes{Verb: "create", Group: "operators.coreos.com", Resource: "subscriptions"}},
+}
+
+// UserInfo describes the identity of a user on a cluster.
+type UserInfo struct {
+	Username   string   `json:"username"`
+	UID        string   `json:"uid"`
+	Groups     []string `json:"groups"`
+	Identities []string `json:"identities"`
+	// Capabilities is nil if only the identity was resolved.
+	Capabilities map[string]bool `json:"capabilities"`
+}
+
+// UserInfoResolver resolves the identity of users on a cluster from their
+// token. Identities and capabilities are cached separately per token.
+type UserInfoResolver struct {
+	client   *http.Client
+	endpoint string
+	// tokenReviewer resolves users on clusters without the OpenShift user API.
+	tokenReviewer *TokenReviewer
+	identities    *cache.LRUExpireCache
+	capabilities  *cache.LRUExpireCache
+}
+
+// NewUserInfoResolver returns a UserInfoResolver for the API server at
+// endpoint. tokenReviewer may be nil if the cluster serves the OpenShift user API.
+func NewUserInfoResolver(client *http.Client, endpoint *url.URL, tokenReviewer *TokenReviewer) *UserInfoResolver {
+	return &UserInfoResolver{
+		client:        client,
+		endpoint:      endpoint.String(),
+		tokenReviewer: tokenReviewer,
+		identities:    cache.NewLRUExpireCache(userInfoCacheSize),
+		capabilities:  cache.NewLRUExpireCache(userInfoCacheSize),
+	}
+}
+
+// ResolveIdentity returns the identity of the user the token belongs to,
+// without reviewing its capabilities.
+func (u *UserInfoResolver) ResolveIdentity(ctx context.Context, token string) (*UserInfo, error) {
+	key := tokenCacheKey(token)
+	if userInfo, ok := u.identities.Get(key); ok {
+		return userInfo.(*UserInfo).copy(), nil
+	}
+
+	userInfo, err := u.getUser(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	u.identities.Add(key, userInfo, UserInfoCacheTTL)
+	return userInfo.copy(), nil
+}
+
+// Resolve returns the identity and capabilities of the user the token belongs to.
+func (u *UserInfoResolver) Resolve(ctx context.Context, token string) (*UserInfo, error) {
+	userInfo, err := u.ResolveIdentity(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	key := tokenCacheKey(token)
+	capabilities, ok := u.capabilities.Get(key)
+	if !ok {
+		if capabilities, err = u.getCapabilities(ctx, token); err != nil {
+			return nil, err
+		}
+		u.capabilities.Add(key, capabilities, UserInfoCacheTTL)
+	}
+	userInfo.Capabilities = copyCapabilities(capabilities.(map[string]bool))
+	return userInfo, nil
+}
+
+// copy returns a deep copy of the user info, so that callers can't change the
+// cached one.
+func (u *UserInfo) copy() *UserInfo {
+	c := *u
+	c.Groups = append([]string{}, u.Groups...)
+	c.Identities = append([]string{}, u.Identities...)
+	if u.Capabilities != nil {
+		c.Capabilities = copyCapabilities(u.Capabilities)
+	}
+	return &c
+}
+
+func copyCapabilities(capabilities map[string]bool) map[string]bool {
+	c := make(map[string]bool, len(capabilities))
+	for name, allowed := range capabilities {
+		c[name] = allowed
+	}
+	return c
+}
+
+// getUser gets the current user from the OpenShift user API, falling back to a
+// TokenReview on other clusters.
+func (u *UserInfoResolver) getUser(ctx context.Context, token string) (*UserInfo, error) {
+	user := struct {
+		metav1.ObjectMeta `json:"metadata"`
+		Groups            []string `json:"groups"`
+		Identities        []string `json:"identities"`
+	}{}
+	status, err := u.do(ctx, token, http.MethodGet, "/apis/user.openshift.io/v1/users/~", nil, &user)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case status == http.StatusOK:
+		return &UserInfo{
+			Username:   user.Name,
+			UID:        string(user.UID),
+			Groups:     nonNil(user.Groups),
+			Identities: nonNil(user.Identities),
+		}, nil
+	case status == http.StatusUnauthorized:
+		return nil, ErrUnauthorized
+	case status == http.StatusNotFound && u.tokenReviewer != nil:
+		reviewed, err := u.tokenReviewer.review(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		return &UserInfo{
+			Username:   reviewed.Username,
+			UID:        reviewed.UID,
+			Groups:     nonNil(reviewed.Groups),
+			Identities: []string{},
+		}, nil
+	default:
+		return nil, fmt.Errorf("failed to get the current user: %s", http.StatusText(status))
+	}
+}
+
+func (u *UserInfoResolver) getCapabilities(ctx context.Context, token string) (map[string]bool, error) {
+	var (
+		mux          sync.Mutex
+		wg           sync.WaitGroup
+		firstErr     error
+		capabilities = make(map[string]bool, len(Capabilities))
+	)
+	for _, c := range Capabilities {
+		wg.Add(1)
+		go func(c Capability) {
+			defer wg.Done()
+			allowed, err := u.Authorize(ctx, token, c.ResourceAttributes)
+			mux.Lock()
+			defer mux.Unlock()
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to review access for %s: %v", c.Name, err)
+				}
+				return
+			}
+			capabilities[c.Name] = allowed
+		}(c)
+	}
+	wg.Wait()
+	return capabilities, firstErr
+}
+
+// Authorize reports whether the user the token belongs to is allowed to
+// access the resource, using a SelfSubjectAccessReview. Results aren't cached.
+func (u *UserInfoResolver) Authorize(ctx context.Context, token string, attributes authorizationv1.ResourceAttributes) (bool, error) {
+	review := &authorizationv1.SelfSubjectAccessReview{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: "authorization.k8s.io/v1",
+			Kind:       "SelfSubjectAccessReview",
+		},
+		Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+			ResourceAttributes: &attributes,
+		},
+	}
+	status, err := u.do(ctx, token, http.MethodPost, "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", review, review)
+	if err != nil {
+		return false, err
+	}
+	if status != http.StatusCreated && status != http.StatusOK {
+		return false, fmt.Errorf("access review failed: %s", http.StatusText(status))
+	}
+	return review.Status.Allowed, nil
+}
+
+// do sends a request to the API server with the user's token and decodes
+// successful responses into out.
+func (u *UserInfoResolver) do(ctx context.Context, token, method, path string, in, out interface{}) (int, error) {
+	var body *bytes.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return 0, err
+		}
+		body = bytes.NewReader(data)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, proxy.SingleJoiningSlash(u.endpoint, path), body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := u.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return 0, fmt.Errorf("failed to decode response of %s: %v", path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
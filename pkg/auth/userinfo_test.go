@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+func TestUserInfoResolver(t *testing.T) {
+	requests, reviews := 0, 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/apis/user.openshift.io/v1/users/~", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") == "Bearer expired-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer openshift-token" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"metadata":{"name":"alice","uid":"1234"},"groups":["developers"],"identities":["htpasswd:alice"]}`))
+	})
+	mux.HandleFunc("/apis/authentication.k8s.io/v1/tokenreviews", func(w http.ResponseWriter, r *http.Request) {
+		review := &authenticationv1.TokenReview{}
+		json.NewDecoder(r.Body).Decode(review)
+		review.Status.Authenticated = true
+		review.Status.User = authenticationv1.UserInfo{UID: "5678", Username: "bob", Groups: []string{"system:authenticated"}}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(review)
+	})
+	mux.HandleFunc("/apis/authorization.k8s.io/v1/selfsubjectaccessreviews", func(w http.ResponseWriter, r *http.Request) {
+		reviews++
+		review := &authorizationv1.SelfSubjectAccessReview{}
+		json.NewDecoder(r.Body).Decode(review)
+		review.Status.Allowed = review.Spec.ResourceAttributes.Resource == "namespaces"
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(review)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	endpoint, _ := url.Parse(s.URL)
+	resolver := NewUserInfoResolver(s.Client(), endpoint, NewTokenReviewer(s.Client(), endpoint, NewStaticTokenSource("service-account-token")))
+
+	for i := 0; i < 2; i++ {
+		userInfo, err := resolver.Resolve(context.Background(), "openshift-token")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if userInfo.Username != "alice" || userInfo.UID != "1234" || len(userInfo.Groups) != 1 || len(userInfo.Identities) != 1 {
+			t.Errorf("unexpected user info: %#v", userInfo)
+		}
+		if !userInfo.Capabilities["listNamespaces"] || userInfo.Capabilities["clusterAdmin"] {
+			t.Errorf("unexpected capabilities: %v", userInfo.Capabilities)
+		}
+		if len(userInfo.Capabilities) != len(Capabilities) {
+			t.Errorf("expected %d capabilities, got %d", len(Capabilities), len(userInfo.Capabilities))
+		}
+		// Callers changing the user info must not change the cached one.
+		userInfo.Username = "mallory"
+		userInfo.Groups[0] = "system:masters"
+		userInfo.Capabilities["clusterAdmin"] = true
+	}
+	if requests != 1 {
+		t.Errorf("expected user info to be cached, got %d requests", requests)
+	}
+
+	if reviews != len(Capabilities) {
+		t.Errorf("expected capabilities to be cached, got %d access reviews", reviews)
+	}
+
+	// Callers only needing the identity don't review capabilities.
+	userInfo, err := resolver.ResolveIdentity(context.Background(), "kubernetes-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if userInfo.Username != "bob" || userInfo.UID != "5678" || userInfo.Capabilities != nil {
+		t.Errorf("expected the identity from the token review, got %#v", userInfo)
+	}
+	if reviews != len(Capabilities) {
+		t.Errorf("expected no access reviews for the identity, got %d", reviews-len(Capabilities))
+	}
+	if userInfo, err = resolver.Resolve(context.Background(), "kubernetes-token"); err != nil || len(userInfo.Capabilities) != len(Capabilities) {
+		t.Errorf("expected the capabilities of the cached identity to be reviewed, got %#v, %v", userInfo, err)
+	}
+
+	if _, err := resolver.Resolve(context.Background(), "expired-token"); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected an unauthorized error for an expired token, got %v", err)
+	}
+}
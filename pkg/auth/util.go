@@ -2,7 +2,9 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -29,6 +31,22 @@ func randomString(length int) string {
 	return base64.StdEncoding.EncodeToString(bytes)
 }
 
+// randomURLSafeString returns length random bytes encoded for use in URLs.
+func randomURLSafeString(length int) (string, error) {
+	bytes := make([]byte, length)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("unable to get random bytes: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// tokenCacheKey returns the key caching results for a token, so that caches
+// don't hold tokens themselves.
+func tokenCacheKey(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
 func GetCookieName(clusterName string) string {
 	if clusterName == serverutils.LocalClusterName {
 		return openshiftAccessTokenCookieName
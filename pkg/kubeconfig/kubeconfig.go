@@ -0,0 +1,181 @@
+// Package kubeconfig configures access to clusters from a kubeconfig file for
+// running bridge outside of a cluster.
+package kubeconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	oscrypto "github.com/openshift/library-go/pkg/crypto"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+
+	"github.com/openshift/console/pkg/auth"
+)
+
+// Cluster is the API server of a kubeconfig context and the credentials of
+// the context's user.
+type Cluster struct {
+	// Name is the name of the kubeconfig context.
+	Name     string
+	Endpoint *url.URL
+	// TLSConfig verifies the API server and presents client certificates,
+	// including certificates returned by exec credential plugins.
+	TLSConfig *tls.Config
+	// CAData is the PEM encoded CA bundle of the API server. It is empty if the
+	// system roots are used.
+	CAData []byte
+	// TokenSource returns the bearer token of the user, which is empty if the
+	// user authenticates with a client certificate.
+	TokenSource auth.TokenSource
+	// ClientCertificate tells whether the TLS configuration may present a client
+	// certificate, which the API server prefers over any bearer token.
+	ClientCertificate bool
+}
+
+// Load reads the kubeconfig file at path, or the files in $KUBECONFIG or
+// ~/.kube/config if path is empty. It returns the cluster of the given
+// context, or of the current context if empty. If allContexts is set, the
+// clusters of all other contexts are returned as well, sorted by name.
+func Load(path, context string, allContexts bool) (*Cluster, []*Cluster, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if path != "" {
+		rules.ExplicitPath = path
+	}
+	config, err := rules.Load()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load kubeconfig: %v", err)
+	}
+
+	if context == "" {
+		context = config.CurrentContext
+	}
+	if context == "" {
+		return nil, nil, fmt.Errorf("kubeconfig has no current context, select one with --k8s-mode-kubeconfig-context")
+	}
+	current, err := newCluster(config, rules, context)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !allContexts {
+		return current, nil, nil
+	}
+
+	names := make([]string, 0, len(config.Contexts))
+	for name := range config.Contexts {
+		if name != context {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	others := make([]*Cluster, 0, len(names))
+	for _, name := range names {
+		cluster, err := newCluster(config, rules, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		others = append(others, cluster)
+	}
+	return current, others, nil
+}
+
+func newCluster(config *clientcmdapi.Config, rules *clientcmd.ClientConfigLoadingRules, context string) (*Cluster, error) {
+	if _, ok := config.Contexts[context]; !ok {
+		return nil, fmt.Errorf("context %q not found in kubeconfig", context)
+	}
+	restConfig, err := clientcmd.NewNonInteractiveClientConfig(*config, context, &clientcmd.ConfigOverrides{}, rules).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("invalid kubeconfig context %q: %v", context, err)
+	}
+
+	// Servers without a scheme are interpreted like client-go does.
+	endpoint, _, err := rest.DefaultServerURL(restConfig.Host, "", schema.GroupVersion{}, false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server of kubeconfig context %q: %v", context, err)
+	}
+
+	tlsConfig, err := rest.TLSConfigFor(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS configuration of kubeconfig context %q: %v", context, err)
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+
+	caData := restConfig.TLSClientConfig.CAData
+	if len(caData) == 0 && restConfig.TLSClientConfig.CAFile != "" {
+		if caData, err = ioutil.ReadFile(restConfig.TLSClientConfig.CAFile); err != nil {
+			return nil, fmt.Errorf("failed to read CA file of kubeconfig context %q: %v", context, err)
+		}
+	}
+
+	tokenSource, err := newTokenSource(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credentials of kubeconfig context %q: %v", context, err)
+	}
+	return &Cluster{
+		Name:              context,
+		Endpoint:          endpoint,
+		TLSConfig:         oscrypto.SecureTLSConfig(tlsConfig),
+		CAData:            caData,
+		TokenSource:       tokenSource,
+		ClientCertificate: len(tlsConfig.Certificates) != 0 || tlsConfig.GetClientCertificate != nil,
+	}, nil
+}
+
+// tokenSource gets the bearer token of a kubeconfig user from the
+// authentication wrappers of client-go, which take care of token files, exec
+// credential plugins and auth provider plugins and their caching and refresh.
+type tokenSource struct {
+	host    string
+	wrapper http.RoundTripper
+}
+
+func newTokenSource(restConfig *rest.Config) (auth.TokenSource, error) {
+	wrapper, err := rest.HTTPWrappersForConfig(restConfig, captureAuthorization{})
+	if err != nil {
+		return nil, err
+	}
+	return &tokenSource{host: restConfig.Host, wrapper: wrapper}, nil
+}
+
+func (t *tokenSource) Token() (string, error) {
+	req, err := http.NewRequest(http.MethodGet, t.host, nil)
+	if err != nil {
+		return "", err
+	}
+	// The request never leaves the process, captureAuthorization answers it.
+	resp, err := t.wrapper.RoundTrip(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get credentials: %v", err)
+	}
+	resp.Body.Close()
+
+	parts := strings.SplitN(resp.Header.Get("Authorization"), " ", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") {
+		return "", nil
+	}
+	return parts[1], nil
+}
+
+// captureAuthorization is a round tripper that echoes the Authorization header
+// of the request in its response.
+type captureAuthorization struct{}
+
+func (captureAuthorization) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Authorization", req.Header.Get("Authorization"))
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     header,
+		Body:       http.NoBody,
+		Request:    req,
+	}, nil
+}
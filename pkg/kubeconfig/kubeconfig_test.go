@@ -0,0 +1,198 @@
+package kubeconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testCA = `-----BEGIN CERTIFICATE-----
+MIIDujCCAqKgAwIBAgIIE31FZVaPXTUwDQYJKoZIhvcNAQEFBQAwSTELMAkGA1UE
+BhMCVVMxEzARBgNVBAoTCkdvb2dsZSBJbmMxJTAjBgNVBAMTHEdvb2dsZSBJbnRl
+cm5ldCBBdXRob3JpdHkgRzIwHhcNMTQwMTI5MTMyNzQzWhcNMTQwNTI5MDAwMDAw
+WjBpMQswCQYDVQQGEwJVUzETMBEGA1UECAwKQ2FsaWZvcm5pYTEWMBQGA1UEBwwN
+TW91bnRhaW4gVmlldzETMBEGA1UECgwKR29vZ2xlIEluYzEYMBYGA1UEAwwPbWFp
+bC5nb29nbGUuY29tMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEfRrObuSW5T7q
+5CnSEqefEmtH4CCv6+5EckuriNr1CjfVvqzwfAhopXkLrq45EQm8vkmf7W96XJhC
+7ZM0dYi1/qOCAU8wggFLMB0GA1UdJQQWMBQGCCsGAQUFBwMBBggrBgEFBQcDAjAa
+BgNVHREEEzARgg9tYWlsLmdvb2dsZS5jb20wCwYDVR0PBAQDAgeAMGgGCCsGAQUF
+BwEBBFwwWjArBggrBgEFBQcwAoYfaHR0cDovL3BraS5nb29nbGUuY29tL0dJQUcy
+LmNydDArBggrBgEFBQcwAYYfaHR0cDovL2NsaWVudHMxLmdvb2dsZS5jb20vb2Nz
+cDAdBgNVHQ4EFgQUiJxtimAuTfwb+aUtBn5UYKreKvMwDAYDVR0TAQH/BAIwADAf
+BgNVHSMEGDAWgBRK3QYWG7z2aLV29YG2u2IaulqBLzAXBgNVHSAEEDAOMAwGCisG
+AQQB1nkCBQEwMAYDVR0fBCkwJzAloCOgIYYfaHR0cDovL3BraS5nb29nbGUuY29t
+L0dJQUcyLmNybDANBgkqhkiG9w0BAQUFAAOCAQEAH6RYHxHdcGpMpFE3oxDoFnP+
+gtuBCHan2yE2GRbJ2Cw8Lw0MmuKqHlf9RSeYfd3BXeKkj1qO6TVKwCh+0HdZk283
+TZZyzmEOyclm3UGFYe82P/iDFt+CeQ3NpmBg+GoaVCuWAARJN/KfglbLyyYygcQq
+0SgeDh8dRKUiaW3HQSoYvTvdTuqzwK4CXsr3b5/dAOY8uMuG/IAR3FgwTbZ1dtoW
+RvOTa8hYiU6A475WuZKyEHcwnGYe57u2I2KbMgcKjPniocj4QzgYsVAVKW3IwaOh
+yE+vPxsiUkvQHdO2fojCkY8jg70jxM+gu59tPDNbw3Uh/2Ij310FgTHsnGQMyA==
+-----END CERTIFICATE-----
+`
+
+func writeKubeconfig(t *testing.T, dir string) string {
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: dev
+clusters:
+- name: dev-cluster
+  cluster:
+    server: https://api.dev.example.com:6443
+    certificate-authority-data: %s
+- name: prod-cluster
+  cluster:
+    server: https://api.prod.example.com:6443
+    insecure-skip-tls-verify: true
+users:
+- name: dev-user
+  user:
+    token: static-token
+- name: prod-user
+  user:
+    tokenFile: %s
+contexts:
+- name: dev
+  context:
+    cluster: dev-cluster
+    user: dev-user
+- name: prod
+  context:
+    cluster: prod-cluster
+    user: prod-user
+`, base64.StdEncoding.EncodeToString([]byte(testCA)), tokenFile)
+	path := filepath.Join(dir, "kubeconfig")
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeKubeconfig(t, dir)
+
+	current, others, err := Load(path, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Name != "dev" || current.Endpoint.String() != "https://api.dev.example.com:6443" {
+		t.Errorf("unexpected current cluster: %#v", current)
+	}
+	if string(current.CAData) != testCA {
+		t.Errorf("expected the CA data of the cluster, got %q", current.CAData)
+	}
+	if token, err := current.TokenSource.Token(); err != nil || token != "static-token" {
+		t.Errorf("expected the static token, got %q, %v", token, err)
+	}
+
+	if len(others) != 1 {
+		t.Fatalf("expected 1 other cluster, got %d", len(others))
+	}
+	prod := others[0]
+	if prod.Name != "prod" || prod.Endpoint.String() != "https://api.prod.example.com:6443" || !prod.TLSConfig.InsecureSkipVerify {
+		t.Errorf("unexpected other cluster: %#v", prod)
+	}
+	if token, err := prod.TokenSource.Token(); err != nil || token != "file-token" {
+		t.Errorf("expected the token from the token file, got %q, %v", token, err)
+	}
+
+	current, others, err = Load(path, "prod", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.Name != "prod" || others != nil {
+		t.Errorf("expected only the selected context, got %#v, %#v", current, others)
+	}
+
+	if _, _, err := Load(path, "missing", false); err == nil {
+		t.Error("expected an error for an unknown context")
+	}
+}
+
+func TestLoadClientCertificate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "admin"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	config := fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: admin
+clusters:
+- name: cluster
+  cluster:
+    server: https://api.example.com:6443
+users:
+- name: admin
+  user:
+    client-certificate-data: %s
+    client-key-data: %s
+contexts:
+- name: admin
+  context:
+    cluster: cluster
+    user: admin
+`, base64.StdEncoding.EncodeToString(certPEM), base64.StdEncoding.EncodeToString(keyPEM))
+	path := filepath.Join(dir, "kubeconfig")
+	if err := ioutil.WriteFile(path, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	current, _, err := Load(path, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !current.ClientCertificate {
+		t.Error("expected the context to authenticate with a client certificate")
+	}
+
+	current, _, err = Load(writeKubeconfig(t, dir), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if current.ClientCertificate {
+		t.Error("expected the token context not to authenticate with a client certificate")
+	}
+}
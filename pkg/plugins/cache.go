@@ -0,0 +1,253 @@
+package plugins
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/proxy"
+	"github.com/openshift/console/pkg/serverutils"
+)
+
+const (
+	// assetFreshness is how long a cached asset is served without revalidating it with the plugin.
+	assetFreshness = time.Minute
+	// assetRevalidationTimeout bounds revalidating a cached asset, so that a slow plugin
+	// doesn't hold up serving it.
+	assetRevalidationTimeout = 10 * time.Second
+)
+
+// conditionalHeaders are request headers that are left out of requests for
+// cached assets, as the cache makes its own conditional requests.
+var conditionalHeaders = []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range", "Range"}
+
+// credentialHeaders are request headers that are left out of requests for
+// cached assets, as they are shared by all users.
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie"}
+
+// AssetCache is an in-memory LRU cache of plugin assets. Cached assets are
+// revalidated with their ETag or modification time, and served stale when
+// their plugin fails.
+type AssetCache struct {
+	maxSize      int64
+	maxEntrySize int64
+	freshness    time.Duration
+
+	lock sync.Mutex
+	size int64
+	// lru holds the *cachedAsset, most recently used first.
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type cachedAsset struct {
+	key       string
+	header    http.Header
+	body      []byte
+	validated time.Time
+}
+
+func (a *cachedAsset) size() int64 {
+	return int64(len(a.key) + len(a.body))
+}
+
+// NewAssetCache returns a cache holding up to maxSize bytes of assets, each of
+// at most maxEntrySize bytes.
+func NewAssetCache(maxSize, maxEntrySize int64) *AssetCache {
+	return &AssetCache{
+		maxSize:      maxSize,
+		maxEntrySize: maxEntrySize,
+		freshness:    assetFreshness,
+		lru:          list.New(),
+		entries:      make(map[string]*list.Element),
+	}
+}
+
+func (c *AssetCache) get(key string) *cachedAsset {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(element)
+	return element.Value.(*cachedAsset)
+}
+
+// put adds or replaces an asset, evicting the least recently used assets
+// beyond the size limit.
+func (c *AssetCache) put(asset *cachedAsset) {
+	if asset.size() > c.maxEntrySize || asset.size() > c.maxSize {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if element, ok := c.entries[asset.key]; ok {
+		c.remove(element)
+	}
+	c.entries[asset.key] = c.lru.PushFront(asset)
+	c.size += asset.size()
+	for c.size > c.maxSize {
+		c.remove(c.lru.Back())
+		consolePluginAssetCacheEvictionsTotal.Inc()
+	}
+	consolePluginAssetCacheSizeBytes.Set(float64(c.size))
+}
+
+func (c *AssetCache) remove(element *list.Element) {
+	asset := c.lru.Remove(element).(*cachedAsset)
+	delete(c.entries, asset.key)
+	c.size -= asset.size()
+}
+
+// serveCachedAsset serves a plugin asset from the cache, fetching or revalidating it with the
+// plugin as needed. Assets are cached by plugin, manifest hash and path, so that a new build of
+// a plugin doesn't get the assets of the previous one.
+func (p *PluginsHandler) serveCachedAsset(requestURL *url.URL, pluginName, assetPath string, w http.ResponseWriter, r *http.Request) {
+	manifestHash := ""
+	if p.ManifestChecker != nil {
+		manifestHash = p.ManifestChecker.ManifestHash(pluginName)
+	}
+	key := strings.Join([]string{pluginName, manifestHash, assetPath}, "/")
+	cached := p.AssetCache.get(key)
+	if cached != nil && time.Since(cached.validated) < p.AssetCache.freshness {
+		serveAsset(w, r, pluginName, cacheResultHit, cached)
+		return
+	}
+
+	ctx := r.Context()
+	if cached != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, assetRevalidationTimeout)
+		defer cancel()
+	}
+	newRequest, err := http.NewRequestWithContext(ctx, "GET", requestURL.String(), nil)
+	if err != nil {
+		sendPluginError(w, http.StatusInternalServerError, fmt.Sprintf("failed to create GET request for %q plugin: %v", pluginName, err))
+		return
+	}
+	proxy.CopyRequestHeaders(r, newRequest)
+	// Let the client decompress the asset, so that the cache holds it as is.
+	newRequest.Header.Del("Accept-Encoding")
+	for _, h := range conditionalHeaders {
+		newRequest.Header.Del(h)
+	}
+	for _, h := range credentialHeaders {
+		newRequest.Header.Del(h)
+	}
+	if cached != nil {
+		if etag := cached.header.Get("ETag"); etag != "" {
+			newRequest.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := cached.header.Get("Last-Modified"); lastModified != "" {
+			newRequest.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+
+	resp, err := p.Client.Do(newRequest)
+	if err != nil {
+		if cached != nil {
+			klog.Warningf("GET request for %q plugin failed, serving cached asset: %v", pluginName, err)
+			serveAsset(w, r, pluginName, cacheResultStale, cached)
+			return
+		}
+		sendPluginError(w, http.StatusBadGateway, fmt.Sprintf("GET request for %q plugin failed: %v", pluginName, err))
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		revalidated := *cached
+		revalidated.validated = time.Now()
+		p.AssetCache.put(&revalidated)
+		serveAsset(w, r, pluginName, cacheResultRevalidated, &revalidated)
+	case resp.StatusCode >= http.StatusInternalServerError && cached != nil:
+		klog.Warningf("GET request for %q plugin failed with %d status code, serving cached asset", pluginName, resp.StatusCode)
+		serveAsset(w, r, pluginName, cacheResultStale, cached)
+	case resp.StatusCode != http.StatusOK:
+		sendPluginError(w, resp.StatusCode, fmt.Sprintf("GET request for %q plugin failed with %d status code", pluginName, resp.StatusCode))
+	default:
+		proxy.FilterHeaders(resp)
+		// Read one byte more than fits in the cache, to tell whether the asset does.
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, p.AssetCache.maxEntrySize+1))
+		if err == nil && p.IntegrityVerifier.Enabled(pluginName) {
+			// Verifying needs the whole asset, even if it is too large to cache.
+			var rest []byte
+			rest, err = ioutil.ReadAll(resp.Body)
+			body = append(body, rest...)
+		}
+		if err != nil {
+			sendPluginError(w, http.StatusBadGateway, fmt.Sprintf("failed reading HTTP response body from %q plugin: %v", pluginName, err))
+			return
+		}
+		if err := p.IntegrityVerifier.Verify(r.Context(), pluginName, assetPath, body); err != nil {
+			serverutils.SendResponse(w, http.StatusBadGateway, serverutils.ApiError{Err: fmt.Sprintf("asset %s of %q plugin failed verification: %v", assetPath, pluginName, err)})
+			return
+		}
+		asset := &cachedAsset{key: key, header: resp.Header, body: body, validated: time.Now()}
+		if int64(len(body)) > p.AssetCache.maxEntrySize || !shareable(resp.Header) {
+			consolePluginAssetCacheRequestsTotal.WithLabelValues(pluginName, cacheResultBypass).Inc()
+			copyHeaders(w, resp.Header)
+			w.Write(body)
+			if _, err := io.Copy(w, resp.Body); err != nil {
+				klog.Errorf("failed sending HTTP response body from %q plugin: %v", pluginName, err)
+			}
+			return
+		}
+		p.AssetCache.put(asset)
+		serveAsset(w, r, pluginName, cacheResultMiss, asset)
+	}
+}
+
+// shareable reports whether a response may be cached for all users. Varying by
+// Accept-Encoding doesn't matter, as the cache always requests assets unencoded.
+func shareable(header http.Header) bool {
+	for _, directive := range strings.Split(strings.Join(header.Values("Cache-Control"), ","), ",") {
+		name := strings.ToLower(strings.TrimSpace(strings.SplitN(directive, "=", 2)[0]))
+		if name == "no-store" || name == "private" {
+			return false
+		}
+	}
+	for _, vary := range strings.Split(strings.Join(header.Values("Vary"), ","), ",") {
+		if vary = strings.TrimSpace(vary); vary != "" && !strings.EqualFold(vary, "Accept-Encoding") {
+			return false
+		}
+	}
+	return true
+}
+
+// serveAsset serves a cached asset, answering the client's conditional requests.
+func serveAsset(w http.ResponseWriter, r *http.Request, pluginName, result string, asset *cachedAsset) {
+	consolePluginAssetCacheRequestsTotal.WithLabelValues(pluginName, result).Inc()
+	copyHeaders(w, asset.header)
+	if result == cacheResultStale {
+		w.Header().Set("Warning", `110 - "Response is Stale"`)
+	}
+	// ServeContent sets the length itself, and would send the wrong one for ranges.
+	w.Header().Del("Content-Length")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(asset.body))
+}
+
+func copyHeaders(w http.ResponseWriter, header http.Header) {
+	for key, value := range header {
+		for _, v := range value {
+			w.Header().Add(key, v)
+		}
+	}
+}
+
+func sendPluginError(w http.ResponseWriter, code int, errMsg string) {
+	klog.Error(errMsg)
+	serverutils.SendResponse(w, code, serverutils.ApiError{Err: errMsg})
+}
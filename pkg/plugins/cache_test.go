@@ -0,0 +1,139 @@
+package plugins
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServeCachedAsset(t *testing.T) {
+	var requests, conditionalRequests int32
+	var down atomic.Value
+	down.Store(false)
+	pluginServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if down.Load().(bool) {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Content-Type", "application/javascript")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&conditionalRequests, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		fmt.Fprintf(w, "// %s", r.URL.Path)
+	}))
+	defer pluginServer.Close()
+
+	cache := NewAssetCache(256, 100)
+	handler := NewPluginsHandler(pluginServer.Client(), map[string]string{"my-plugin": pluginServer.URL + "/"}, "", nil, cache, nil)
+	get := func(assetPath string, header http.Header) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/my-plugin/"+assetPath, nil)
+		for key, value := range header {
+			r.Header[key] = value
+		}
+		r.URL.Path = "my-plugin/" + assetPath
+		handler.HandlePluginAssets(rr, r)
+		return rr
+	}
+
+	rr := get("main.js", nil)
+	if rr.Code != http.StatusOK || rr.Body.String() != "// /main.js" {
+		t.Fatalf("expected the asset, got %d %q", rr.Code, rr.Body.String())
+	}
+	rr = get("main.js", nil)
+	if rr.Code != http.StatusOK || rr.Body.String() != "// /main.js" || rr.Header().Get("Content-Type") != "application/javascript" {
+		t.Fatalf("expected the cached asset, got %d %q", rr.Code, rr.Body.String())
+	}
+	if requests != 1 {
+		t.Errorf("expected a fresh asset to be served from the cache, got %d plugin requests", requests)
+	}
+
+	rr = get("main.js", http.Header{"If-None-Match": {`"v1"`}})
+	if rr.Code != http.StatusNotModified {
+		t.Errorf("expected the client's conditional request to be answered, got %d", rr.Code)
+	}
+
+	cache.freshness = 0
+	rr = get("main.js", nil)
+	if rr.Code != http.StatusOK || rr.Body.String() != "// /main.js" || conditionalRequests != 1 {
+		t.Errorf("expected a stale asset to be revalidated, got %d %q after %d conditional requests", rr.Code, rr.Body.String(), conditionalRequests)
+	}
+
+	down.Store(true)
+	rr = get("main.js", nil)
+	if rr.Code != http.StatusOK || rr.Body.String() != "// /main.js" || rr.Header().Get("Warning") == "" {
+		t.Errorf("expected the stale asset during the outage, got %d %q", rr.Code, rr.Body.String())
+	}
+	rr = get("other.js", nil)
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected uncached assets to fail during the outage, got %d", rr.Code)
+	}
+	down.Store(false)
+
+	for i := 0; i < 20; i++ {
+		if rr = get(fmt.Sprintf("chunk-%d.js", i), nil); rr.Code != http.StatusOK {
+			t.Fatalf("expected chunk %d, got %d", i, rr.Code)
+		}
+	}
+	if cache.size > cache.maxSize {
+		t.Errorf("expected the cache to stay within %d bytes, got %d", cache.maxSize, cache.size)
+	}
+	if cache.get("my-plugin//main.js") != nil {
+		t.Error("expected the least recently used asset to be evicted")
+	}
+	if cache.get("my-plugin//chunk-19.js") == nil {
+		t.Error("expected the most recently used asset to be cached")
+	}
+}
+
+func TestAssetCacheEntrySizeLimit(t *testing.T) {
+	cache := NewAssetCache(1024, 100)
+	cache.put(&cachedAsset{key: "large", body: make([]byte, 200), validated: time.Now()})
+	if cache.get("large") != nil || cache.size != 0 {
+		t.Error("expected assets larger than the entry size limit not to be cached")
+	}
+}
+
+func TestServeCachedAssetBypass(t *testing.T) {
+	pluginServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != "" {
+			t.Errorf("expected the credentials of the user to be left out of requests for shared assets, got %v", r.Header)
+		}
+		switch r.URL.Path {
+		case "/private.js":
+			w.Header().Set("Cache-Control", "max-age=60, private")
+		case "/no-store.js":
+			w.Header().Set("Cache-Control", "No-Store")
+		case "/vary.js":
+			w.Header().Set("Vary", "Accept-Encoding, X-User")
+		case "/encoded.js":
+			w.Header().Set("Vary", "Accept-Encoding")
+		}
+		fmt.Fprintf(w, "// %s", r.URL.Path)
+	}))
+	defer pluginServer.Close()
+
+	cache := NewAssetCache(1024, 100)
+	handler := NewPluginsHandler(pluginServer.Client(), map[string]string{"my-plugin": pluginServer.URL + "/"}, "", nil, cache, nil)
+	for assetPath, cached := range map[string]bool{"private.js": false, "no-store.js": false, "vary.js": false, "encoded.js": true} {
+		rr := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/my-plugin/"+assetPath, nil)
+		r.Header.Set("Authorization", "Bearer user-token")
+		r.Header.Set("Cookie", "openshift-session-token=user-token")
+		r.URL.Path = "my-plugin/" + assetPath
+		handler.HandlePluginAssets(rr, r)
+		if rr.Code != http.StatusOK || rr.Body.String() != "// /"+assetPath {
+			t.Errorf("expected asset %s, got %d %q", assetPath, rr.Code, rr.Body.String())
+		}
+		if (cache.get("my-plugin//"+assetPath) != nil) != cached {
+			t.Errorf("expected asset %s to be cached: %t", assetPath, cached)
+		}
+	}
+}
@@ -6,14 +6,17 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	"k8s.io/klog"
 
+	"github.com/openshift/console/pkg/auth"
 	"github.com/openshift/console/pkg/proxy"
 	"github.com/openshift/console/pkg/serverconfig"
 	"github.com/openshift/console/pkg/serverutils"
@@ -24,12 +27,29 @@ type PluginsHandler struct {
 	Client             *http.Client
 	PluginsEndpointMap map[string]string
 	PublicDir          string
+	// ManifestChecker, if set, tells which plugins are excluded as incompatible.
+	ManifestChecker *ManifestChecker
+	// AssetCache, if set, caches the plugin assets.
+	AssetCache *AssetCache
+	// IntegrityVerifier, if set, refuses plugin assets that don't match their declared digests.
+	IntegrityVerifier *IntegrityVerifier
 }
 
 type PluginsProxyServiceHandler struct {
 	ConsoleEndpoint string
 	ProxyConfig     *proxy.Config
 	Authorize       bool
+	// Authorization is the authorization mode of the service. When empty,
+	// Authorize tells whether users must be logged in.
+	Authorization string
+	Headers       map[string]string
+	Timeout       time.Duration
+	pathRewrites  []pathRewrite
+	// ServiceAccountTokenSource supplies the service's own token with the
+	// ServiceAccount authorization mode, and UserInfoResolver the identity
+	// of users it is told.
+	ServiceAccountTokenSource auth.TokenSource
+	UserInfoResolver          *auth.UserInfoResolver
 }
 
 func NewPluginsProxyServiceHandler(consoleEndpoint string, serviceEndpoint *url.URL, tlsClientConfig *tls.Config, authorize bool) *PluginsProxyServiceHandler {
@@ -44,11 +64,14 @@ func NewPluginsProxyServiceHandler(consoleEndpoint string, serviceEndpoint *url.
 	}
 }
 
-func NewPluginsHandler(client *http.Client, pluginsEndpointMap map[string]string, publicDir string) *PluginsHandler {
+func NewPluginsHandler(client *http.Client, pluginsEndpointMap map[string]string, publicDir string, manifestChecker *ManifestChecker, assetCache *AssetCache, integrityVerifier *IntegrityVerifier) *PluginsHandler {
 	return &PluginsHandler{
 		Client:             client,
 		PluginsEndpointMap: pluginsEndpointMap,
 		PublicDir:          publicDir,
+		ManifestChecker:    manifestChecker,
+		AssetCache:         assetCache,
+		IntegrityVerifier:  integrityVerifier,
 	}
 }
 
@@ -63,7 +86,7 @@ func ParsePluginProxyConfig(proxyConfig string) (*serverconfig.Proxy, error) {
 	return pluginProxy, nil
 }
 
-func GetPluginProxyServiceHandlers(proxyConfig *serverconfig.Proxy, defaultTLSConfig *tls.Config, pluginProxyEndpoint string) ([]*PluginsProxyServiceHandler, error) {
+func GetPluginProxyServiceHandlers(proxyConfig *serverconfig.Proxy, defaultTLSConfig *tls.Config, pluginProxyEndpoint string, userInfoResolver *auth.UserInfoResolver) ([]*PluginsProxyServiceHandler, error) {
 	var proxyServiceHandlers []*PluginsProxyServiceHandler
 	for _, service := range proxyConfig.Services {
 		pluginProxyTLS := defaultTLSConfig.Clone()
@@ -85,7 +108,13 @@ func GetPluginProxyServiceHandlers(proxyConfig *serverconfig.Proxy, defaultTLSCo
 			klog.Error(errMsg)
 			return nil, fmt.Errorf(errMsg)
 		}
-		proxyServiceHandlers = append(proxyServiceHandlers, NewPluginsProxyServiceHandler(service.ConsoleAPIPath, serviceEndpoint, pluginProxyTLS, service.Authorize))
+		proxyServiceHandler := NewPluginsProxyServiceHandler(service.ConsoleAPIPath, serviceEndpoint, pluginProxyTLS, service.Authorize)
+		if err := proxyServiceHandler.configure(service); err != nil {
+			klog.Error(err)
+			return nil, err
+		}
+		proxyServiceHandler.UserInfoResolver = userInfoResolver
+		proxyServiceHandlers = append(proxyServiceHandlers, proxyServiceHandler)
 	}
 	return proxyServiceHandlers, nil
 }
@@ -124,9 +153,10 @@ func (p *PluginsHandler) HandleI18nResources(w http.ResponseWriter, r *http.Requ
 		serverutils.SendResponse(w, http.StatusBadGateway, serverutils.ApiError{Err: errMsg})
 		return
 	}
-	pluginServiceRequestURL.Path = path.Join(pluginServiceRequestURL.Path, "locales", lang, fmt.Sprintf("%s.json", namespace))
+	localePath := path.Join("locales", lang, fmt.Sprintf("%s.json", namespace))
+	pluginServiceRequestURL.Path = path.Join(pluginServiceRequestURL.Path, localePath)
 
-	p.proxyPluginRequest(pluginServiceRequestURL, pluginName, w, r)
+	p.proxyPluginRequest(pluginServiceRequestURL, pluginName, localePath, w, r)
 }
 
 func (p *PluginsHandler) HandlePluginAssets(w http.ResponseWriter, r *http.Request) {
@@ -145,11 +175,15 @@ func (p *PluginsHandler) HandlePluginAssets(w http.ResponseWriter, r *http.Reque
 	}
 	pluginServiceRequestURL.Path = path.Join(pluginServiceRequestURL.Path, pluginAssetPath)
 
-	p.proxyPluginRequest(pluginServiceRequestURL, pluginName, w, r)
+	if p.AssetCache != nil {
+		p.serveCachedAsset(pluginServiceRequestURL, pluginName, pluginAssetPath, w, r)
+		return
+	}
+	p.proxyPluginRequest(pluginServiceRequestURL, pluginName, pluginAssetPath, w, r)
 }
 
-func (p *PluginsHandler) proxyPluginRequest(requestURL *url.URL, pluginName string, w http.ResponseWriter, orignalRequest *http.Request) {
-	newRequest, err := http.NewRequest("GET", requestURL.String(), nil)
+func (p *PluginsHandler) proxyPluginRequest(requestURL *url.URL, pluginName, assetPath string, w http.ResponseWriter, orignalRequest *http.Request) {
+	newRequest, err := http.NewRequestWithContext(orignalRequest.Context(), "GET", requestURL.String(), nil)
 	if err != nil {
 		errMsg := fmt.Sprintf("failed to create GET request for %q plugin: %v", pluginName, err)
 		klog.Error(errMsg)
@@ -158,6 +192,14 @@ func (p *PluginsHandler) proxyPluginRequest(requestURL *url.URL, pluginName stri
 	}
 
 	proxy.CopyRequestHeaders(orignalRequest, newRequest)
+	verify := p.IntegrityVerifier.Enabled(pluginName)
+	if verify {
+		// The whole asset is needed to verify it.
+		newRequest.Header.Del("Accept-Encoding")
+		for _, h := range conditionalHeaders {
+			newRequest.Header.Del(h)
+		}
+	}
 
 	resp, err := p.Client.Do(newRequest)
 	if err != nil {
@@ -177,6 +219,22 @@ func (p *PluginsHandler) proxyPluginRequest(requestURL *url.URL, pluginName stri
 
 	// filter unwanted headers from the response
 	proxy.FilterHeaders(resp)
+
+	if verify {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			sendPluginError(w, http.StatusBadGateway, fmt.Sprintf("failed reading HTTP response body from %q plugin: %v", pluginName, err))
+			return
+		}
+		if err := p.IntegrityVerifier.Verify(orignalRequest.Context(), pluginName, assetPath, body); err != nil {
+			serverutils.SendResponse(w, http.StatusBadGateway, serverutils.ApiError{Err: fmt.Sprintf("asset %s of %q plugin failed verification: %v", assetPath, pluginName, err)})
+			return
+		}
+		copyHeaders(w, resp.Header)
+		w.Write(body)
+		return
+	}
+
 	// copy headers from the plugin's server response
 	for key, value := range resp.Header {
 		for _, v := range value {
@@ -201,6 +259,9 @@ func (p *PluginsHandler) HandleCheckUpdates(w http.ResponseWriter, r *http.Reque
 	}
 	pluginsList := make([]string, 0, len(p.PluginsEndpointMap))
 	for k := range p.PluginsEndpointMap {
+		if p.ManifestChecker != nil && p.ManifestChecker.IsExcluded(k) {
+			continue
+		}
 		pluginsList = append(pluginsList, k)
 	}
 	serverutils.SendResponse(w, http.StatusOK, struct {
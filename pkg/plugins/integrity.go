@@ -0,0 +1,295 @@
+package plugins
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+
+	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/serverconfig"
+)
+
+// ManifestSignatureFile is where plugins with a signed manifest serve its signature.
+const ManifestSignatureFile = ManifestFile + ".sig"
+
+type pluginIntegrity struct {
+	digests        map[string]string
+	publicKey      crypto.PublicKey
+	requireDigests bool
+}
+
+// IntegrityVerifier verifies the assets of plugins against the digests
+// declared for them, either in the console configuration or in a signed
+// plugin manifest.
+type IntegrityVerifier struct {
+	client             *http.Client
+	pluginsEndpointMap map[string]string
+	plugins            map[string]*pluginIntegrity
+
+	// signedDigests are the asset digests of the last verified manifest of
+	// each plugin with a signed manifest.
+	signedDigestsLock sync.RWMutex
+	signedDigests     map[string]map[string]string
+}
+
+// ParsePluginIntegrityConfig parses the plugin integrity configuration, a JSON object by plugin name.
+func ParsePluginIntegrityConfig(config string) (map[string]serverconfig.PluginIntegrity, error) {
+	pluginIntegrity := map[string]serverconfig.PluginIntegrity{}
+	if err := json.Unmarshal([]byte(config), &pluginIntegrity); err != nil {
+		return nil, fmt.Errorf("error unmarshaling ConsoleConfig pluginIntegrity field: %v", err)
+	}
+	return pluginIntegrity, nil
+}
+
+func NewIntegrityVerifier(client *http.Client, pluginsEndpointMap map[string]string, config map[string]serverconfig.PluginIntegrity) (*IntegrityVerifier, error) {
+	plugins := make(map[string]*pluginIntegrity, len(config))
+	for name, integrity := range config {
+		digests := make(map[string]string, len(integrity.Digests))
+		for assetPath, digest := range integrity.Digests {
+			if _, _, err := parseDigest(digest); err != nil {
+				return nil, fmt.Errorf("invalid digest of asset %s of plugin %s: %v", assetPath, name, err)
+			}
+			digests[cleanAssetPath(assetPath)] = digest
+		}
+		plugin := &pluginIntegrity{
+			digests:        digests,
+			requireDigests: integrity.RequireDigests == nil || *integrity.RequireDigests,
+		}
+		if integrity.PublicKey != "" {
+			publicKey, err := parsePublicKey(integrity.PublicKey)
+			if err != nil {
+				return nil, fmt.Errorf("invalid public key of plugin %s: %v", name, err)
+			}
+			plugin.publicKey = publicKey
+		}
+		plugins[name] = plugin
+	}
+	return &IntegrityVerifier{
+		client:             client,
+		pluginsEndpointMap: pluginsEndpointMap,
+		plugins:            plugins,
+		signedDigests:      make(map[string]map[string]string),
+	}, nil
+}
+
+// Enabled tells whether the assets of the plugin are verified.
+func (v *IntegrityVerifier) Enabled(pluginName string) bool {
+	if v == nil {
+		return false
+	}
+	_, ok := v.plugins[pluginName]
+	return ok
+}
+
+// Verify returns an error if the asset of the plugin doesn't match its
+// declared digest. Violations are logged and counted.
+func (v *IntegrityVerifier) Verify(ctx context.Context, pluginName, assetPath string, body []byte) error {
+	if !v.Enabled(pluginName) {
+		return nil
+	}
+	if err := v.verify(ctx, pluginName, assetPath, body); err != nil {
+		klog.Errorf("Integrity violation of asset %s of plugin %q: %v", assetPath, pluginName, err)
+		consolePluginIntegrityViolationsTotal.WithLabelValues(pluginName).Inc()
+		return err
+	}
+	return nil
+}
+
+func (v *IntegrityVerifier) verify(ctx context.Context, pluginName, assetPath string, body []byte) error {
+	plugin := v.plugins[pluginName]
+	// The asset is fetched from the cleaned path, so its digest is looked up by it too.
+	assetPath = cleanAssetPath(assetPath)
+
+	if plugin.publicKey != nil && assetPath == ManifestFile {
+		return v.verifyManifest(ctx, pluginName, plugin, body)
+	}
+
+	digest := plugin.digests[assetPath]
+	if digest == "" && plugin.publicKey != nil {
+		signedDigests, err := v.getSignedDigests(ctx, pluginName, plugin)
+		if err != nil {
+			return err
+		}
+		digest = signedDigests[assetPath]
+	}
+	if digest == "" {
+		if plugin.requireDigests {
+			return fmt.Errorf("no digest is declared for the asset")
+		}
+		return nil
+	}
+	return checkDigest(digest, body)
+}
+
+// verifyManifest checks the signature of the plugin's manifest and remembers
+// the digests it declares.
+func (v *IntegrityVerifier) verifyManifest(ctx context.Context, pluginName string, plugin *pluginIntegrity, manifest []byte) error {
+	if digest := plugin.digests[ManifestFile]; digest != "" {
+		if err := checkDigest(digest, manifest); err != nil {
+			return err
+		}
+	}
+	signature, err := v.fetch(ctx, pluginName, ManifestSignatureFile)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the manifest signature: %v", err)
+	}
+	decodedSignature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("invalid manifest signature: %v", err)
+	}
+	if err := verifySignature(plugin.publicKey, manifest, decodedSignature); err != nil {
+		return err
+	}
+
+	var signed struct {
+		Integrity map[string]string `json:"integrity"`
+	}
+	if err := json.Unmarshal(manifest, &signed); err != nil {
+		return fmt.Errorf("invalid manifest: %v", err)
+	}
+	signedDigests := make(map[string]string, len(signed.Integrity))
+	for assetPath, digest := range signed.Integrity {
+		signedDigests[cleanAssetPath(assetPath)] = digest
+	}
+	v.signedDigestsLock.Lock()
+	v.signedDigests[pluginName] = signedDigests
+	v.signedDigestsLock.Unlock()
+	return nil
+}
+
+// getSignedDigests returns the digests of the plugin's signed manifest,
+// fetching and verifying the manifest if it hasn't been yet.
+func (v *IntegrityVerifier) getSignedDigests(ctx context.Context, pluginName string, plugin *pluginIntegrity) (map[string]string, error) {
+	v.signedDigestsLock.RLock()
+	signedDigests, ok := v.signedDigests[pluginName]
+	v.signedDigestsLock.RUnlock()
+	if ok {
+		return signedDigests, nil
+	}
+
+	manifest, err := v.fetch(ctx, pluginName, ManifestFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the manifest: %v", err)
+	}
+	if err := v.verifyManifest(ctx, pluginName, plugin, manifest); err != nil {
+		return nil, err
+	}
+	v.signedDigestsLock.RLock()
+	defer v.signedDigestsLock.RUnlock()
+	return v.signedDigests[pluginName], nil
+}
+
+func (v *IntegrityVerifier) fetch(ctx context.Context, pluginName, assetPath string) ([]byte, error) {
+	requestURL, err := url.Parse(v.pluginsEndpointMap[pluginName])
+	if err != nil {
+		return nil, err
+	}
+	requestURL.Path = path.Join(requestURL.Path, assetPath)
+	req, err := http.NewRequestWithContext(ctx, "GET", requestURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("request failed with %d status code", resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// cleanAssetPath returns the path of an asset relative to the plugin's base
+// URL, like the path.Join of the request URL resolves it.
+func cleanAssetPath(assetPath string) string {
+	return strings.TrimPrefix(path.Clean("/"+assetPath), "/")
+}
+
+// parseDigest parses a digest in the subresource integrity format.
+func parseDigest(digest string) (hash.Hash, []byte, error) {
+	algorithm, encoded := "", ""
+	if i := strings.Index(digest, "-"); i != -1 {
+		algorithm, encoded = digest[:i], digest[i+1:]
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid digest %q: %v", digest, err)
+	}
+	switch algorithm {
+	case "sha256":
+		return sha256.New(), decoded, nil
+	case "sha384":
+		return sha512.New384(), decoded, nil
+	case "sha512":
+		return sha512.New(), decoded, nil
+	default:
+		return nil, nil, fmt.Errorf("invalid digest %q: the algorithm must be one of sha256, sha384, sha512", digest)
+	}
+}
+
+func checkDigest(digest string, body []byte) error {
+	h, expected, err := parseDigest(digest)
+	if err != nil {
+		return err
+	}
+	h.Write(body)
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return fmt.Errorf("the content doesn't match the digest %s", digest)
+	}
+	return nil
+}
+
+func parsePublicKey(publicKeyPEM string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch publicKey.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey, *rsa.PublicKey:
+		return publicKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", publicKey)
+	}
+}
+
+// verifySignature verifies an Ed25519 signature of the message, or an ECDSA or RSA PKCS #1 v1.5
+// signature of its SHA-256 digest.
+func verifySignature(publicKey crypto.PublicKey, message, signature []byte) error {
+	digest := sha256.Sum256(message)
+	valid := false
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(key, message, signature)
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(key, digest[:], signature)
+	case *rsa.PublicKey:
+		valid = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	}
+	if !valid {
+		return fmt.Errorf("the manifest signature is invalid")
+	}
+	return nil
+}
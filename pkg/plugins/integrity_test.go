@@ -0,0 +1,111 @@
+package plugins
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openshift/console/pkg/serverconfig"
+)
+
+func sriDigest(content string) string {
+	digest := sha256.Sum256([]byte(content))
+	return "sha256-" + base64.StdEncoding.EncodeToString(digest[:])
+}
+
+func TestIntegrityVerifier(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKeyDER}))
+
+	entry := "console.log('entry')"
+	chunk := "console.log('chunk')"
+	signedManifest := fmt.Sprintf(`{"name": "signed", "integrity": {"plugin-entry.js": %q}}`, sriDigest(entry))
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(signedManifest)))
+	assets := map[string]string{
+		"/declared/plugin-entry.js":        entry,
+		"/declared/chunk.js":               chunk,
+		"/tampered/plugin-entry.js":        "stealSession()",
+		"/strict/chunk.js":                 chunk,
+		"/signed/" + ManifestFile:          signedManifest,
+		"/signed/" + ManifestSignatureFile: signature,
+		"/signed/plugin-entry.js":          entry,
+		"/forged/" + ManifestFile:          `{"name": "forged", "integrity": {}}`,
+		"/forged/" + ManifestSignatureFile: signature,
+		"/forged/plugin-entry.js":          entry,
+		"/unverified/plugin-entry.js":      "anything",
+	}
+	pluginServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asset, ok := assets[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, asset)
+	}))
+	defer pluginServer.Close()
+
+	pluginsEndpointMap := map[string]string{}
+	for _, name := range []string{"declared", "tampered", "strict", "signed", "forged", "unverified"} {
+		pluginsEndpointMap[name] = pluginServer.URL + "/" + name + "/"
+	}
+	// Digests are required unless a plugin opts out, like "declared".
+	requireDigests := false
+	verifier, err := NewIntegrityVerifier(pluginServer.Client(), pluginsEndpointMap, map[string]serverconfig.PluginIntegrity{
+		"declared": {Digests: map[string]string{"./plugin-entry.js": sriDigest(entry)}, RequireDigests: &requireDigests},
+		"tampered": {Digests: map[string]string{"plugin-entry.js": sriDigest(entry)}},
+		"strict":   {Digests: map[string]string{"plugin-entry.js": sriDigest(entry)}},
+		"signed":   {PublicKey: publicKeyPEM},
+		"forged":   {PublicKey: publicKeyPEM},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		asset    string
+		expected int
+	}{
+		{asset: "declared/plugin-entry.js", expected: http.StatusOK},
+		{asset: "declared/chunk.js", expected: http.StatusOK},
+		{asset: "tampered/plugin-entry.js", expected: http.StatusBadGateway},
+		// The plugin serves the same asset, so it is verified the same.
+		{asset: "tampered/plugin-entry.js/", expected: http.StatusBadGateway},
+		{asset: "tampered/./plugin-entry.js", expected: http.StatusBadGateway},
+		{asset: "strict/chunk.js", expected: http.StatusBadGateway},
+		{asset: "signed/plugin-entry.js", expected: http.StatusOK},
+		{asset: "signed/" + ManifestFile, expected: http.StatusOK},
+		{asset: "forged/" + ManifestFile, expected: http.StatusBadGateway},
+		{asset: "forged/plugin-entry.js", expected: http.StatusBadGateway},
+		{asset: "unverified/plugin-entry.js", expected: http.StatusOK},
+	}
+	for _, cache := range []*AssetCache{nil, NewAssetCache(1024, 1024)} {
+		handler := NewPluginsHandler(pluginServer.Client(), pluginsEndpointMap, "", nil, cache, verifier)
+		for _, tt := range tests {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest("GET", "/api/plugins/"+tt.asset, nil)
+			r.URL.Path = tt.asset
+			handler.HandlePluginAssets(rr, r)
+			if rr.Code != tt.expected {
+				t.Errorf("expected status %d for %s with cache %t, got %d", tt.expected, tt.asset, cache != nil, rr.Code)
+			}
+		}
+	}
+
+	if _, err := NewIntegrityVerifier(nil, nil, map[string]serverconfig.PluginIntegrity{"bad": {Digests: map[string]string{"plugin-entry.js": "md5-abc"}}}); err == nil {
+		t.Error("expected an unsupported digest algorithm to be rejected")
+	}
+}
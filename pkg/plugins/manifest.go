@@ -0,0 +1,188 @@
+package plugins
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+const (
+	// ManifestFile is the manifest every plugin serves at the root of its endpoint.
+	ManifestFile = "plugin-manifest.json"
+	// PluginAPIDependency is the dependency of plugins on the console's plugin API. Its version
+	// range is checked against the console version.
+	PluginAPIDependency = "@console/pluginAPI"
+)
+
+// Manifest is the plugin-manifest.json of a plugin, as built by the dynamic plugin SDK.
+type Manifest struct {
+	Name                 string            `json:"name"`
+	Version              string            `json:"version"`
+	DisplayName          string            `json:"displayName,omitempty"`
+	Description          string            `json:"description,omitempty"`
+	Dependencies         map[string]string `json:"dependencies"`
+	DisableStaticPlugins []string          `json:"disableStaticPlugins,omitempty"`
+	Extensions           []Extension       `json:"extensions"`
+}
+
+// Extension is an extension contributed by a plugin.
+type Extension struct {
+	Type       string                 `json:"type"`
+	Properties map[string]interface{} `json:"properties"`
+	Flags      *ExtensionFlags        `json:"flags,omitempty"`
+}
+
+// ExtensionFlags gate an extension on feature flags.
+type ExtensionFlags struct {
+	Required   []string `json:"required,omitempty"`
+	Disallowed []string `json:"disallowed,omitempty"`
+}
+
+// knownExtensionTypes are the extension types of the dynamic plugin SDK, see
+// frontend/packages/console-dynamic-plugin-sdk/src/extensions.
+var knownExtensionTypes = map[string]bool{
+	"console.action/filter":                                    true,
+	"console.action/group":                                     true,
+	"console.action/provider":                                  true,
+	"console.action/resource-provider":                         true,
+	"console.alert-action":                                     true,
+	"console.catalog/item-filter":                              true,
+	"console.catalog/item-metadata":                            true,
+	"console.catalog/item-provider":                            true,
+	"console.catalog/item-type":                                true,
+	"console.catalog/item-type-metadata":                       true,
+	"console.cluster-overview/inventory-item":                  true,
+	"console.cluster-overview/multiline-utilization-item":      true,
+	"console.cluster-overview/utilization-item":                true,
+	"console.context-provider":                                 true,
+	"console.dashboards/card":                                  true,
+	"console.dashboards/overview/activity/resource":            true,
+	"console.dashboards/overview/detail/item":                  true,
+	"console.dashboards/overview/health/operator":              true,
+	"console.dashboards/overview/health/prometheus":            true,
+	"console.dashboards/overview/health/resource":              true,
+	"console.dashboards/overview/health/url":                   true,
+	"console.dashboards/overview/inventory/item":               true,
+	"console.dashboards/overview/inventory/item/group":         true,
+	"console.dashboards/overview/inventory/item/replacement":   true,
+	"console.dashboards/overview/prometheus/activity/resource": true,
+	"console.dashboards/project/overview/item":                 true,
+	"console.dashboards/tab":                                   true,
+	"console.file-upload":                                      true,
+	"console.flag":                                             true,
+	"console.flag/hookProvider":                                true,
+	"console.flag/model":                                       true,
+	"console.global-config":                                    true,
+	"console.model-metadata":                                   true,
+	"console.navigation/href":                                  true,
+	"console.navigation/resource-cluster":                      true,
+	"console.navigation/resource-ns":                           true,
+	"console.navigation/section":                               true,
+	"console.navigation/separator":                             true,
+	"console.page/resource/details":                            true,
+	"console.page/resource/list":                               true,
+	"console.page/resource/tab":                                true,
+	"console.page/route":                                       true,
+	"console.page/route/standalone":                            true,
+	"console.perspective":                                      true,
+	"console.pvc/alert":                                        true,
+	"console.pvc/create-prop":                                  true,
+	"console.pvc/delete":                                       true,
+	"console.pvc/status":                                       true,
+	"console.redux-reducer":                                    true,
+	"console.resource/create":                                  true,
+	"console.storage-provider":                                 true,
+	"console.tab/horizontalNav":                                true,
+	"console.telemetry/listener":                               true,
+	"console.topology/adapter/build":                           true,
+	"console.topology/adapter/network":                         true,
+	"console.topology/adapter/pod":                             true,
+	"console.topology/component/factory":                       true,
+	"console.topology/create/connector":                        true,
+	"console.topology/data/factory":                            true,
+	"console.topology/decorator/provider":                      true,
+	"console.topology/details/resource-alert":                  true,
+	"console.topology/details/resource-link":                   true,
+	"console.topology/details/tab":                             true,
+	"console.topology/details/tab-section":                     true,
+	"console.topology/display/filters":                         true,
+	"console.topology/relationship/provider":                   true,
+	"console.user-preference/group":                            true,
+	"console.user-preference/item":                             true,
+	"console.yaml-template":                                    true,
+	"dev-console.add/action":                                   true,
+	"dev-console.add/action-group":                             true,
+	"dev-console.import/environment":                           true,
+}
+
+// ParseManifest parses and validates the manifest of the plugin with the
+// given name, which is the name of its ConsolePlugin resource.
+func ParseManifest(data []byte, pluginName string) (*Manifest, error) {
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	if manifest.Name != pluginName {
+		return nil, fmt.Errorf("manifest name %q doesn't match the plugin name %q", manifest.Name, pluginName)
+	}
+	if _, err := semver.StrictNewVersion(manifest.Version); err != nil {
+		return nil, fmt.Errorf("manifest version %q is not a semantic version: %v", manifest.Version, err)
+	}
+	if manifest.Extensions == nil {
+		return nil, fmt.Errorf("manifest has no extensions list")
+	}
+	for i, extension := range manifest.Extensions {
+		if extension.Type == "" {
+			return nil, fmt.Errorf("extension %d has no type", i)
+		}
+		if !knownExtensionTypes[extension.Type] {
+			return nil, fmt.Errorf("extension %d has unknown type %q", i, extension.Type)
+		}
+	}
+	return manifest, nil
+}
+
+// checkDependencies returns why the plugin of the manifest is incompatible with the console
+// or the other plugins, or nil if it is compatible. manifests holds the valid manifests of the
+// enabled plugins, excluded the reasons plugins are excluded for. The plugin API dependency is
+// ignored when the console version is unknown.
+func checkDependencies(manifest *Manifest, consoleVersion *semver.Version, manifests map[string]*Manifest, excluded map[string]string) error {
+	dependencies := make([]string, 0, len(manifest.Dependencies))
+	for dependency := range manifest.Dependencies {
+		dependencies = append(dependencies, dependency)
+	}
+	sort.Strings(dependencies)
+
+	for _, dependency := range dependencies {
+		versionRange := manifest.Dependencies[dependency]
+		constraint, err := semver.NewConstraint(versionRange)
+		if err != nil {
+			return fmt.Errorf("invalid version range %q of dependency %s: %v", versionRange, dependency, err)
+		}
+
+		if dependency == PluginAPIDependency {
+			if consoleVersion != nil && !constraint.Check(consoleVersion) {
+				return fmt.Errorf("requires console version %s, but it is %s", versionRange, consoleVersion)
+			}
+			continue
+		}
+
+		dependencyManifest := manifests[dependency]
+		if dependencyManifest == nil {
+			return fmt.Errorf("depends on plugin %s, which isn't enabled or has no valid manifest", dependency)
+		}
+		if _, ok := excluded[dependency]; ok {
+			return fmt.Errorf("depends on plugin %s, which is excluded", dependency)
+		}
+		dependencyVersion, err := semver.NewVersion(dependencyManifest.Version)
+		if err != nil {
+			return fmt.Errorf("depends on plugin %s, which has invalid version %q", dependency, dependencyManifest.Version)
+		}
+		if !constraint.Check(dependencyVersion) {
+			return fmt.Errorf("requires plugin %s version %s, but it is %s", dependency, versionRange, dependencyVersion)
+		}
+	}
+	return nil
+}
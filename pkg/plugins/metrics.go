@@ -0,0 +1,65 @@
+package plugins
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	consolePluginAssetCacheRequestsTotalMetric  = "console_plugin_asset_cache_requests_total"
+	consolePluginAssetCacheEvictionsTotalMetric = "console_plugin_asset_cache_evictions_total"
+	consolePluginAssetCacheSizeBytesMetric      = "console_plugin_asset_cache_size_bytes"
+	consolePluginIntegrityViolationsTotalMetric = "console_plugin_integrity_violations_total"
+
+	consolePluginNameLabel   = "plugin"
+	consolePluginResultLabel = "result"
+)
+
+// Results of plugin asset requests in metrics.
+const (
+	// The asset was served from the cache without asking the plugin.
+	cacheResultHit = "hit"
+	// The plugin confirmed the cached asset is still current.
+	cacheResultRevalidated = "revalidated"
+	// The asset was fetched from the plugin.
+	cacheResultMiss = "miss"
+	// The plugin failed and the cached asset was served anyway.
+	cacheResultStale = "stale"
+	// The asset was fetched from the plugin but can't be cached.
+	cacheResultBypass = "bypass"
+)
+
+var (
+	consolePluginAssetCacheRequestsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: consolePluginAssetCacheRequestsTotalMetric,
+			Help: "Number of plugin asset requests by plugin and cache result.",
+		},
+		[]string{consolePluginNameLabel, consolePluginResultLabel},
+	)
+	consolePluginAssetCacheEvictionsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: consolePluginAssetCacheEvictionsTotalMetric,
+			Help: "Number of plugin assets evicted from the cache to stay within its size limit.",
+		},
+	)
+	consolePluginAssetCacheSizeBytes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: consolePluginAssetCacheSizeBytesMetric,
+			Help: "Size of the plugin assets in the cache.",
+		},
+	)
+	consolePluginIntegrityViolationsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: consolePluginIntegrityViolationsTotalMetric,
+			Help: "Number of plugin assets refused because they don't match their declared digest, by plugin.",
+		},
+		[]string{consolePluginNameLabel},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(consolePluginAssetCacheRequestsTotal)
+	prometheus.MustRegister(consolePluginAssetCacheEvictionsTotal)
+	prometheus.MustRegister(consolePluginAssetCacheSizeBytes)
+	prometheus.MustRegister(consolePluginIntegrityViolationsTotal)
+}
@@ -0,0 +1,122 @@
+package plugins
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/serverconfig"
+	"github.com/openshift/console/pkg/serverutils"
+)
+
+type pathRewrite struct {
+	from *regexp.Regexp
+	to   string
+}
+
+// configure applies the authorization mode, headers, timeout and path rewrites of the service.
+func (h *PluginsProxyServiceHandler) configure(service serverconfig.ProxyService) error {
+	switch service.Authorization {
+	case "", serverconfig.ProxyAuthorizationNone, serverconfig.ProxyAuthorizationUserToken, serverconfig.ProxyAuthorizationServiceAccount:
+		h.Authorization = service.Authorization
+	default:
+		return fmt.Errorf("invalid authorization %q of %s service, must be one of: %s, %s, %s", service.Authorization, service.Endpoint,
+			serverconfig.ProxyAuthorizationNone, serverconfig.ProxyAuthorizationUserToken, serverconfig.ProxyAuthorizationServiceAccount)
+	}
+	h.Headers = service.Headers
+	if service.Timeout != "" {
+		timeout, err := time.ParseDuration(service.Timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %q of %s service: %v", service.Timeout, service.Endpoint, err)
+		}
+		h.Timeout = timeout
+	}
+	if service.Authorization == serverconfig.ProxyAuthorizationServiceAccount {
+		if service.ServiceAccountTokenFile == "" {
+			return fmt.Errorf("%s service must set serviceAccountTokenFile with the %s authorization", service.Endpoint, serverconfig.ProxyAuthorizationServiceAccount)
+		}
+		tokenSource, err := auth.NewFileTokenSource(service.ServiceAccountTokenFile)
+		if err != nil {
+			return fmt.Errorf("failed to read the service account token of %s service: %v", service.Endpoint, err)
+		}
+		h.ServiceAccountTokenSource = tokenSource
+	}
+	for _, rewrite := range service.PathRewrites {
+		from, err := regexp.Compile(rewrite.From)
+		if err != nil {
+			return fmt.Errorf("invalid path rewrite %q of %s service: %v", rewrite.From, service.Endpoint, err)
+		}
+		h.pathRewrites = append(h.pathRewrites, pathRewrite{from: from, to: rewrite.To})
+	}
+	return nil
+}
+
+// RequiresUser tells whether requests to the service need a logged in user.
+func (h *PluginsProxyServiceHandler) RequiresUser() bool {
+	return h.Authorization == serverconfig.ProxyAuthorizationUserToken || h.Authorization == serverconfig.ProxyAuthorizationServiceAccount
+}
+
+// ProxyRequest proxies the request to the service with serviceProxy, authorized
+// as configured for the service. The user is nil unless RequiresUser.
+func (h *PluginsProxyServiceHandler) ProxyRequest(serviceProxy http.Handler, user *auth.User, w http.ResponseWriter, r *http.Request) {
+	if h.Timeout > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), h.Timeout)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	for _, rewrite := range h.pathRewrites {
+		if rewrite.from.MatchString(r.URL.Path) {
+			r.URL.Path = rewrite.from.ReplaceAllString(r.URL.Path, rewrite.to)
+			r.URL.RawPath = ""
+			break
+		}
+	}
+
+	if h.RequiresUser() {
+		// Only bridge decides who the service sees the request from.
+		r.Header.Del("Authorization")
+		for header := range r.Header {
+			if strings.HasPrefix(header, "Impersonate-") {
+				r.Header.Del(header)
+			}
+		}
+	}
+	switch h.Authorization {
+	case serverconfig.ProxyAuthorizationUserToken:
+		r.Header.Set("Authorization", "Bearer "+user.Token)
+	case serverconfig.ProxyAuthorizationServiceAccount:
+		token, err := h.ServiceAccountTokenSource.Token()
+		if err != nil {
+			klog.Errorf("failed to get service account token: %v", err)
+			serverutils.SendResponse(w, http.StatusInternalServerError, serverutils.ApiError{Err: "Failed to get the service account token of the service"})
+			return
+		}
+		username, groups := user.Username, user.Groups
+		if username == "" {
+			userInfo, err := h.UserInfoResolver.ResolveIdentity(r.Context(), user.Token)
+			if err != nil {
+				klog.Errorf("failed to resolve user info: %v", err)
+				serverutils.SendResponse(w, http.StatusBadGateway, serverutils.ApiError{Err: fmt.Sprintf("Failed to get user info: %v", err)})
+				return
+			}
+			username, groups = userInfo.Username, userInfo.Groups
+		}
+		r.Header.Set("Authorization", "Bearer "+token)
+		r.Header.Set("Impersonate-User", username)
+		for _, group := range groups {
+			r.Header.Add("Impersonate-Group", group)
+		}
+	}
+
+	for header, value := range h.Headers {
+		r.Header.Set(header, value)
+	}
+	serviceProxy.ServeHTTP(w, r)
+}
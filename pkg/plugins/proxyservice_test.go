@@ -0,0 +1,155 @@
+package plugins
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/serverconfig"
+)
+
+func TestPluginProxyServiceRequest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "proxy-service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("service-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	user := &auth.User{Username: "alice", Groups: []string{"developers", "ops, west"}, Token: "user-token"}
+	tests := []struct {
+		name            string
+		service         serverconfig.ProxyService
+		path            string
+		expectedPath    string
+		expectedHeaders http.Header
+	}{
+		{
+			name:         "none",
+			service:      serverconfig.ProxyService{Authorization: serverconfig.ProxyAuthorizationNone},
+			path:         "/api/items",
+			expectedPath: "/api/items",
+			expectedHeaders: http.Header{
+				"Authorization":    {"Bearer client-token"},
+				"Impersonate-User": {"mallory"},
+			},
+		},
+		{
+			name:         "user token",
+			service:      serverconfig.ProxyService{Authorization: serverconfig.ProxyAuthorizationUserToken},
+			path:         "/api/items",
+			expectedPath: "/api/items",
+			expectedHeaders: http.Header{
+				"Authorization": {"Bearer user-token"},
+			},
+		},
+		{
+			name:         "service account",
+			service:      serverconfig.ProxyService{Authorization: serverconfig.ProxyAuthorizationServiceAccount, ServiceAccountTokenFile: tokenFile},
+			path:         "/api/items",
+			expectedPath: "/api/items",
+			expectedHeaders: http.Header{
+				"Authorization":     {"Bearer service-token"},
+				"Impersonate-User":  {"alice"},
+				"Impersonate-Group": {"developers", "ops, west"},
+			},
+		},
+		{
+			name: "headers and path rewrites",
+			service: serverconfig.ProxyService{
+				Authorization: serverconfig.ProxyAuthorizationUserToken,
+				Headers:       map[string]string{"X-Tenant": "console"},
+				PathRewrites: []serverconfig.ProxyPathRewrite{
+					{From: "^/v1/(.*)$", To: "/api/v1/$1"},
+					{From: "^/v1/", To: "/unused/"},
+				},
+			},
+			path:         "/v1/items",
+			expectedPath: "/api/v1/items",
+			expectedHeaders: http.Header{
+				"Authorization": {"Bearer user-token"},
+				"X-Tenant":      {"console"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlers, err := GetPluginProxyServiceHandlers(
+				&serverconfig.Proxy{Services: []serverconfig.ProxyService{tt.service}},
+				&tls.Config{},
+				"/api/proxy/",
+				nil,
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var proxied *http.Request
+			serviceProxy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				proxied = r
+			})
+			r := httptest.NewRequest("GET", tt.path, nil)
+			r.Header.Set("Authorization", "Bearer client-token")
+			r.Header.Set("Impersonate-User", "mallory")
+			handlers[0].ProxyRequest(serviceProxy, user, httptest.NewRecorder(), r)
+
+			if proxied.URL.Path != tt.expectedPath {
+				t.Errorf("expected path %s, got %s", tt.expectedPath, proxied.URL.Path)
+			}
+			for _, header := range []string{"Authorization", "Impersonate-User", "Impersonate-Group", "X-Tenant"} {
+				if !reflect.DeepEqual(proxied.Header.Values(header), tt.expectedHeaders.Values(header)) {
+					t.Errorf("expected %s header %v, got %v", header, tt.expectedHeaders.Values(header), proxied.Header.Values(header))
+				}
+			}
+		})
+	}
+}
+
+func TestPluginProxyServiceTimeout(t *testing.T) {
+	handlers, err := GetPluginProxyServiceHandlers(
+		&serverconfig.Proxy{Services: []serverconfig.ProxyService{{Timeout: "10ms"}}},
+		&tls.Config{},
+		"/api/proxy/",
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serviceProxy := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+			w.WriteHeader(http.StatusGatewayTimeout)
+		case <-time.After(time.Second):
+			w.WriteHeader(http.StatusOK)
+		}
+	})
+	rr := httptest.NewRecorder()
+	handlers[0].ProxyRequest(serviceProxy, nil, rr, httptest.NewRequest("GET", "/", nil))
+	if rr.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected the request to time out, got status %d", rr.Code)
+	}
+}
+
+func TestPluginProxyServiceConfigErrors(t *testing.T) {
+	for _, service := range []serverconfig.ProxyService{
+		{Authorization: "Basic"},
+		{Authorization: serverconfig.ProxyAuthorizationServiceAccount},
+		{Authorization: serverconfig.ProxyAuthorizationServiceAccount, ServiceAccountTokenFile: "/nonexistent/token"},
+		{Timeout: "soon"},
+		{PathRewrites: []serverconfig.ProxyPathRewrite{{From: "(", To: "/"}}},
+	} {
+		_, err := GetPluginProxyServiceHandlers(&serverconfig.Proxy{Services: []serverconfig.ProxyService{service}}, &tls.Config{}, "/api/proxy/", nil)
+		if err == nil {
+			t.Errorf("expected an error for %+v", service)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package plugins
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/serverutils"
+	"github.com/openshift/console/pkg/version"
+)
+
+// defaultManifestCheckInterval is how often the manifests of the plugins are checked.
+const defaultManifestCheckInterval = time.Minute
+
+// Status is the result of the last check of a plugin's manifest.
+type Status struct {
+	Name string `json:"name"`
+	// Ready tells whether the manifest could be fetched and is valid.
+	Ready bool `json:"ready"`
+	// Reachable tells whether the plugin service responded.
+	Reachable bool   `json:"reachable"`
+	LatencyMS int64  `json:"latencyMS"`
+	Error     string `json:"error,omitempty"`
+	// ManifestHash is the SHA-256 of the manifest, so changes can be told apart.
+	ManifestHash string    `json:"manifestHash,omitempty"`
+	Version      string    `json:"version,omitempty"`
+	LastChecked  time.Time `json:"lastChecked"`
+	// Excluded tells whether the plugin is left out of the console because it
+	// is incompatible with the console or the other plugins.
+	Excluded        bool   `json:"excluded"`
+	ExclusionReason string `json:"exclusionReason,omitempty"`
+}
+
+// ManifestChecker periodically fetches and validates the manifests of the
+// enabled plugins.
+type ManifestChecker struct {
+	client             *http.Client
+	pluginsEndpointMap map[string]string
+	interval           time.Duration
+	// consoleVersion is checked against the plugin API dependency of the plugins. It is nil
+	// when the console version is unknown, like in development builds.
+	consoleVersion *semver.Version
+
+	statusesLock sync.RWMutex
+	statuses     map[string]Status
+	// checked tells whether the manifests have been checked at least once.
+	checked bool
+}
+
+func NewManifestChecker(client *http.Client, pluginsEndpointMap map[string]string) *ManifestChecker {
+	return &ManifestChecker{
+		client:             client,
+		pluginsEndpointMap: pluginsEndpointMap,
+		interval:           defaultManifestCheckInterval,
+		consoleVersion:     parseConsoleVersion(version.Version),
+		statuses:           make(map[string]Status),
+	}
+}
+
+// parseConsoleVersion returns the release of the console version, without pre-release and
+// build metadata, so that it satisfies the version ranges of its release. It returns nil if the
+// version isn't a semantic version.
+func parseConsoleVersion(consoleVersion string) *semver.Version {
+	parsed, err := semver.NewVersion(consoleVersion)
+	if err != nil {
+		klog.Warningf("Console version %q is not a semantic version, the plugin API dependency of plugins won't be checked", consoleVersion)
+		return nil
+	}
+	release, err := semver.NewVersion(fmt.Sprintf("%d.%d.%d", parsed.Major(), parsed.Minor(), parsed.Patch()))
+	if err != nil {
+		return nil
+	}
+	return release
+}
+
+// Run checks the manifests right away and then periodically until the context is done.
+func (c *ManifestChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *ManifestChecker) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	statuses := make(map[string]Status, len(c.pluginsEndpointMap))
+	manifests := make(map[string]*Manifest, len(c.pluginsEndpointMap))
+	for name, endpoint := range c.pluginsEndpointMap {
+		wg.Add(1)
+		go func(name, endpoint string) {
+			defer wg.Done()
+			status, manifest := c.check(ctx, name, endpoint)
+			if !status.Ready {
+				klog.Errorf("Plugin %q is not ready: %s", name, status.Error)
+			}
+			lock.Lock()
+			statuses[name] = status
+			manifests[name] = manifest
+			lock.Unlock()
+		}(name, endpoint)
+	}
+	wg.Wait()
+
+	// Excluding a plugin can make the plugins depending on it incompatible, so
+	// repeat until no more plugins are excluded.
+	excluded := map[string]string{}
+	for changed := true; changed; {
+		changed = false
+		for name, manifest := range manifests {
+			if _, ok := excluded[name]; ok || manifest == nil {
+				continue
+			}
+			if err := checkDependencies(manifest, c.consoleVersion, manifests, excluded); err != nil {
+				excluded[name] = err.Error()
+				changed = true
+			}
+		}
+	}
+
+	c.statusesLock.Lock()
+	defer c.statusesLock.Unlock()
+	for name, status := range statuses {
+		if reason, ok := excluded[name]; ok {
+			status.Excluded = true
+			status.ExclusionReason = reason
+			status.Ready = false
+			if previous := c.statuses[name]; previous.ExclusionReason != reason {
+				klog.Errorf("Excluding incompatible plugin %q: %s", name, reason)
+			}
+		}
+		c.statuses[name] = status
+	}
+	c.checked = true
+}
+
+// Healthy returns an error until the manifests have been checked once, so that
+// incompatible plugins are excluded before the console serves them. Broken
+// plugins don't make the console unready.
+func (c *ManifestChecker) Healthy() error {
+	c.statusesLock.RLock()
+	defer c.statusesLock.RUnlock()
+	if !c.checked {
+		return fmt.Errorf("plugin manifests have not been checked yet")
+	}
+	return nil
+}
+
+// ManifestHash returns the hash of the plugin's manifest found by the last check, if any.
+func (c *ManifestChecker) ManifestHash(name string) string {
+	c.statusesLock.RLock()
+	defer c.statusesLock.RUnlock()
+	return c.statuses[name].ManifestHash
+}
+
+// IsExcluded tells whether the plugin was found incompatible by the last check.
+func (c *ManifestChecker) IsExcluded(name string) bool {
+	c.statusesLock.RLock()
+	defer c.statusesLock.RUnlock()
+	return c.statuses[name].Excluded
+}
+
+// check fetches and validates the manifest of a plugin.
+func (c *ManifestChecker) check(ctx context.Context, name, endpoint string) (Status, *Manifest) {
+	status := Status{Name: name, LastChecked: time.Now()}
+	manifestURL, err := url.Parse(endpoint)
+	if err != nil {
+		status.Error = fmt.Sprintf("failed to parse %q endpoint", endpoint)
+		return status, nil
+	}
+	manifestURL.Path = path.Join(manifestURL.Path, ManifestFile)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", manifestURL.String(), nil)
+	if err != nil {
+		status.Error = err.Error()
+		return status, nil
+	}
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		status.Error = fmt.Sprintf("failed to fetch the manifest: %v", err)
+		return status, nil
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	status.LatencyMS = time.Since(start).Milliseconds()
+	status.Reachable = true
+	if err != nil {
+		status.Error = fmt.Sprintf("failed to read the manifest: %v", err)
+		return status, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		status.Error = fmt.Sprintf("fetching the manifest failed with %d status code", resp.StatusCode)
+		return status, nil
+	}
+
+	hash := sha256.Sum256(body)
+	status.ManifestHash = hex.EncodeToString(hash[:])
+	manifest, err := ParseManifest(body, name)
+	if err != nil {
+		status.Error = err.Error()
+		return status, nil
+	}
+	status.Version = manifest.Version
+	status.Ready = true
+	return status, manifest
+}
+
+// Statuses returns the status of each enabled plugin, sorted by name. Plugins
+// that haven't been checked yet aren't ready.
+func (c *ManifestChecker) Statuses() []Status {
+	c.statusesLock.RLock()
+	defer c.statusesLock.RUnlock()
+	statuses := make([]Status, 0, len(c.pluginsEndpointMap))
+	for name := range c.pluginsEndpointMap {
+		status, ok := c.statuses[name]
+		if !ok {
+			status = Status{Name: name, Error: "not checked yet"}
+		}
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// HandleStatus reports the status of each enabled plugin.
+func (c *ManifestChecker) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		serverutils.SendResponse(w, http.StatusMethodNotAllowed, serverutils.ApiError{Err: "Method unsupported, the only supported methods is GET"})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	serverutils.SendResponse(w, http.StatusOK, c.Statuses())
+}
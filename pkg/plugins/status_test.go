@@ -0,0 +1,176 @@
+package plugins
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseManifest(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		valid    bool
+	}{
+		{
+			name:     "valid",
+			manifest: `{"name": "my-plugin", "version": "1.0.0", "dependencies": {"@console/pluginAPI": "*"}, "extensions": [{"type": "console.flag", "properties": {}}]}`,
+			valid:    true,
+		},
+		{
+			name:     "not JSON",
+			manifest: `<html></html>`,
+		},
+		{
+			name:     "name of another plugin",
+			manifest: `{"name": "other-plugin", "version": "1.0.0", "extensions": []}`,
+		},
+		{
+			name:     "invalid version",
+			manifest: `{"name": "my-plugin", "version": "latest", "extensions": []}`,
+		},
+		{
+			name:     "no extensions",
+			manifest: `{"name": "my-plugin", "version": "1.0.0"}`,
+		},
+		{
+			name:     "unknown extension type",
+			manifest: `{"name": "my-plugin", "version": "1.0.0", "extensions": [{"type": "console.teleport", "properties": {}}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseManifest([]byte(tt.manifest), "my-plugin")
+			if tt.valid && err != nil {
+				t.Errorf("expected the manifest to be valid, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Error("expected the manifest to be invalid")
+			}
+		})
+	}
+}
+
+func TestManifestChecker(t *testing.T) {
+	pluginServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/good/" + ManifestFile:
+			fmt.Fprint(w, `{"name": "good", "version": "1.2.3", "dependencies": {}, "extensions": []}`)
+		case "/misnamed/" + ManifestFile:
+			fmt.Fprint(w, `{"name": "good", "version": "1.2.3", "dependencies": {}, "extensions": []}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer pluginServer.Close()
+
+	checker := NewManifestChecker(pluginServer.Client(), map[string]string{
+		"good":        pluginServer.URL + "/good/",
+		"misnamed":    pluginServer.URL + "/misnamed/",
+		"missing":     pluginServer.URL + "/missing/",
+		"unreachable": "http://127.0.0.1:1/",
+	})
+
+	if err := checker.Healthy(); err == nil {
+		t.Error("expected the checker not to be ready before the plugins are checked")
+	}
+
+	checker.checkAll(context.Background())
+	if err := checker.Healthy(); err != nil {
+		t.Errorf("expected broken plugins not to make the checker unready, got %v", err)
+	}
+	rr := httptest.NewRecorder()
+	checker.HandleStatus(rr, httptest.NewRequest("GET", "/api/console/plugins/status", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected status %d with broken plugins, got %d", http.StatusOK, rr.Code)
+	}
+	var statuses []Status
+	if err := json.NewDecoder(rr.Body).Decode(&statuses); err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 4 {
+		t.Fatalf("expected the status of 4 plugins, got %v", statuses)
+	}
+
+	expected := []struct {
+		name      string
+		ready     bool
+		reachable bool
+		hashed    bool
+	}{
+		{name: "good", ready: true, reachable: true, hashed: true},
+		{name: "misnamed", reachable: true, hashed: true},
+		{name: "missing", reachable: true},
+		{name: "unreachable"},
+	}
+	for i, e := range expected {
+		status := statuses[i]
+		if status.Name != e.name || status.Ready != e.ready || status.Reachable != e.reachable || (status.ManifestHash != "") != e.hashed {
+			t.Errorf("unexpected status of plugin %s: %+v", e.name, status)
+		}
+		if !e.ready && status.Error == "" {
+			t.Errorf("expected an error for plugin %s", e.name)
+		}
+	}
+	if statuses[0].Version != "1.2.3" {
+		t.Errorf("expected the version of the good plugin, got %q", statuses[0].Version)
+	}
+}
+
+func TestManifestCheckerCompatibility(t *testing.T) {
+	manifests := map[string]string{
+		"compatible":     `{"@console/pluginAPI": ">=4.9.0"}`,
+		"too-new":        `{"@console/pluginAPI": ">=4.11.0"}`,
+		"depends-ok":     `{"@console/pluginAPI": "~4.10.0", "compatible": "^1.0.0"}`,
+		"depends-old":    `{"compatible": "^2.0.0"}`,
+		"depends-absent": `{"absent": "*"}`,
+		"depends-broken": `{"too-new": "*"}`,
+	}
+	pluginServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), "/"+ManifestFile)
+		fmt.Fprintf(w, `{"name": %q, "version": "1.2.3", "dependencies": %s, "extensions": []}`, name, manifests[name])
+	}))
+	defer pluginServer.Close()
+
+	pluginsEndpointMap := map[string]string{}
+	for name := range manifests {
+		pluginsEndpointMap[name] = pluginServer.URL + "/" + name + "/"
+	}
+	checker := NewManifestChecker(pluginServer.Client(), pluginsEndpointMap)
+	checker.consoleVersion = parseConsoleVersion("v4.10.0-0.nightly")
+	checker.checkAll(context.Background())
+
+	expectedExcluded := map[string]bool{
+		"too-new":        true,
+		"depends-old":    true,
+		"depends-absent": true,
+		"depends-broken": true,
+	}
+	for _, status := range checker.Statuses() {
+		if status.Excluded != expectedExcluded[status.Name] || checker.IsExcluded(status.Name) != status.Excluded {
+			t.Errorf("expected plugin %s to be excluded: %t, got %+v", status.Name, expectedExcluded[status.Name], status)
+		}
+		if status.Excluded && (status.ExclusionReason == "" || status.Ready) {
+			t.Errorf("expected a reason for excluding plugin %s, got %+v", status.Name, status)
+		}
+	}
+
+	handler := NewPluginsHandler(pluginServer.Client(), pluginsEndpointMap, "", checker, nil, nil)
+	rr := httptest.NewRecorder()
+	handler.HandleCheckUpdates(rr, httptest.NewRequest("GET", "/api/check-updates", nil))
+	var updates struct {
+		Plugins []string `json:"plugins"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&updates); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(updates.Plugins)
+	if strings.Join(updates.Plugins, ",") != "compatible,depends-ok" {
+		t.Errorf("expected only compatible plugins to be listed, got %v", updates.Plugins)
+	}
+}
@@ -0,0 +1,48 @@
+package podexec
+
+import (
+	"encoding/json"
+	"time"
+
+	"k8s.io/klog"
+)
+
+// Stages of an exec session in audit events.
+const (
+	auditStageDenied  = "Denied"
+	auditStageStarted = "Started"
+	auditStageEnded   = "Ended"
+)
+
+// auditEvent records who opened an exec session, where and why.
+type auditEvent struct {
+	Stage       string    `json:"stage"`
+	Time        time.Time `json:"time"`
+	User        string    `json:"user"`
+	Cluster     string    `json:"cluster"`
+	Namespace   string    `json:"namespace"`
+	Pod         string    `json:"pod"`
+	Container   string    `json:"container,omitempty"`
+	Subresource string    `json:"subresource"`
+	Command     []string  `json:"command,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	// ImpersonatedUser and ImpersonatedGroup are who User acted as, if anyone.
+	ImpersonatedUser  string `json:"impersonatedUser,omitempty"`
+	ImpersonatedGroup string `json:"impersonatedGroup,omitempty"`
+	// Message tells why a session was denied.
+	Message string `json:"message,omitempty"`
+	// DurationSeconds is the length of an ended session.
+	DurationSeconds float64 `json:"durationSeconds,omitempty"`
+}
+
+// emitAuditEvent logs the event as a single JSON line, so log collectors can
+// pick it up.
+func emitAuditEvent(event auditEvent) {
+	event.Time = time.Now().UTC()
+	data, err := json.Marshal(event)
+	if err != nil {
+		klog.Errorf("failed to encode pod exec audit event: %v", err)
+		return
+	}
+	klog.Infof("pod exec audit: %s", data)
+}
@@ -0,0 +1,53 @@
+package podexec
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	consolePodExecSessionsTotalMetric          = "console_pod_exec_sessions_total"
+	consolePodExecActiveSessionsMetric         = "console_pod_exec_active_sessions"
+	consolePodExecSessionDurationSecondsMetric = "console_pod_exec_session_duration_seconds"
+
+	consolePodExecClusterLabel     = "cluster"
+	consolePodExecSubresourceLabel = "subresource"
+	consolePodExecResultLabel      = "result"
+)
+
+// Results of exec session requests in metrics.
+const (
+	resultStarted = "started"
+	resultDenied  = "denied"
+	resultFailed  = "failed"
+)
+
+var (
+	consolePodExecSessionsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: consolePodExecSessionsTotalMetric,
+			Help: "Number of pod exec and attach session requests by cluster, subresource and result.",
+		},
+		[]string{consolePodExecClusterLabel, consolePodExecSubresourceLabel, consolePodExecResultLabel},
+	)
+	consolePodExecActiveSessions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: consolePodExecActiveSessionsMetric,
+			Help: "Number of open pod exec and attach sessions by cluster.",
+		},
+		[]string{consolePodExecClusterLabel},
+	)
+	consolePodExecSessionDurationSeconds = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    consolePodExecSessionDurationSecondsMetric,
+			Help:    "Length of pod exec and attach sessions by cluster.",
+			Buckets: prometheus.ExponentialBuckets(10, 4, 7),
+		},
+		[]string{consolePodExecClusterLabel},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(consolePodExecSessionsTotal)
+	prometheus.MustRegister(consolePodExecActiveSessions)
+	prometheus.MustRegister(consolePodExecSessionDurationSeconds)
+}
@@ -0,0 +1,512 @@
+package podexec
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/proxy"
+	"github.com/openshift/console/pkg/recording"
+	"github.com/openshift/console/pkg/serverutils"
+)
+
+const (
+	// Endpoint is the path of exec and attach sessions:
+	// /api/pod-exec/{namespace}/{pod}/{exec|attach}
+	Endpoint = "/api/pod-exec/"
+
+	// defaultContainerAnnotation names the container kubectl execs into by default.
+	defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+	// maxTerminalSize bounds the columns and rows of a TTY resize.
+	maxTerminalSize = 10000
+
+	pingInterval = 30 * time.Second
+	writeTimeout = 30 * time.Second
+)
+
+// resizeChannel is the channel of TTY resizes in the Kubernetes remote command
+// streaming protocols.
+const resizeChannel = 4
+
+// subprotocols are the Kubernetes remote command streaming protocols the
+// handler relays, by preference.
+var subprotocols = []string{
+	"v4.base64.channel.k8s.io",
+	"base64.channel.k8s.io",
+	"v4.channel.k8s.io",
+	"channel.k8s.io",
+}
+
+// Config configures a Handler.
+type Config struct {
+	// The API server endpoints and clients of the clusters, by cluster name.
+	K8sProxyConfigs map[string]*proxy.Config
+	K8sClients      map[string]*http.Client
+	// Resolve the names of users that aren't known from their session.
+	UserInfoResolvers map[string]*auth.UserInfoResolver
+	Policy            Policy
+	// Recorder records sessions if it isn't nil.
+	Recorder *recording.Recorder
+}
+
+// Handler relays pod exec and attach websockets after enforcing the policy.
+type Handler struct {
+	config Config
+}
+
+func NewHandler(config Config) *Handler {
+	return &Handler{config: config}
+}
+
+// session is a requested exec or attach session.
+type session struct {
+	user        string
+	cluster     string
+	namespace   string
+	pod         string
+	container   string
+	subresource string
+	command     []string
+	reason      string
+	tty         bool
+	// The user and group impersonated with the Impersonate-User and
+	// Impersonate-Group subprotocols, if any.
+	impersonateUser  string
+	impersonateGroup string
+}
+
+func (s *session) auditEvent(stage string) auditEvent {
+	return auditEvent{
+		Stage:       stage,
+		User:        s.user,
+		Cluster:     s.cluster,
+		Namespace:   s.namespace,
+		Pod:         s.pod,
+		Container:   s.container,
+		Subresource: s.subresource,
+		Command:     s.command,
+		Reason:      s.reason,
+
+		ImpersonatedUser:  s.impersonateUser,
+		ImpersonatedGroup: s.impersonateGroup,
+	}
+}
+
+// impersonation returns who the session impersonates. Like with the k8s
+// proxy, impersonated groups include system:authenticated, so that requests
+// all users can make keep working.
+func (s *session) impersonation() rest.ImpersonationConfig {
+	impersonate := rest.ImpersonationConfig{UserName: s.impersonateUser}
+	if s.impersonateGroup != "" {
+		impersonate.Groups = []string{s.impersonateGroup, "system:authenticated"}
+	}
+	return impersonate
+}
+
+// HandleExec opens an exec or attach session. It expects the endpoint to be
+// stripped from the path. The query takes the container, the command
+// (repeated for every argument, exec only), tty (defaults to true), the reason
+// and the initial TTY size as cols and rows. The client talks a Kubernetes
+// remote command streaming protocol, like with the API server, and may
+// impersonate with the Impersonate-User and Impersonate-Group subprotocols.
+func (h *Handler) HandleExec(user *auth.User, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.Header().Set("Allow", "GET")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(r) {
+		http.Error(w, "A websocket upgrade is required", http.StatusBadRequest)
+		return
+	}
+
+	cluster := serverutils.GetCluster(r)
+	k8sProxyConfig, ok := h.config.K8sProxyConfigs[cluster]
+	if !ok {
+		klog.Errorf("Bad Request. Invalid cluster: %v", cluster)
+		http.Error(w, "Invalid cluster "+cluster, http.StatusBadRequest)
+		return
+	}
+
+	// {namespace}/{pod}/{exec|attach}, with the endpoint stripped.
+	segments := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(segments) != 3 || segments[0] == "" || segments[1] == "" || (segments[2] != "exec" && segments[2] != "attach") {
+		http.NotFound(w, r)
+		return
+	}
+	query := r.URL.Query()
+	s := &session{
+		user:        h.username(user, cluster, r),
+		cluster:     cluster,
+		namespace:   segments[0],
+		pod:         segments[1],
+		container:   query.Get("container"),
+		subresource: segments[2],
+		command:     query["command"],
+		reason:      query.Get("reason"),
+		tty:         query.Get("tty") != "false" && query.Get("tty") != "0",
+	}
+	impersonateUser, impersonateGroup, err := proxy.DecodeImpersonation(websocket.Subprotocols(r))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.impersonateUser, s.impersonateGroup = impersonateUser, impersonateGroup
+	if s.subresource == "exec" && len(s.command) == 0 {
+		http.Error(w, "A command is required", http.StatusBadRequest)
+		return
+	}
+	if s.subresource == "attach" {
+		s.command = nil
+	}
+
+	if err := h.config.Policy.check(s.namespace, s.reason); err != nil {
+		event := s.auditEvent(auditStageDenied)
+		event.Message = err.Error()
+		emitAuditEvent(event)
+		consolePodExecSessionsTotal.WithLabelValues(cluster, s.subresource, resultDenied).Inc()
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	status, err := h.validateTarget(s, user.Token)
+	if err != nil {
+		consolePodExecSessionsTotal.WithLabelValues(cluster, s.subresource, resultFailed).Inc()
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	cols, rows := query.Get("cols"), query.Get("rows")
+	h.relay(s, k8sProxyConfig, user.Token, cols, rows, w, r)
+}
+
+// username returns the name of the user for audit events.
+func (h *Handler) username(user *auth.User, cluster string, r *http.Request) string {
+	if user.Username != "" {
+		return user.Username
+	}
+	if resolver, ok := h.config.UserInfoResolvers[cluster]; ok {
+		userInfo, err := resolver.ResolveIdentity(r.Context(), user.Token)
+		if err == nil {
+			return userInfo.Username
+		}
+		klog.Warningf("failed to resolve the user of a pod exec session: %v", err)
+	}
+	return ""
+}
+
+// validateTarget checks that the pod is running and has the container,
+// picking the default container if none was requested. On failure it returns
+// the status to respond with.
+func (h *Handler) validateTarget(s *session, token string) (int, error) {
+	client, err := kubernetes.NewForConfig(&rest.Config{
+		Host:        h.config.K8sProxyConfigs[s.cluster].Endpoint.String(),
+		Transport:   h.config.K8sClients[s.cluster].Transport,
+		BearerToken: token,
+		Impersonate: s.impersonation(),
+	})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	pod, err := client.CoreV1().Pods(s.namespace).Get(context.TODO(), s.pod, metav1.GetOptions{})
+	if err != nil {
+		if statusErr, ok := err.(*k8sErrors.StatusError); ok {
+			return int(statusErr.Status().Code), fmt.Errorf("Failed to get pod %s: %v", s.pod, err)
+		}
+		return http.StatusBadGateway, fmt.Errorf("Failed to get pod %s: %v", s.pod, err)
+	}
+	if pod.Status.Phase != corev1.PodRunning {
+		return http.StatusConflict, fmt.Errorf("Pod %s is %s, not Running", s.pod, pod.Status.Phase)
+	}
+
+	if s.container == "" {
+		s.container = pod.Annotations[defaultContainerAnnotation]
+		if s.container == "" && len(pod.Spec.Containers) > 0 {
+			s.container = pod.Spec.Containers[0].Name
+		}
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Name == s.container {
+			return http.StatusOK, nil
+		}
+	}
+	for _, container := range pod.Spec.EphemeralContainers {
+		if container.Name == s.container {
+			return http.StatusOK, nil
+		}
+	}
+	return http.StatusBadRequest, fmt.Errorf("Pod %s has no container %s", s.pod, s.container)
+}
+
+// relay connects the client to the API server's exec or attach endpoint.
+func (h *Handler) relay(s *session, k8sProxyConfig *proxy.Config, token, cols, rows string, w http.ResponseWriter, r *http.Request) {
+	backendURL := *k8sProxyConfig.Endpoint
+	if backendURL.Scheme == "https" {
+		backendURL.Scheme = "wss"
+	} else {
+		backendURL.Scheme = "ws"
+	}
+	backendURL.Path = proxy.SingleJoiningSlash(backendURL.Path, fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/%s", s.namespace, s.pod, s.subresource))
+	params := url.Values{
+		"container": {s.container},
+		"stdin":     {"true"},
+		"stdout":    {"true"},
+		"stderr":    {strconv.FormatBool(!s.tty)},
+		"tty":       {strconv.FormatBool(s.tty)},
+	}
+	if s.command != nil {
+		params["command"] = s.command
+	}
+	backendURL.RawQuery = params.Encode()
+
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	// The API server might not enforce this, but websocket requests are
+	// required to supply an origin.
+	header.Set("Origin", "http://localhost")
+	if impersonate := s.impersonation(); impersonate.UserName != "" {
+		header.Set("Impersonate-User", impersonate.UserName)
+		for _, group := range impersonate.Groups {
+			header.Add("Impersonate-Group", group)
+		}
+	}
+	dialer := &websocket.Dialer{
+		TLSClientConfig: k8sProxyConfig.TLSClientConfig,
+		Subprotocols:    acceptedSubprotocols(websocket.Subprotocols(r)),
+	}
+	backend, resp, err := dialer.Dial(backendURL.String(), header)
+	if err != nil {
+		consolePodExecSessionsTotal.WithLabelValues(s.cluster, s.subresource, resultFailed).Inc()
+		statusCode := http.StatusBadGateway
+		if resp != nil && resp.StatusCode != 0 {
+			statusCode = resp.StatusCode
+		}
+		http.Error(w, fmt.Sprintf("Failed to dial backend: '%v'", err), statusCode)
+		return
+	}
+	defer backend.Close()
+	subprotocol := backend.Subprotocol()
+
+	// Sessions are refused rather than left unrecorded.
+	var observer proxy.WebsocketObserver
+	if h.config.Recorder != nil {
+		observer = h.config.Recorder.NewSession(recording.Metadata{
+			User:      s.user,
+			Cluster:   s.cluster,
+			Namespace: s.namespace,
+			Pod:       s.pod,
+			Container: s.container,
+			Command:   s.command,
+		})
+		if err := observer.Open(subprotocol); err != nil {
+			consolePodExecSessionsTotal.WithLabelValues(s.cluster, s.subresource, resultFailed).Inc()
+			klog.Errorf("Failed to record pod exec session: %v", err)
+			http.Error(w, "Failed to record session", http.StatusInternalServerError)
+			return
+		}
+		defer observer.Close()
+	}
+
+	upgrader := &websocket.Upgrader{
+		Subprotocols: []string{subprotocol},
+		CheckOrigin: func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return k8sProxyConfig.Origin == "" || origin == k8sProxyConfig.Origin
+		},
+	}
+	frontend, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		consolePodExecSessionsTotal.WithLabelValues(s.cluster, s.subresource, resultFailed).Inc()
+		klog.Errorf("Failed to upgrade pod exec websocket to client: %v", err)
+		return
+	}
+	defer frontend.Close()
+
+	started := time.Now()
+	emitAuditEvent(s.auditEvent(auditStageStarted))
+	consolePodExecSessionsTotal.WithLabelValues(s.cluster, s.subresource, resultStarted).Inc()
+	consolePodExecActiveSessions.WithLabelValues(s.cluster).Inc()
+	defer func() {
+		duration := time.Since(started)
+		event := s.auditEvent(auditStageEnded)
+		event.DurationSeconds = duration.Seconds()
+		emitAuditEvent(event)
+		consolePodExecActiveSessions.WithLabelValues(s.cluster).Dec()
+		consolePodExecSessionDurationSeconds.WithLabelValues(s.cluster).Observe(duration.Seconds())
+	}()
+
+	codec := channelCodec{base64: strings.Contains(subprotocol, "base64")}
+	var backendWriteLock, frontendWriteLock sync.Mutex
+	writeBackend := func(messageType int, data []byte) error {
+		backendWriteLock.Lock()
+		defer backendWriteLock.Unlock()
+		if observer != nil {
+			observer.Message(false, messageType, data)
+		}
+		return backend.WriteMessage(messageType, data)
+	}
+
+	if s.tty && cols != "" && rows != "" {
+		if resize, ok := codec.resize(cols, rows); ok {
+			if err := writeBackend(codec.messageType(), resize); err != nil {
+				return
+			}
+		}
+	}
+
+	errc := make(chan error, 2)
+	go func() {
+		for {
+			messageType, data, err := backend.ReadMessage()
+			if err != nil {
+				errc <- err
+				return
+			}
+			if observer != nil {
+				observer.Message(true, messageType, data)
+			}
+			frontendWriteLock.Lock()
+			err = frontend.WriteMessage(messageType, data)
+			frontendWriteLock.Unlock()
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			messageType, data, err := frontend.ReadMessage()
+			if err != nil {
+				errc <- err
+				return
+			}
+			if channel, payload, ok := codec.decode(messageType, data); ok && channel == resizeChannel {
+				// Only pass on well-formed resizes of TTYs, the API server
+				// closes the stream on malformed ones.
+				var size struct {
+					Width  int
+					Height int
+				}
+				if !s.tty || json.Unmarshal(payload, &size) != nil {
+					continue
+				}
+				resize, ok := codec.resize(strconv.Itoa(size.Width), strconv.Itoa(size.Height))
+				if !ok {
+					continue
+				}
+				data = resize
+			}
+			if err := writeBackend(messageType, data); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-errc:
+			// Let the defers close both connections.
+			return
+		case <-ticker.C:
+			// Keep load balancers from closing idle sessions.
+			frontendWriteLock.Lock()
+			err := frontend.WriteControl(websocket.PingMessage, []byte{}, time.Now().Add(writeTimeout))
+			frontendWriteLock.Unlock()
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+// acceptedSubprotocols returns the streaming protocols the client offered
+// that the handler relays, or all of them if the client offered none.
+func acceptedSubprotocols(offered []string) []string {
+	accepted := []string{}
+	for _, subprotocol := range subprotocols {
+		for _, o := range offered {
+			if o == subprotocol {
+				accepted = append(accepted, subprotocol)
+			}
+		}
+	}
+	if len(accepted) == 0 {
+		return subprotocols
+	}
+	return accepted
+}
+
+// channelCodec encodes and decodes messages of a Kubernetes remote command
+// streaming protocol.
+type channelCodec struct {
+	base64 bool
+}
+
+func (c channelCodec) messageType() int {
+	if c.base64 {
+		return websocket.TextMessage
+	}
+	return websocket.BinaryMessage
+}
+
+func (c channelCodec) decode(messageType int, data []byte) (channel byte, payload []byte, ok bool) {
+	if len(data) == 0 {
+		return 0, nil, false
+	}
+	if !c.base64 {
+		return data[0], data[1:], messageType == websocket.BinaryMessage
+	}
+	if messageType != websocket.TextMessage || data[0] < '0' || data[0] > '9' {
+		return 0, nil, false
+	}
+	payload, err := base64.StdEncoding.DecodeString(string(data[1:]))
+	if err != nil {
+		return 0, nil, false
+	}
+	return data[0] - '0', payload, true
+}
+
+func (c channelCodec) encode(channel byte, payload []byte) []byte {
+	if !c.base64 {
+		return append([]byte{channel}, payload...)
+	}
+	return []byte(string('0'+channel) + base64.StdEncoding.EncodeToString(payload))
+}
+
+// resize returns a resize message, or false if the size is out of bounds.
+func (c channelCodec) resize(cols, rows string) ([]byte, bool) {
+	width, err := strconv.Atoi(cols)
+	if err != nil || width < 1 || width > maxTerminalSize {
+		return nil, false
+	}
+	height, err := strconv.Atoi(rows)
+	if err != nil || height < 1 || height > maxTerminalSize {
+		return nil, false
+	}
+	payload, _ := json.Marshal(map[string]int{"Width": width, "Height": height})
+	return c.encode(resizeChannel, payload), true
+}
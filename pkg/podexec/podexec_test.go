@@ -0,0 +1,208 @@
+package podexec
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/proxy"
+)
+
+func TestPolicy(t *testing.T) {
+	patterns, err := ParseNamespacePatterns("openshift-*, kube-system,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := &Policy{DeniedNamespaces: patterns, RequireReason: true}
+	for _, test := range []struct {
+		namespace string
+		reason    string
+		allowed   bool
+	}{
+		{"openshift-etcd", "debugging", false},
+		{"kube-system", "debugging", false},
+		{"my-project", "", false},
+		{"my-project", "debugging", true},
+		{"openshift", "debugging", true},
+	} {
+		if err := policy.check(test.namespace, test.reason); (err == nil) != test.allowed {
+			t.Errorf("unexpected result for namespace %q and reason %q: %v", test.namespace, test.reason, err)
+		}
+	}
+
+	if !policy.Enabled() || (&Policy{}).Enabled() {
+		t.Error("expected only a restricting policy to be enabled")
+	}
+
+	if _, err := ParseNamespacePatterns("openshift-["); err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+}
+
+func TestHandleExec(t *testing.T) {
+	execs := make(chan url.Values, 1)
+	messages := make(chan string, 10)
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{"base64.channel.k8s.io"},
+		CheckOrigin:  func(r *http.Request) bool { return true },
+	}
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Errorf("expected the user's token, got %q", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Path {
+		case "/api/v1/namespaces/my-project/pods/my-pod":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"metadata": {"name": "my-pod"}, "spec": {"containers": [{"name": "app"}, {"name": "sidecar"}]}, "status": {"phase": "Running"}}`)
+		case "/api/v1/namespaces/my-project/pods/my-pod/exec":
+			execs <- r.URL.Query()
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer conn.Close()
+			for {
+				_, msg, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				messages <- string(msg)
+				if msg[0] == '0' {
+					conn.WriteMessage(websocket.TextMessage, append([]byte{'1'}, msg[1:]...))
+				}
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer apiServer.Close()
+	endpoint, err := url.Parse(apiServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(Config{
+		K8sProxyConfigs: map[string]*proxy.Config{"local-cluster": {Endpoint: endpoint}},
+		K8sClients:      map[string]*http.Client{"local-cluster": apiServer.Client()},
+		Policy:          Policy{DeniedNamespaces: []string{"openshift-*"}},
+	})
+	s := httptest.NewServer(http.StripPrefix("/api/pod-exec", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.HandleExec(&auth.User{Username: "alice", Token: "token"}, w, r)
+	})))
+	defer s.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"base64.channel.k8s.io"}}
+	dial := func(path string) (*websocket.Conn, int) {
+		conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+path, nil)
+		if err != nil {
+			if resp == nil {
+				t.Fatal(err)
+			}
+			return nil, resp.StatusCode
+		}
+		return conn, http.StatusSwitchingProtocols
+	}
+
+	if _, status := dial("/api/pod-exec/openshift-etcd/etcd/exec?command=sh"); status != http.StatusForbidden {
+		t.Errorf("expected exec into a denied namespace to be forbidden, got status %d", status)
+	}
+	if _, status := dial("/api/pod-exec/my-project/my-pod/exec?command=sh&container=missing"); status != http.StatusBadRequest {
+		t.Errorf("expected exec into a missing container to be rejected, got status %d", status)
+	}
+
+	conn, status := dial("/api/pod-exec/my-project/my-pod/exec?command=sh&command=-i&cols=120&rows=40")
+	if conn == nil {
+		t.Fatalf("expected the session to open, got status %d", status)
+	}
+	defer conn.Close()
+	query := <-execs
+	if query.Get("container") != "app" || strings.Join(query["command"], " ") != "sh -i" || query.Get("tty") != "true" {
+		t.Errorf("unexpected exec request: %v", query)
+	}
+	encode := func(channel byte, data string) []byte {
+		return []byte(string('0'+channel) + base64.StdEncoding.EncodeToString([]byte(data)))
+	}
+	if msg := <-messages; msg != string(encode(resizeChannel, `{"Height":40,"Width":120}`)) {
+		t.Errorf("expected the initial TTY size to be sent, got %q", msg)
+	}
+
+	conn.WriteMessage(websocket.TextMessage, encode(resizeChannel, `{"Width":0,"Height":40}`))
+	conn.WriteMessage(websocket.TextMessage, encode(resizeChannel, `{"Width":80,"Height":24}`))
+	conn.WriteMessage(websocket.TextMessage, encode(0, "ls\r"))
+	if msg := <-messages; msg != string(encode(resizeChannel, `{"Height":24,"Width":80}`)) {
+		t.Errorf("expected only the valid resize to be relayed, got %q", msg)
+	}
+	if msg := <-messages; msg != string(encode(0, "ls\r")) {
+		t.Errorf("expected stdin to be relayed, got %q", msg)
+	}
+	if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != string(encode(1, "ls\r")) {
+		t.Errorf("expected stdout to be relayed, got %q: %v", msg, err)
+	}
+}
+
+func TestHandleExecImpersonation(t *testing.T) {
+	impersonated := make(chan http.Header, 2)
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{"base64.channel.k8s.io"},
+		CheckOrigin:  func(r *http.Request) bool { return true },
+	}
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		impersonated <- http.Header{
+			"Impersonate-User":  r.Header.Values("Impersonate-User"),
+			"Impersonate-Group": r.Header.Values("Impersonate-Group"),
+		}
+		switch r.URL.Path {
+		case "/api/v1/namespaces/my-project/pods/my-pod":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"metadata": {"name": "my-pod"}, "spec": {"containers": [{"name": "app"}]}, "status": {"phase": "Running"}}`)
+		case "/api/v1/namespaces/my-project/pods/my-pod/exec":
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			conn.Close()
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer apiServer.Close()
+	endpoint, err := url.Parse(apiServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(Config{
+		K8sProxyConfigs: map[string]*proxy.Config{"local-cluster": {Endpoint: endpoint}},
+		K8sClients:      map[string]*http.Client{"local-cluster": apiServer.Client()},
+		Policy:          Policy{RequireReason: true},
+	})
+	s := httptest.NewServer(http.StripPrefix("/api/pod-exec", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.HandleExec(&auth.User{Username: "admin", Token: "token"}, w, r)
+	})))
+	defer s.Close()
+
+	// Impersonation is encoded like for the k8s proxy: base64 with '=' as '_' and '/' as '-'.
+	group := strings.NewReplacer("=", "_", "/", "-").Replace(base64.StdEncoding.EncodeToString([]byte("developers")))
+	dialer := websocket.Dialer{Subprotocols: []string{"Impersonate-Group." + group, "base64.channel.k8s.io"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(s.URL, "http")+"/api/pod-exec/my-project/my-pod/exec?command=sh&reason=debugging", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	for _, request := range []string{"pod", "exec"} {
+		header := <-impersonated
+		if header.Get("Impersonate-User") != "developers" || strings.Join(header.Values("Impersonate-Group"), ",") != "developers,system:authenticated" {
+			t.Errorf("expected the %s request to impersonate the group, got %v", request, header)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package podexec
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Policy restricts which pods users can exec into or attach to through the
+// console, on top of what their RBAC allows.
+type Policy struct {
+	// DeniedNamespaces are glob patterns, like openshift-*, of namespaces
+	// sessions are denied in.
+	DeniedNamespaces []string
+	// RequireReason denies sessions that don't give a reason.
+	RequireReason bool
+}
+
+// ParseNamespacePatterns parses a comma separated list of namespace glob patterns.
+func ParseNamespacePatterns(patterns string) ([]string, error) {
+	parsed := []string{}
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid namespace pattern %q: %v", pattern, err)
+		}
+		parsed = append(parsed, pattern)
+	}
+	return parsed, nil
+}
+
+// Enabled tells whether the policy restricts any session.
+func (p *Policy) Enabled() bool {
+	return len(p.DeniedNamespaces) != 0 || p.RequireReason
+}
+
+// check returns why a session in the namespace is denied, or nil if it is allowed.
+func (p *Policy) check(namespace, reason string) error {
+	for _, pattern := range p.DeniedNamespaces {
+		if matched, _ := path.Match(pattern, namespace); matched {
+			return fmt.Errorf("sessions in namespace %s are denied by policy", namespace)
+		}
+	}
+	if p.RequireReason && strings.TrimSpace(reason) == "" {
+		return fmt.Errorf("a reason is required")
+	}
+	return nil
+}
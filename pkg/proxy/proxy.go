@@ -88,6 +88,27 @@ func decodeSubprotocol(encodedProtocol string) (string, error) {
 	return string(decodedProtocol), err
 }
 
+// DecodeImpersonation returns the user and group the bridge specific
+// Impersonate-User and Impersonate-Group websocket subprotocols ask for, like
+// the proxy does for websockets. Impersonating a group impersonates a user of
+// the same name.
+func DecodeImpersonation(protocols []string) (user string, group string, err error) {
+	for _, protocol := range protocols {
+		switch {
+		case strings.HasPrefix(protocol, "Impersonate-User."):
+			if user, err = decodeSubprotocol(strings.TrimPrefix(protocol, "Impersonate-User.")); err != nil {
+				return "", "", fmt.Errorf("Error decoding Impersonate-User subprotocol: %v", err)
+			}
+		case strings.HasPrefix(protocol, "Impersonate-Group."):
+			if group, err = decodeSubprotocol(strings.TrimPrefix(protocol, "Impersonate-Group.")); err != nil {
+				return "", "", fmt.Errorf("Error decoding Impersonate-Group subprotocol: %v", err)
+			}
+			user = group
+		}
+	}
+	return user, group, nil
+}
+
 var HeaderBlacklist = []string{"Cookie", "X-CSRFToken"}
 
 // pass through headers that are needed for browser caching and content negotiation,
@@ -99,7 +120,25 @@ func CopyRequestHeaders(originalRequest, newRequest *http.Request) {
 	}
 }
 
+// WebsocketObserver is told about the messages a proxy relays over a websocket.
+type WebsocketObserver interface {
+	// Open is called once the websocket to the backend is established, with
+	// the subprotocol the backend picked. If it fails, the websocket is refused.
+	Open(subprotocol string) error
+	// Message is called for every message, from the backend or to it. It may
+	// be called concurrently for the two directions.
+	Message(fromBackend bool, messageType int, data []byte)
+	// Close is called when the websocket is closed.
+	Close()
+}
+
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.ServeObservedHTTP(w, r, nil)
+}
+
+// ServeObservedHTTP proxies the request like ServeHTTP. If the request is a
+// websocket, the observer, if not nil, is told about its messages.
+func (p *Proxy) ServeObservedHTTP(w http.ResponseWriter, r *http.Request, observer WebsocketObserver) {
 
 	if klog.V(3) {
 		klog.Infof("PROXY: %#q\n", r.URL)
@@ -249,6 +288,18 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return false
 		},
 	}
+	var observeBackend, observeFrontend func(int, []byte)
+	if observer != nil {
+		if err := observer.Open(backend.Subprotocol()); err != nil {
+			log.Printf("Failed to observe websocket: '%v'", err)
+			http.Error(w, "Failed to observe websocket", http.StatusInternalServerError)
+			return
+		}
+		defer observer.Close()
+		observeBackend = func(messageType int, data []byte) { observer.Message(true, messageType, data) }
+		observeFrontend = func(messageType int, data []byte) { observer.Message(false, messageType, data) }
+	}
+
 	frontend, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("Failed to upgrade websocket to client: '%v'", err)
@@ -266,8 +317,8 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	errc := make(chan error, 2)
 
 	// Can't just use io.Copy here since browsers care about frame headers.
-	go func() { errc <- copyMsgs(nil, frontend, backend) }()
-	go func() { errc <- copyMsgs(&writeMutex, backend, frontend) }()
+	go func() { errc <- copyMsgs(nil, frontend, backend, observeBackend) }()
+	go func() { errc <- copyMsgs(&writeMutex, backend, frontend, observeFrontend) }()
 
 	for {
 		select {
@@ -286,13 +337,17 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func copyMsgs(writeMutex *sync.Mutex, dest, src *websocket.Conn) error {
+func copyMsgs(writeMutex *sync.Mutex, dest, src *websocket.Conn, observe func(int, []byte)) error {
 	for {
 		messageType, msg, err := src.ReadMessage()
 		if err != nil {
 			return err
 		}
 
+		if observe != nil {
+			observe(messageType, msg)
+		}
+
 		if writeMutex == nil {
 			err = dest.WriteMessage(messageType, msg)
 		} else {
@@ -0,0 +1,43 @@
+package recording
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	consoleTerminalRecordingFailuresTotalMetric    = "console_terminal_recording_failures_total"
+	consoleTerminalRecordingTruncationsTotalMetric = "console_terminal_recording_truncations_total"
+
+	consoleTerminalRecordingStageLabel = "stage"
+)
+
+// Stages of terminal recordings in metrics.
+const (
+	// The recording couldn't be started and the session was refused.
+	stageOpen = "open"
+	// An event couldn't be written to the recording.
+	stageWrite = "write"
+	// The recording couldn't be stored in the sink.
+	stageStore = "store"
+)
+
+var (
+	consoleTerminalRecordingFailuresTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: consoleTerminalRecordingFailuresTotalMetric,
+			Help: "Number of terminal recording failures by stage.",
+		},
+		[]string{consoleTerminalRecordingStageLabel},
+	)
+	consoleTerminalRecordingTruncationsTotal = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: consoleTerminalRecordingTruncationsTotalMetric,
+			Help: "Number of terminal recordings truncated because they reached their size limit.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(consoleTerminalRecordingFailuresTotal)
+	prometheus.MustRegister(consoleTerminalRecordingTruncationsTotal)
+}
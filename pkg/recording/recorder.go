@@ -0,0 +1,297 @@
+package recording
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/proxy"
+)
+
+// Channels of the Kubernetes remote command streaming protocols.
+const (
+	stdinChannel  = 0
+	stdoutChannel = 1
+	stderrChannel = 2
+	resizeChannel = 4
+)
+
+// storeTimeout bounds storing a recording and applying the retention limits.
+const storeTimeout = time.Minute
+
+// execPathRegexp matches API paths of pod exec and attach requests.
+var execPathRegexp = regexp.MustCompile(`^/?api/v1/namespaces/([^/]+)/pods/([^/]+)/(exec|attach)$`)
+
+// ParseExecPath returns the namespace and pod of a pod exec or attach request
+// to the API server.
+func ParseExecPath(path string) (namespace string, pod string, ok bool) {
+	match := execPathRegexp.FindStringSubmatch(path)
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], match[2], true
+}
+
+// Retention limits the stored recordings. Zero values don't limit them.
+type Retention struct {
+	// MaxAge is how long recordings are kept.
+	MaxAge time.Duration
+	// MaxCount is how many recordings are kept. The oldest are deleted first.
+	MaxCount int
+}
+
+// Metadata describes a recorded session.
+type Metadata struct {
+	User      string   `json:"user"`
+	Cluster   string   `json:"cluster"`
+	Namespace string   `json:"namespace"`
+	Pod       string   `json:"pod"`
+	Container string   `json:"container,omitempty"`
+	Command   []string `json:"command,omitempty"`
+}
+
+// Recorder records terminal sessions in the asciicast v2 format and stores
+// them in a sink.
+type Recorder struct {
+	sink      Sink
+	retention Retention
+	// maxSize is the size in bytes after which recordings are truncated. Zero
+	// doesn't limit it.
+	maxSize int64
+}
+
+func NewRecorder(sink Sink, retention Retention, maxSize int64) *Recorder {
+	return &Recorder{
+		sink:      sink,
+		retention: retention,
+		maxSize:   maxSize,
+	}
+}
+
+// NewSession returns an observer recording the websocket of a pod exec or
+// attach request.
+func (r *Recorder) NewSession(metadata Metadata) proxy.WebsocketObserver {
+	return &session{
+		recorder: r,
+		metadata: metadata,
+	}
+}
+
+// prune deletes the recordings beyond the retention limits.
+func (r *Recorder) prune(ctx context.Context) error {
+	if r.retention.MaxAge == 0 && r.retention.MaxCount == 0 {
+		return nil
+	}
+	recordings, err := r.sink.List(ctx)
+	if err != nil {
+		return err
+	}
+	// Newest first.
+	sort.Slice(recordings, func(i, j int) bool {
+		return recordings[i].Modified.After(recordings[j].Modified)
+	})
+	for i, recording := range recordings {
+		expired := r.retention.MaxAge != 0 && time.Since(recording.Modified) > r.retention.MaxAge
+		excess := r.retention.MaxCount != 0 && i >= r.retention.MaxCount
+		if !expired && !excess {
+			continue
+		}
+		if err := r.sink.Delete(ctx, recording.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// asciicastHeader is the first line of an asciicast v2 recording. The session
+// metadata is added to the standard fields.
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title"`
+	Env       map[string]string `json:"env"`
+	Metadata
+}
+
+type session struct {
+	recorder *Recorder
+	metadata Metadata
+
+	lock      sync.Mutex
+	started   time.Time
+	name      string
+	spool     *os.File
+	size      int64
+	truncated bool
+	base64    bool
+	closed    bool
+}
+
+// Open starts the recording. Sessions that can't be recorded must be refused.
+func (s *session) Open(subprotocol string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.started = time.Now()
+	s.base64 = subprotocol == "base64.channel.k8s.io" || subprotocol == "v4.base64.channel.k8s.io"
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		consoleTerminalRecordingFailuresTotal.WithLabelValues(stageOpen).Inc()
+		return fmt.Errorf("failed to name terminal recording: %v", err)
+	}
+	s.name = fmt.Sprintf("%s_%s_%s_%s_%s%s", s.started.UTC().Format("20060102T150405Z"), s.metadata.Cluster, s.metadata.Namespace, s.metadata.Pod, hex.EncodeToString(suffix), recordingExtension)
+
+	spool, err := ioutil.TempFile("", "terminal-recording-")
+	if err != nil {
+		consoleTerminalRecordingFailuresTotal.WithLabelValues(stageOpen).Inc()
+		return fmt.Errorf("failed to create terminal recording %s: %v", s.name, err)
+	}
+	header := asciicastHeader{
+		Version:   2,
+		Width:     80,
+		Height:    24,
+		Timestamp: s.started.Unix(),
+		Title:     fmt.Sprintf("%s in %s/%s on %s", s.metadata.User, s.metadata.Namespace, s.metadata.Pod, s.metadata.Cluster),
+		Env:       map[string]string{"TERM": "xterm"},
+		Metadata:  s.metadata,
+	}
+	s.spool = spool
+	if err := s.write(header); err != nil {
+		s.spool = nil
+		spool.Close()
+		os.Remove(spool.Name())
+		consoleTerminalRecordingFailuresTotal.WithLabelValues(stageOpen).Inc()
+		return fmt.Errorf("failed to write terminal recording %s: %v", s.name, err)
+	}
+	return nil
+}
+
+// write appends a line to the recording, unless that takes it beyond the size
+// limit, in which case the recording ends with a marker event. It must be
+// called with the session locked.
+func (s *session) write(v interface{}) error {
+	if s.truncated {
+		return nil
+	}
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	if max := s.recorder.maxSize; max != 0 && s.size+int64(len(line)) > max {
+		s.truncated = true
+		consoleTerminalRecordingTruncationsTotal.Inc()
+		klog.Warningf("terminal recording %s reached its size limit of %d bytes and was truncated", s.name, max)
+		line, err = json.Marshal([]interface{}{time.Since(s.started).Seconds(), "m", "recording truncated"})
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+	}
+	n, err := s.spool.Write(line)
+	s.size += int64(n)
+	return err
+}
+
+func (s *session) Message(fromBackend bool, messageType int, data []byte) {
+	channel, payload, ok := s.decode(messageType, data)
+	if !ok {
+		return
+	}
+
+	var eventType, eventData string
+	switch {
+	case fromBackend && (channel == stdoutChannel || channel == stderrChannel):
+		eventType, eventData = "o", string(payload)
+	case !fromBackend && channel == stdinChannel:
+		eventType, eventData = "i", string(payload)
+	case !fromBackend && channel == resizeChannel:
+		var size struct {
+			Width  int
+			Height int
+		}
+		if err := json.Unmarshal(payload, &size); err != nil {
+			return
+		}
+		eventType, eventData = "r", fmt.Sprintf("%dx%d", size.Width, size.Height)
+	default:
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.spool == nil || s.closed {
+		return
+	}
+	event := []interface{}{time.Since(s.started).Seconds(), eventType, eventData}
+	if err := s.write(event); err != nil {
+		consoleTerminalRecordingFailuresTotal.WithLabelValues(stageWrite).Inc()
+		klog.Errorf("failed to write terminal recording %s: %v", s.name, err)
+	}
+}
+
+// decode returns the channel and payload of a message of the Kubernetes
+// remote command streaming protocols.
+func (s *session) decode(messageType int, data []byte) (channel byte, payload []byte, ok bool) {
+	if len(data) == 0 {
+		return 0, nil, false
+	}
+	if !s.base64 {
+		if messageType != websocket.BinaryMessage {
+			return 0, nil, false
+		}
+		return data[0], data[1:], true
+	}
+	if messageType != websocket.TextMessage || data[0] < '0' || data[0] > '9' {
+		return 0, nil, false
+	}
+	payload, err := base64.StdEncoding.DecodeString(string(data[1:]))
+	if err != nil {
+		return 0, nil, false
+	}
+	return data[0] - '0', payload, true
+}
+
+func (s *session) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed || s.spool == nil {
+		s.closed = true
+		return
+	}
+	s.closed = true
+	defer os.Remove(s.spool.Name())
+	defer s.spool.Close()
+
+	if _, err := s.spool.Seek(0, 0); err != nil {
+		consoleTerminalRecordingFailuresTotal.WithLabelValues(stageStore).Inc()
+		klog.Errorf("failed to read terminal recording %s: %v", s.name, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), storeTimeout)
+	defer cancel()
+	if err := s.recorder.sink.Store(ctx, s.name, s.spool); err != nil {
+		consoleTerminalRecordingFailuresTotal.WithLabelValues(stageStore).Inc()
+		klog.Errorf("failed to store terminal recording %s: %v", s.name, err)
+		return
+	}
+	klog.V(4).Infof("stored terminal recording %s", s.name)
+	if err := s.recorder.prune(ctx); err != nil {
+		klog.Errorf("failed to apply the retention limits of terminal recordings: %v", err)
+	}
+}
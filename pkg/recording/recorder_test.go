@@ -0,0 +1,224 @@
+package recording
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/openshift/console/pkg/proxy"
+)
+
+func encodeChannel(channel byte, data string) []byte {
+	return []byte(string('0'+channel) + base64.StdEncoding.EncodeToString([]byte(data)))
+}
+
+func TestRecordExecSession(t *testing.T) {
+	// A pod exec endpoint echoing stdin to stdout.
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{"base64.channel.k8s.io"},
+		CheckOrigin:  func(r *http.Request) bool { return true },
+	}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if msg[0] == '0' {
+				msg[0] = '1'
+				if err := conn.WriteMessage(websocket.TextMessage, msg); err != nil {
+					return
+				}
+			}
+		}
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sink, err := NewDirSink(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := NewRecorder(sink, Retention{}, 0)
+
+	p := proxy.NewProxy(&proxy.Config{Endpoint: backendURL})
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace, pod, ok := ParseExecPath(r.URL.Path)
+		if !ok {
+			t.Errorf("expected an exec path, got %s", r.URL.Path)
+		}
+		p.ServeObservedHTTP(w, r, recorder.NewSession(Metadata{User: "alice", Cluster: "local-cluster", Namespace: namespace, Pod: pod}))
+	}))
+	defer frontend.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{"base64.channel.k8s.io"}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(frontend.URL, "http")+"/api/v1/namespaces/ns/pods/pod/exec?tty=1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, encodeChannel(resizeChannel, `{"Width":100,"Height":30}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, encodeChannel(stdinChannel, "ls\r")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := conn.ReadMessage(); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	var recordings []StoredRecording
+	for i := 0; i < 100 && len(recordings) == 0; i++ {
+		time.Sleep(20 * time.Millisecond)
+		if recordings, err = sink.List(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(recordings) != 1 {
+		t.Fatalf("expected a recording to be stored, got %v", recordings)
+	}
+
+	f, err := os.Open(filepath.Join(dir, recordings[0].Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Scan()
+	var header asciicastHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != 2 || header.User != "alice" || header.Pod != "pod" {
+		t.Errorf("unexpected header: %s", scanner.Bytes())
+	}
+	events := map[string]string{}
+	for scanner.Scan() {
+		var event []interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		events[event[1].(string)] = event[2].(string)
+	}
+	if events["r"] != "100x30" || events["i"] != "ls\r" || events["o"] != "ls\r" {
+		t.Errorf("unexpected events: %v", events)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sink, err := NewDirSink(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for name, age := range map[string]time.Duration{
+		"new.cast":     time.Minute,
+		"old.cast":     2 * time.Hour,
+		"newer.cast":   0,
+		"ignored.json": 3 * time.Hour,
+	} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := NewRecorder(sink, Retention{MaxAge: time.Hour}, 0).prune(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if recordings, _ := sink.List(context.Background()); len(recordings) != 2 {
+		t.Errorf("expected expired recordings to be deleted, got %v", recordings)
+	}
+
+	if err := NewRecorder(sink, Retention{MaxCount: 1}, 0).prune(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if recordings, _ := sink.List(context.Background()); len(recordings) != 1 || recordings[0].Name != "newer.cast" {
+		t.Errorf("expected only the newest recording to be kept, got %v", recordings)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ignored.json")); err != nil {
+		t.Errorf("expected files other than recordings to be kept: %v", err)
+	}
+}
+
+func TestRecordingSizeLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recordings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	sink, err := NewDirSink(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewRecorder(sink, Retention{}, 1024).NewSession(Metadata{User: "alice", Cluster: "local-cluster", Namespace: "ns", Pod: "pod"})
+	if err := s.Open("base64.channel.k8s.io"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		s.Message(true, websocket.TextMessage, encodeChannel(stdoutChannel, strings.Repeat("x", 100)))
+	}
+	s.Close()
+
+	recordings, err := sink.List(context.Background())
+	if err != nil || len(recordings) != 1 {
+		t.Fatalf("expected a recording to be stored, got %v, %v", recordings, err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, recordings[0].Name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(content) > 1024+100 || !strings.Contains(lines[len(lines)-1], `"m","recording truncated"`) {
+		t.Errorf("expected the recording to be truncated with a marker, got %d bytes ending with %s", len(content), lines[len(lines)-1])
+	}
+}
+
+func TestRecordingOpenFailure(t *testing.T) {
+	tmpdir := os.Getenv("TMPDIR")
+	defer os.Setenv("TMPDIR", tmpdir)
+	if err := os.Setenv("TMPDIR", "/nonexistent"); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewRecorder(&DirSink{dir: "/nonexistent"}, Retention{}, 0).NewSession(Metadata{User: "alice", Cluster: "local-cluster", Namespace: "ns", Pod: "pod"})
+	if err := s.Open("base64.channel.k8s.io"); err == nil {
+		t.Error("expected a session that can't be recorded to fail to open")
+	}
+	s.Close()
+}
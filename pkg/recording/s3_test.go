@@ -0,0 +1,66 @@
+package recording
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestS3Sink(t *testing.T) {
+	objects := map[string]string{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access-key/") {
+			t.Errorf("expected a signed request, got %q", r.Header.Get("Authorization"))
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := ioutil.ReadAll(r.Body)
+			objects[key] = string(body)
+		case http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		case http.MethodGet:
+			if r.URL.Path != "/bucket" || r.URL.Query().Get("prefix") != "recordings/" {
+				t.Errorf("unexpected list request %s", r.URL)
+			}
+			fmt.Fprint(w, `<ListBucketResult>`)
+			for key := range objects {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key><LastModified>2021-09-01T10:00:00.000Z</LastModified></Contents>`, key)
+			}
+			fmt.Fprint(w, `<IsTruncated>false</IsTruncated></ListBucketResult>`)
+		}
+	}))
+	defer s.Close()
+
+	endpoint, err := url.Parse(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := NewS3Sink(s.Client(), endpoint, "bucket", "recordings/", "us-east-1", "access-key", "secret-key")
+	ctx := context.Background()
+	if err := sink.Store(ctx, "session.cast", strings.NewReader("recording")); err != nil {
+		t.Fatal(err)
+	}
+	if objects["recordings/session.cast"] != "recording" {
+		t.Fatalf("expected the recording to be stored, got %v", objects)
+	}
+	recordings, err := sink.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recordings) != 1 || recordings[0].Name != "session.cast" || recordings[0].Modified.IsZero() {
+		t.Fatalf("unexpected recordings: %v", recordings)
+	}
+	if err := sink.Delete(ctx, "session.cast"); err != nil {
+		t.Fatal(err)
+	}
+	if len(objects) != 0 {
+		t.Errorf("expected the recording to be deleted, got %v", objects)
+	}
+}
@@ -0,0 +1,78 @@
+package recording
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// recordingExtension is the file extension of asciicast recordings.
+const recordingExtension = ".cast"
+
+// Sink stores recordings.
+type Sink interface {
+	// Store saves the recording read from content under name.
+	Store(ctx context.Context, name string, content io.ReadSeeker) error
+	// List returns the stored recordings.
+	List(ctx context.Context) ([]StoredRecording, error)
+	// Delete removes a stored recording.
+	Delete(ctx context.Context, name string) error
+}
+
+// StoredRecording is a recording in a sink.
+type StoredRecording struct {
+	Name     string
+	Modified time.Time
+}
+
+// DirSink stores recordings as files in a local directory.
+type DirSink struct {
+	dir string
+}
+
+func NewDirSink(dir string) (*DirSink, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DirSink{dir: dir}, nil
+}
+
+func (d *DirSink) Store(ctx context.Context, name string, content io.ReadSeeker) error {
+	// Write to a temporary file first, so that only complete recordings are listed.
+	tmp, err := ioutil.TempFile(d.dir, "."+name)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(d.dir, name))
+}
+
+func (d *DirSink) List(ctx context.Context) ([]StoredRecording, error) {
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return nil, err
+	}
+	recordings := []StoredRecording{}
+	for _, file := range files {
+		if file.IsDir() || strings.HasPrefix(file.Name(), ".") || !strings.HasSuffix(file.Name(), recordingExtension) {
+			continue
+		}
+		recordings = append(recordings, StoredRecording{Name: file.Name(), Modified: file.ModTime()})
+	}
+	return recordings, nil
+}
+
+func (d *DirSink) Delete(ctx context.Context, name string) error {
+	return os.Remove(filepath.Join(d.dir, filepath.Base(name)))
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	clientcmdv1 "k8s.io/client-go/tools/clientcmd/api/v1"
+	"k8s.io/klog"
+	"sigs.k8s.io/yaml"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/serverutils"
+)
+
+// KubeconfigCluster describes how clients reach the API server of a cluster in
+// kubeconfig files downloaded from the console.
+type KubeconfigCluster struct {
+	// Server is the URL of the API server as seen from clients.
+	Server string
+	// CAData is the PEM encoded CA bundle of the API server. Clients use their
+	// system roots if empty.
+	CAData []byte
+	// InsecureSkipTLSVerify is set for development clusters bridge doesn't
+	// verify either.
+	InsecureSkipTLSVerify bool
+}
+
+// kubeconfigTokenRequest tells the client where to send the user for the token
+// of their kubeconfig file.
+type kubeconfigTokenRequest struct {
+	URL string `json:"url"`
+}
+
+// kubeconfigChainTimeout bounds the time to request the tokens of a kubeconfig
+// file with a context for every cluster.
+const kubeconfigChainTimeout = 10 * time.Minute
+
+// kubeconfigChain collects the tokens of a kubeconfig file with a context for
+// every cluster. They are requested one cluster after the other.
+type kubeconfigChain struct {
+	// cluster is the cluster of the current context.
+	cluster string
+	// requested is the cluster whose token is being requested.
+	requested string
+	// pending are the clusters whose token is still to be requested.
+	pending []string
+	users   map[string]*auth.User
+	expires time.Time
+}
+
+// kubeconfigChains holds the chains in progress by ID. They are kept in
+// memory, so the token requests of a chain must reach the same replica.
+type kubeconfigChains struct {
+	mux    sync.Mutex
+	chains map[string]*kubeconfigChain
+}
+
+// start begins a chain requesting a token on cluster first, then on each of
+// the pending clusters. It returns the ID of the chain.
+func (c *kubeconfigChains) start(cluster string, pending []string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	now := time.Now()
+	if c.chains == nil {
+		c.chains = map[string]*kubeconfigChain{}
+	}
+	for chainID, chain := range c.chains {
+		if now.After(chain.expires) {
+			delete(c.chains, chainID)
+		}
+	}
+	c.chains[id] = &kubeconfigChain{
+		cluster:   cluster,
+		requested: cluster,
+		pending:   pending,
+		users:     map[string]*auth.User{},
+		expires:   now.Add(kubeconfigChainTimeout),
+	}
+	return id, nil
+}
+
+// add records the token requested on cluster and returns the chain, or false
+// if the chain is unknown, expired or waits for the token of another cluster.
+func (c *kubeconfigChains) add(id, cluster string, user *auth.User) (*kubeconfigChain, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	chain, ok := c.chains[id]
+	if !ok || time.Now().After(chain.expires) || chain.requested != cluster {
+		return nil, false
+	}
+	chain.users[cluster] = user
+	chain.requested = ""
+	return chain, true
+}
+
+// next removes the next pending cluster of the chain and marks its token as
+// requested. It returns false once tokens were requested on every cluster, and
+// forgets the chain.
+func (c *kubeconfigChains) next(id string, chain *kubeconfigChain) (string, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if len(chain.pending) == 0 {
+		delete(c.chains, id)
+		return "", false
+	}
+	chain.requested, chain.pending = chain.pending[0], chain.pending[1:]
+	return chain.requested, true
+}
+
+// handleKubeconfig issues a kubeconfig file for the user on the request's
+// cluster, or with `all=true` one with a context for every cluster. The file
+// never holds the token of the browser session: with user authentication, the
+// response sends the user through the token request flow, which ends with the
+// download of the file. With `all=true`, the flow is repeated for every
+// cluster with token requests. Without user authentication, the file holds the
+// console's own tokens.
+func (s *Server) handleKubeconfig(resolvers map[string]*auth.UserInfoResolver, user *auth.User, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		serverutils.SendResponse(w, http.StatusMethodNotAllowed, serverutils.ApiError{Err: "Invalid method: only POST is allowed"})
+		return
+	}
+
+	cluster := serverutils.GetCluster(r)
+	if _, ok := s.KubeconfigClusters[cluster]; !ok {
+		serverutils.SendResponse(w, http.StatusBadRequest, serverutils.ApiError{Err: fmt.Sprintf("Invalid cluster: %v", cluster)})
+		return
+	}
+
+	all := r.URL.Query().Get("all") == "true"
+	if !s.authDisabled() {
+		auther := s.Authers[cluster]
+		if !auther.TokenRequestEnabled() {
+			serverutils.SendResponse(w, http.StatusBadRequest, serverutils.ApiError{Err: fmt.Sprintf("Tokens for kubeconfig files can't be requested on cluster %s", cluster)})
+			return
+		}
+		chainID := ""
+		if all {
+			var err error
+			if chainID, err = s.kubeconfigChains.start(cluster, s.kubeconfigChainClusters(cluster)); err != nil {
+				klog.Errorf("failed to start kubeconfig chain: %v", err)
+				serverutils.SendResponse(w, http.StatusInternalServerError, serverutils.ApiError{Err: fmt.Sprintf("Failed to request tokens: %v", err)})
+				return
+			}
+		}
+		authCodeURL, err := auther.StartTokenRequest(w, true, chainID)
+		if err != nil {
+			klog.Errorf("failed to start token request for kubeconfig on cluster %s: %v", cluster, err)
+			serverutils.SendResponse(w, http.StatusServiceUnavailable, serverutils.ApiError{Err: fmt.Sprintf("Failed to request a token: %v", err)})
+			return
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		serverutils.SendResponse(w, http.StatusOK, kubeconfigTokenRequest{URL: authCodeURL})
+		return
+	}
+
+	users := map[string]*auth.User{cluster: user}
+	if all {
+		for name := range s.KubeconfigClusters {
+			if name == cluster {
+				continue
+			}
+			clusterUser, err := s.kubeconfigUser(name)
+			if err != nil {
+				klog.V(4).Infof("leaving cluster %s out of kubeconfig: %v", name, err)
+				continue
+			}
+			users[name] = clusterUser
+		}
+	}
+	s.writeKubeconfig(r.Context(), resolvers, cluster, users, w)
+}
+
+// kubeconfigChainClusters returns the clusters other than cluster whose
+// tokens can be requested for a kubeconfig file, by name.
+func (s *Server) kubeconfigChainClusters(cluster string) []string {
+	clusters := []string{}
+	for name := range s.KubeconfigClusters {
+		if auther := s.Authers[name]; name != cluster && auther != nil && auther.TokenRequestEnabled() {
+			clusters = append(clusters, name)
+		}
+	}
+	sort.Strings(clusters)
+	return clusters
+}
+
+// continueKubeconfigChain adds the token of tokenRequest to its chain and
+// sends the user on to request the token of the next cluster. The kubeconfig
+// file is written once every cluster was visited. Clusters whose token can't
+// be requested are left out.
+func (s *Server) continueKubeconfigChain(resolvers map[string]*auth.UserInfoResolver, tokenRequest *auth.TokenRequest, w http.ResponseWriter, r *http.Request) {
+	id := tokenRequest.KubeconfigChain
+	chain, ok := s.kubeconfigChains.add(id, tokenRequest.Cluster, &auth.User{Token: tokenRequest.Token})
+	if !ok {
+		serverutils.SendResponse(w, http.StatusBadRequest, serverutils.ApiError{Err: "The kubeconfig request expired, please start again"})
+		return
+	}
+	for {
+		name, ok := s.kubeconfigChains.next(id, chain)
+		if !ok {
+			break
+		}
+		authCodeURL, err := s.Authers[name].StartTokenRequest(w, true, id)
+		if err != nil {
+			klog.Errorf("leaving cluster %s out of kubeconfig: %v", name, err)
+			continue
+		}
+		http.Redirect(w, r, authCodeURL, http.StatusSeeOther)
+		return
+	}
+	s.writeKubeconfig(r.Context(), resolvers, chain.cluster, chain.users, w)
+}
+
+// writeKubeconfig renders a kubeconfig file with a context for each of the
+// users, by cluster name. The context of cluster is the current one.
+func (s *Server) writeKubeconfig(ctx context.Context, resolvers map[string]*auth.UserInfoResolver, cluster string, users map[string]*auth.User, w http.ResponseWriter) {
+	names := make([]string, 0, len(users))
+	for name := range users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	config := clientcmdv1.Config{
+		Kind:           "Config",
+		APIVersion:     "v1",
+		CurrentContext: cluster,
+	}
+	for _, name := range names {
+		clusterUser := users[name]
+		username := clusterUser.Username
+		if resolver, ok := resolvers[name]; ok && username == "" {
+			if userInfo, err := resolver.ResolveIdentity(ctx, clusterUser.Token); err == nil {
+				username = userInfo.Username
+			} else {
+				klog.Errorf("failed to resolve user info on cluster %s: %v", name, err)
+			}
+		}
+		authInfoName := name
+		if username != "" {
+			authInfoName = username + "/" + name
+		}
+
+		kubeconfigCluster := s.KubeconfigClusters[name]
+		config.Clusters = append(config.Clusters, clientcmdv1.NamedCluster{
+			Name: name,
+			Cluster: clientcmdv1.Cluster{
+				Server:                   kubeconfigCluster.Server,
+				CertificateAuthorityData: kubeconfigCluster.CAData,
+				InsecureSkipTLSVerify:    kubeconfigCluster.InsecureSkipTLSVerify,
+			},
+		})
+		config.AuthInfos = append(config.AuthInfos, clientcmdv1.NamedAuthInfo{
+			Name:     authInfoName,
+			AuthInfo: clientcmdv1.AuthInfo{Token: clusterUser.Token},
+		})
+		config.Contexts = append(config.Contexts, clientcmdv1.NamedContext{
+			Name:    name,
+			Context: clientcmdv1.Context{Cluster: name, AuthInfo: authInfoName},
+		})
+	}
+
+	data, err := yaml.Marshal(config)
+	if err != nil {
+		klog.Errorf("failed to render kubeconfig: %v", err)
+		serverutils.SendResponse(w, http.StatusInternalServerError, serverutils.ApiError{Err: fmt.Sprintf("Failed to render kubeconfig: %v", err)})
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Header().Set("Content-Disposition", `attachment; filename="kubeconfig"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// kubeconfigUser returns the console's own user on cluster, which kubeconfig
+// files hold when user authentication is disabled.
+func (s *Server) kubeconfigUser(cluster string) (*auth.User, error) {
+	tokenSource := s.ServiceAccountTokenSource
+	if managedClusterTokenSource, ok := s.ManagedClusterTokenSources[cluster]; ok {
+		tokenSource = managedClusterTokenSource
+	}
+	token, err := tokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+	return &auth.User{Token: token}, nil
+}
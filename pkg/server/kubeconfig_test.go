@@ -0,0 +1,201 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/openshift/console/pkg/auth"
+)
+
+func TestHandleKubeconfig(t *testing.T) {
+	s := &Server{
+		ServiceAccountTokenSource: auth.NewStaticTokenSource("local-token"),
+		ManagedClusterTokenSources: map[string]auth.TokenSource{
+			"spoke": auth.NewStaticTokenSource("spoke-token"),
+		},
+		KubeconfigClusters: map[string]KubeconfigCluster{
+			"local-cluster": {Server: "https://api.example.com:6443", CAData: []byte("local-ca")},
+			"spoke":         {Server: "https://api.spoke.example.com:6443", InsecureSkipTLSVerify: true},
+		},
+	}
+	user := &auth.User{Username: "alice", Token: "local-token"}
+
+	rr := httptest.NewRecorder()
+	s.handleKubeconfig(nil, user, rr, httptest.NewRequest("POST", "/api/console/kubeconfig", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rr.Code, rr.Body)
+	}
+	config, err := clientcmd.Load(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.CurrentContext != "local-cluster" || len(config.Contexts) != 1 {
+		t.Fatalf("expected a single context for the local cluster, got %#v", config.Contexts)
+	}
+	context := config.Contexts["local-cluster"]
+	if context.AuthInfo != "alice/local-cluster" || config.AuthInfos[context.AuthInfo].Token != "local-token" {
+		t.Errorf("unexpected user %q: %#v", context.AuthInfo, config.AuthInfos[context.AuthInfo])
+	}
+	if cluster := config.Clusters["local-cluster"]; cluster.Server != "https://api.example.com:6443" || string(cluster.CertificateAuthorityData) != "local-ca" {
+		t.Errorf("unexpected cluster: %#v", cluster)
+	}
+
+	rr = httptest.NewRecorder()
+	s.handleKubeconfig(nil, user, rr, httptest.NewRequest("POST", "/api/console/kubeconfig?all=true", nil))
+	if config, err = clientcmd.Load(rr.Body.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Contexts) != 2 {
+		t.Fatalf("expected a context for every cluster, got %#v", config.Contexts)
+	}
+	spoke := config.Contexts["spoke"]
+	if spoke == nil || config.AuthInfos[spoke.AuthInfo].Token != "spoke-token" || !config.Clusters["spoke"].InsecureSkipTLSVerify {
+		t.Errorf("unexpected context for the managed cluster: %#v", spoke)
+	}
+
+	rr = httptest.NewRecorder()
+	s.handleKubeconfig(nil, user, rr, httptest.NewRequest("POST", "/api/console/kubeconfig?cluster=unknown", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown cluster to be rejected, got status %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	s.handleKubeconfig(nil, user, rr, httptest.NewRequest("GET", "/api/console/kubeconfig", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected kubeconfig files to be issued on POST only, got status %d", rr.Code)
+	}
+}
+
+func TestRenderKubeconfigTokenRequest(t *testing.T) {
+	s := &Server{
+		KubeconfigClusters: map[string]KubeconfigCluster{
+			"spoke": {Server: "https://api.spoke.example.com:6443"},
+		},
+	}
+	rr := httptest.NewRecorder()
+	s.renderTokenRequest(nil, &auth.TokenRequest{Cluster: "spoke", Token: "cli-token", Kubeconfig: true}, rr, httptest.NewRequest("GET", "/auth/token/callback/spoke", nil))
+	config, err := clientcmd.Load(rr.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := config.Contexts["spoke"]
+	if config.CurrentContext != "spoke" || context == nil || config.AuthInfos[context.AuthInfo].Token != "cli-token" {
+		t.Errorf("expected a kubeconfig file with the requested token, got %s", rr.Body)
+	}
+}
+
+func TestHandleKubeconfigChain(t *testing.T) {
+	var issuer string
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/.well-known/oauth-authorization-server":
+			fmt.Fprintf(w, `{"issuer": %q, "authorization_endpoint": "%s/auth", "token_endpoint": "%s/token"}`, issuer, issuer, issuer)
+		case "/token":
+			clientID, _, _ := r.BasicAuth()
+			fmt.Fprintf(w, `{"access_token": "sha256~%s-token", "token_type": "Bearer"}`, clientID)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer idp.Close()
+	issuer = idp.URL
+
+	s := &Server{
+		Authers: map[string]*auth.Authenticator{},
+		KubeconfigClusters: map[string]KubeconfigCluster{
+			"local-cluster": {Server: "https://api.example.com:6443"},
+			"spoke":         {Server: "https://api.spoke.example.com:6443"},
+		},
+	}
+	for name := range s.KubeconfigClusters {
+		a, err := auth.NewAuthenticator(context.Background(), &auth.Config{
+			AuthSource:              auth.AuthSourceOpenShift,
+			ClientID:                "console",
+			ClientSecret:            "console-secret",
+			RedirectURL:             "http://example.com/auth/callback/" + name,
+			IssuerURL:               issuer,
+			ErrorURL:                "http://example.com/error",
+			CookiePath:              "/",
+			RefererPath:             "http://example.com/",
+			ClusterName:             name,
+			TokenRequestClientID:    name,
+			TokenRequestRedirectURL: "http://example.com/auth/token/callback/" + name,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Authers[name] = a
+	}
+	user := &auth.User{Username: "alice", Token: "session-token"}
+
+	rr := httptest.NewRecorder()
+	s.handleKubeconfig(nil, user, rr, httptest.NewRequest("POST", "/api/console/kubeconfig?all=true", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rr.Code, rr.Body)
+	}
+	var tokenRequest kubeconfigTokenRequest
+	if err := json.Unmarshal(rr.Body.Bytes(), &tokenRequest); err != nil {
+		t.Fatal(err)
+	}
+
+	// callback completes the token request on cluster the user was sent to.
+	callback := func(cluster, authCodeURL string, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		u, err := url.Parse(authCodeURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if clientID := u.Query().Get("client_id"); clientID != cluster {
+			t.Fatalf("expected a token request on cluster %s, got one for client %s", cluster, clientID)
+		}
+		r := httptest.NewRequest("GET", "http://example.com/auth/token/callback/"+cluster+"?code=code&state="+u.Query().Get("state"), nil)
+		// Like browsers, only keep the last value of a cookie set several times.
+		latest := map[string]*http.Cookie{}
+		for _, cookie := range cookies {
+			latest[cookie.Name] = cookie
+		}
+		for _, cookie := range latest {
+			if cookie.MaxAge >= 0 {
+				r.AddCookie(cookie)
+			}
+		}
+		rr := httptest.NewRecorder()
+		s.Authers[cluster].TokenRequestCallbackFunc(func(tokenRequest *auth.TokenRequest, w http.ResponseWriter, r *http.Request) {
+			s.renderTokenRequest(nil, tokenRequest, w, r)
+		})(rr, r)
+		return rr
+	}
+
+	// The token of the request's cluster comes first, then the user is sent on to the next cluster.
+	next := callback("local-cluster", tokenRequest.URL, rr.Result().Cookies())
+	if next.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect to the next cluster, got status %d: %s", next.Code, next.Body)
+	}
+	last := callback("spoke", next.Header().Get("Location"), next.Result().Cookies())
+	if last.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", last.Code, last.Body)
+	}
+	config, err := clientcmd.Load(last.Body.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.CurrentContext != "local-cluster" || len(config.Contexts) != 2 {
+		t.Fatalf("expected a context for every cluster, got %#v", config.Contexts)
+	}
+	for name, token := range map[string]string{"local-cluster": "sha256~local-cluster-token", "spoke": "sha256~spoke-token"} {
+		if context := config.Contexts[name]; context == nil || config.AuthInfos[context.AuthInfo].Token != token {
+			t.Errorf("expected the requested token in the context of cluster %s, got %#v", name, context)
+		}
+	}
+
+	// The chain is done, so the token request can't be replayed.
+	if replay := callback("spoke", next.Header().Get("Location"), next.Result().Cookies()); replay.Code != http.StatusBadRequest {
+		t.Errorf("expected a finished chain to be rejected, got status %d", replay.Code)
+	}
+}
@@ -35,10 +35,22 @@ func authMiddlewareWithUser(authers map[string]*auth.Authenticator, handlerFunc
 			return
 		}
 
-		user, err := auther.Authenticate(r)
+		// Requests carrying a bearer token come from automation rather than a
+		// browser session, so they are validated with a TokenReview instead.
+		// Without a token reviewer, they fall back to the session cookie.
+		var (
+			user   *auth.User
+			err    error
+			bearer = auther.BearerTokenEnabled() && auth.GetBearerToken(r) != ""
+		)
+		if bearer {
+			user, err = auther.AuthenticateBearerToken(r)
+		} else {
+			user, err = auther.Authenticate(w, r)
+		}
 		if err != nil {
 			klog.V(4).Infof("authentication failed: %v", err)
-			w.WriteHeader(http.StatusUnauthorized)
+			serverutils.SendResponse(w, http.StatusUnauthorized, serverutils.ApiError{Err: "Unauthorized"})
 			return
 		}
 		r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", user.Token))
@@ -52,24 +64,32 @@ func authMiddlewareWithUser(authers map[string]*auth.Authenticator, handlerFunc
 			"TRACE":
 			safe = true
 		}
-		if !safe {
-			if err := auther.VerifySourceOrigin(r); err != nil {
-				klog.Errorf("invalid source origin: %v", err)
-				w.WriteHeader(http.StatusForbidden)
-				return
-			}
-
-			if err := auther.VerifyCSRFToken(r); err != nil {
-				klog.Errorf("invalid CSRFToken: %v", err)
-				w.WriteHeader(http.StatusForbidden)
-				return
-			}
+		// CSRF protection is only needed for cookies, which browsers send automatically.
+		if !safe && !bearer && !verifyCSRF(auther, w, r) {
+			return
 		}
 
 		handlerFunc(user, w, r)
 	})
 }
 
+// verifyCSRF checks the source origin and CSRF token of a request made with
+// the session cookie, responding with 403 and returning false if either is invalid.
+func verifyCSRF(auther *auth.Authenticator, w http.ResponseWriter, r *http.Request) bool {
+	if err := auther.VerifySourceOrigin(r); err != nil {
+		klog.Errorf("invalid source origin: %v", err)
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+
+	if err := auther.VerifyCSRFToken(r); err != nil {
+		klog.Errorf("invalid CSRFToken: %v", err)
+		w.WriteHeader(http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
 type gzipResponseWriter struct {
 	io.Writer
 	http.ResponseWriter
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/serverutils"
+)
+
+func TestAuthMiddlewareWithoutTokenReviewer(t *testing.T) {
+	var issuer string
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/oauth-authorization-server" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"issuer": %q, "authorization_endpoint": "%s/auth", "token_endpoint": "%s/token"}`, issuer, issuer, issuer)
+	}))
+	defer idp.Close()
+	issuer = idp.URL
+
+	a, err := auth.NewAuthenticator(context.Background(), &auth.Config{
+		AuthSource:   auth.AuthSourceOpenShift,
+		ClientID:     "console",
+		ClientSecret: "console-secret",
+		RedirectURL:  "http://example.com/auth/callback",
+		IssuerURL:    issuer,
+		CookiePath:   "/",
+		RefererPath:  "http://example.com/",
+		ClusterName:  serverutils.LocalClusterName,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var token string
+	handler := authMiddlewareWithUser(map[string]*auth.Authenticator{serverutils.LocalClusterName: a}, func(user *auth.User, w http.ResponseWriter, r *http.Request) {
+		token = user.Token
+	})
+
+	// An Authorization header, e.g. added by a proxy in front of the console,
+	// doesn't keep the session cookie from being used.
+	r := httptest.NewRequest("GET", "/api/kubernetes/api", nil)
+	r.Header.Set("Authorization", "Bearer other-token")
+	r.AddCookie(&http.Cookie{Name: auth.GetCookieName(serverutils.LocalClusterName), Value: "sha256~session-token"})
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, r)
+	if rr.Code != http.StatusOK || token != "sha256~session-token" {
+		t.Errorf("expected the session to be used without a token reviewer, got status %d and token %q", rr.Code, token)
+	}
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/proxy"
+	"github.com/openshift/console/pkg/recording"
+)
+
+// terminalRecordingSession returns an observer recording the session if
+// terminal recording is enabled and r opens a pod exec or attach websocket.
+func (s *Server) terminalRecordingSession(resolvers map[string]*auth.UserInfoResolver, user *auth.User, cluster string, r *http.Request) proxy.WebsocketObserver {
+	if s.TerminalRecorder == nil || !websocket.IsWebSocketUpgrade(r) {
+		return nil
+	}
+	namespace, pod, ok := recording.ParseExecPath(r.URL.Path)
+	if !ok {
+		return nil
+	}
+
+	username := user.Username
+	if resolver, ok := resolvers[cluster]; ok && username == "" {
+		userInfo, err := resolver.ResolveIdentity(r.Context(), user.Token)
+		if err != nil {
+			klog.Warningf("failed to resolve the user of a recorded terminal session: %v", err)
+		} else {
+			username = userInfo.Username
+		}
+	}
+
+	query := r.URL.Query()
+	return s.TerminalRecorder.NewSession(recording.Metadata{
+		User:      username,
+		Cluster:   cluster,
+		Namespace: namespace,
+		Pod:       pod,
+		Container: query.Get("container"),
+		Command:   query["command"],
+	})
+}
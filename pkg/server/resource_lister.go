@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/openshift/console/pkg/auth"
 	"github.com/openshift/console/pkg/serverutils"
 
 	"k8s.io/klog"
@@ -21,7 +22,7 @@ type FilterFunction func(http.ResponseWriter, *http.Response)
 
 // resourceLister determines the list of resources of a particular kind
 type resourceLister struct {
-	bearerToken    string
+	tokenSource    auth.TokenSource
 	requestURL     *url.URL
 	client         *http.Client
 	responseFilter FilterFunction
@@ -40,7 +41,12 @@ func (l *resourceLister) HandleResources(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	req.Header.Set("Authorization", "Bearer "+l.bearerToken)
+	token, err := l.tokenSource.Token()
+	if err != nil {
+		serverutils.SendResponse(w, http.StatusInternalServerError, serverutils.ApiError{Err: fmt.Sprintf("failed to get service account token: %v", err)})
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
 	resp, err := l.client.Do(req)
 	if err != nil {
 		serverutils.SendResponse(w, http.StatusBadGateway, serverutils.ApiError{Err: fmt.Sprintf("GET request failed: %v", err)})
@@ -59,9 +65,9 @@ func (l *resourceLister) HandleResources(w http.ResponseWriter, r *http.Request)
 }
 
 // NewResourceLister shall instantiate & return resourceLister instance
-func NewResourceLister(bearerToken string, requestURL *url.URL, client *http.Client, respFilter FilterFunction) ResourceLister {
+func NewResourceLister(tokenSource auth.TokenSource, requestURL *url.URL, client *http.Client, respFilter FilterFunction) ResourceLister {
 	r := &resourceLister{
-		bearerToken:    bearerToken,
+		tokenSource:    tokenSource,
 		requestURL:     requestURL,
 		client:         client,
 		responseFilter: respFilter,
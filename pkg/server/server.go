@@ -2,29 +2,31 @@ package server
 
 import (
 	"context"
-	"crypto/sha256"
 	"crypto/tls"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"html/template"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/coreos/pkg/health"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	authorizationv1 "k8s.io/api/authorization/v1"
 	"k8s.io/klog"
 
 	"github.com/openshift/console/pkg/auth"
 	"github.com/openshift/console/pkg/graphql/resolver"
 	helmhandlerspkg "github.com/openshift/console/pkg/helm/handlers"
 	"github.com/openshift/console/pkg/plugins"
+	"github.com/openshift/console/pkg/podexec"
 	"github.com/openshift/console/pkg/proxy"
+	"github.com/openshift/console/pkg/recording"
 	"github.com/openshift/console/pkg/serverutils"
 	"github.com/openshift/console/pkg/terminal"
 	"github.com/openshift/console/pkg/usersettings"
@@ -39,6 +41,7 @@ const (
 	indexPageTemplateName              = "index.html"
 	tokenizerPageTemplateName          = "tokener.html"
 	multiclusterLogoutPageTemplateName = "multicluster-logout.html"
+	tokenRequestPageTemplateName       = "token-request.html"
 
 	authLoginEndpoint                = "/auth/login"
 	AuthLoginCallbackEndpoint        = "/auth/callback"
@@ -46,6 +49,9 @@ const (
 	AuthLoginErrorEndpoint           = "/error"
 	authLogoutEndpoint               = "/auth/logout"
 	authLogoutMulticlusterEndpoint   = "/api/logout/multicluster"
+	authBackChannelLogoutEndpoint    = "/auth/backchannel-logout"
+	authTokenRequestEndpoint         = "/auth/token/request"
+	AuthTokenRequestCallbackEndpoint = "/auth/token/callback"
 	k8sProxyEndpoint                 = "/api/kubernetes/"
 	graphQLEndpoint                  = "/api/graphql"
 	prometheusProxyEndpoint          = "/api/prometheus"
@@ -64,9 +70,31 @@ const (
 	updatesEndpoint                  = "/api/check-updates"
 	operandsListEndpoint             = "/api/list-operands/"
 	accountManagementEndpoint        = "/api/accounts_mgmt/"
-	sha256Prefix                     = "sha256~"
+	whoamiEndpoint                   = "/api/console/whoami"
+	sessionsEndpoint                 = "/api/console/sessions"
+	clusterStatusEndpoint            = "/api/console/clusters"
+	kubeconfigEndpoint               = "/api/console/kubeconfig"
+	pluginStatusEndpoint             = "/api/console/plugins/status"
+	readinessEndpoint                = "/readiness"
 )
 
+// sessionAdminAttributes is the access needed to manage the sessions of other
+// users. Users allowed to delete any OAuth access token can end any session anyway.
+var sessionAdminAttributes = authorizationv1.ResourceAttributes{
+	Verb:     "delete",
+	Group:    "oauth.openshift.io",
+	Resource: "oauthaccesstokens",
+}
+
+// pluginStatusAttributes is the access needed to get the plugin status, which
+// exposes the internal plugin endpoints. Users allowed to list the console
+// plugins can read their services anyway.
+var pluginStatusAttributes = authorizationv1.ResourceAttributes{
+	Verb:     "list",
+	Group:    "console.openshift.io",
+	Resource: "consoleplugins",
+}
+
 type jsGlobals struct {
 	ConsoleVersion             string   `json:"consoleVersion"`
 	AuthDisabled               bool     `json:"authDisabled"`
@@ -107,28 +135,31 @@ type jsGlobals struct {
 	ProjectAccessClusterRoles  string   `json:"projectAccessClusterRoles"`
 	Clusters                   []string `json:"clusters"`
 	ControlPlaneTopology       string   `json:"controlPlaneTopology"`
+	TerminalAdminNamespace     string   `json:"terminalAdminNamespace"`
 }
 
 type Server struct {
-	K8sProxyConfigs      map[string]*proxy.Config
-	BaseURL              *url.URL
-	LogoutRedirect       *url.URL
-	PublicDir            string
-	TectonicVersion      string
-	Authers              map[string]*auth.Authenticator
-	StaticUser           *auth.User
-	ServiceAccountToken  string
-	KubectlClientID      string
-	KubeAPIServerURL     string
-	KubeVersion          string
-	DocumentationBaseURL *url.URL
-	Branding             string
-	CustomProductName    string
-	CustomLogoFile       string
-	ControlPlaneTopology string
-	StatuspageID         string
-	LoadTestFactor       int
-	InactivityTimeout    int
+	K8sProxyConfigs map[string]*proxy.Config
+	BaseURL         *url.URL
+	LogoutRedirect  *url.URL
+	PublicDir       string
+	TectonicVersion string
+	Authers         map[string]*auth.Authenticator
+	// ServiceAccountTokenSource supplies the token of bridge's own API requests.
+	// When authentication is disabled, all users act with this token.
+	ServiceAccountTokenSource auth.TokenSource
+	KubectlClientID           string
+	KubeAPIServerURL          string
+	KubeconfigClusters        map[string]KubeconfigCluster
+	KubeVersion               string
+	DocumentationBaseURL      *url.URL
+	Branding                  string
+	CustomProductName         string
+	CustomLogoFile            string
+	ControlPlaneTopology      string
+	StatuspageID              string
+	LoadTestFactor            int
+	InactivityTimeout         int
 	// Map that contains list of enabled plugins and their endpoints.
 	EnabledConsolePlugins map[string]string
 	PluginProxy           string
@@ -141,9 +172,17 @@ type Server struct {
 	AlertManagerTenancyProxyConfig   *proxy.Config
 	MeteringProxyConfig              *proxy.Config
 	TerminalProxyTLSConfig           *tls.Config
+	TerminalAdminNamespace           string
+	TerminalRecorder                 *recording.Recorder
+	PodExecPolicy                    podexec.Policy
 	PluginsProxyTLSConfig            *tls.Config
+	PluginManifestChecker            *plugins.ManifestChecker
+	PluginAssetCache                 *plugins.AssetCache
+	PluginIntegrityVerifier          *plugins.IntegrityVerifier
 	GitOpsProxyConfig                *proxy.Config
 	ClusterManagementProxyConfig     *proxy.Config
+	// Tokens users act with on managed clusters when authentication is disabled.
+	ManagedClusterTokenSources map[string]auth.TokenSource
 	// A lister for resource listing of a particular kind
 	MonitoringDashboardConfigMapLister ResourceLister
 	KnativeEventSourceCRDLister        ResourceLister
@@ -160,6 +199,10 @@ type Server struct {
 	QuickStarts               string
 	AddPage                   string
 	ProjectAccessClusterRoles string
+
+	// kubeconfigChains holds the kubeconfig files with a context for every
+	// cluster whose tokens are being requested.
+	kubeconfigChains kubeconfigChains
 }
 
 func (s *Server) authDisabled() bool {
@@ -211,21 +254,35 @@ func (s *Server) HTTPHandler() http.Handler {
 		k8sProxies[cluster] = proxy.NewProxy(proxyConfig)
 	}
 
+	userInfoResolvers := make(map[string]*auth.UserInfoResolver, len(s.K8sProxyConfigs))
+	for cluster, k8sProxyConfig := range s.K8sProxyConfigs {
+		var tokenReviewer *auth.TokenReviewer
+		if cluster == serverutils.LocalClusterName {
+			// Resolves users on clusters without the OpenShift user API.
+			tokenReviewer = auth.NewTokenReviewer(s.K8sClients[cluster], k8sProxyConfig.Endpoint, s.ServiceAccountTokenSource)
+		}
+		userInfoResolvers[cluster] = auth.NewUserInfoResolver(s.K8sClients[cluster], k8sProxyConfig.Endpoint, tokenReviewer)
+	}
+
 	handle := func(path string, handler http.Handler) {
 		mux.Handle(proxy.SingleJoiningSlash(s.BaseURL.Path, path), handler)
 	}
 
 	handleFunc := func(path string, handler http.HandlerFunc) { handle(path, handler) }
 
+	defaultLoginSuccessURL := proxy.SingleJoiningSlash(s.BaseURL.String(), AuthLoginSuccessEndpoint)
 	fn := func(loginInfo auth.LoginJSON, successURL string, w http.ResponseWriter) {
 		jsg := struct {
 			auth.LoginJSON    `json:",inline"`
 			LoginSuccessURL   string `json:"loginSuccessURL"`
+			RequestedPage     bool   `json:"requestedPage"`
 			Branding          string `json:"branding"`
 			CustomProductName string `json:"customProductName"`
 		}{
-			LoginJSON:         loginInfo,
-			LoginSuccessURL:   successURL,
+			LoginJSON:       loginInfo,
+			LoginSuccessURL: successURL,
+			// The user asked for a specific page with the `then` parameter of the login endpoint.
+			RequestedPage:     successURL != defaultLoginSuccessURL,
 			Branding:          s.Branding,
 			CustomProductName: s.CustomProductName,
 		}
@@ -257,21 +314,47 @@ func (s *Server) HTTPHandler() http.Handler {
 		}
 		authHandlerWithUser = func(hf func(*auth.User, http.ResponseWriter, *http.Request)) http.Handler {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-				hf(s.StaticUser, w, r)
+				// Read the token for every request, it may have been rotated.
+				tokenSource := s.ServiceAccountTokenSource
+				if managedClusterTokenSource, ok := s.ManagedClusterTokenSources[serverutils.GetCluster(r)]; ok {
+					tokenSource = managedClusterTokenSource
+				}
+				token, err := tokenSource.Token()
+				if err != nil {
+					klog.Errorf("failed to get service account token: %v", err)
+					serverutils.SendResponse(w, http.StatusInternalServerError, serverutils.ApiError{Err: "Failed to get service account token"})
+					return
+				}
+				hf(&auth.User{Token: token}, w, r)
 			})
 		}
 	}
 
 	if !s.authDisabled() {
 		handleFunc(authLoginEndpoint, localAuther.LoginFunc)
-		handleFunc(authLogoutEndpoint, localAuther.LogoutFunc)
+		handleFunc(authLogoutEndpoint, s.handleLogout)
+		// Logs out of a single cluster: /auth/logout/<cluster>
+		handleFunc(authLogoutEndpoint+"/", s.handleLogout)
 		handleFunc(authLogoutMulticlusterEndpoint, s.handleLogoutMulticluster)
 		handleFunc(AuthLoginCallbackEndpoint, localAuther.CallbackFunc(fn))
-		handle("/api/openshift/delete-token", authHandlerWithUser(s.handleOpenShiftTokenDeletion))
+		// Called by the identity provider, so neither authenticated nor CSRF protected.
+		handleFunc(authBackChannelLogoutEndpoint, localAuther.BackChannelLogoutFunc)
+		renderTokenRequest := func(tokenRequest *auth.TokenRequest, w http.ResponseWriter, r *http.Request) {
+			s.renderTokenRequest(userInfoResolvers, tokenRequest, w, r)
+		}
+		if localAuther.TokenRequestEnabled() {
+			handleFunc(authTokenRequestEndpoint, localAuther.TokenRequestFunc)
+			handleFunc(AuthTokenRequestCallbackEndpoint, localAuther.TokenRequestCallbackFunc(renderTokenRequest))
+		}
 		for clusterName, clusterAuther := range s.Authers {
 			if clusterAuther != nil {
 				handleFunc(fmt.Sprintf("%s/%s", authLoginEndpoint, clusterName), clusterAuther.LoginFunc)
 				handleFunc(fmt.Sprintf("%s/%s", AuthLoginCallbackEndpoint, clusterName), clusterAuther.CallbackFunc(fn))
+				handleFunc(fmt.Sprintf("%s/%s", authBackChannelLogoutEndpoint, clusterName), clusterAuther.BackChannelLogoutFunc)
+				if clusterAuther.TokenRequestEnabled() {
+					handleFunc(fmt.Sprintf("%s/%s", authTokenRequestEndpoint, clusterName), clusterAuther.TokenRequestFunc)
+					handleFunc(fmt.Sprintf("%s/%s", AuthTokenRequestCallbackEndpoint, clusterName), clusterAuther.TokenRequestCallbackFunc(renderTokenRequest))
+				}
 			}
 		}
 	}
@@ -296,6 +379,20 @@ func (s *Server) HTTPHandler() http.Handler {
 		Checks: []health.Checkable{},
 	}.ServeHTTP)
 
+	// The console is ready once users can log in to the local cluster and the
+	// plugins have been checked. Other clusters are reported by the cluster
+	// status API instead, broken plugins by the plugin status API.
+	readinessChecks := []health.Checkable{}
+	if localAuther != nil {
+		readinessChecks = append(readinessChecks, localAuther)
+	}
+	if s.PluginManifestChecker != nil {
+		readinessChecks = append(readinessChecks, s.PluginManifestChecker)
+	}
+	handleFunc(readinessEndpoint, health.Checker{
+		Checks: readinessChecks,
+	}.ServeHTTP)
+
 	handle(k8sProxyEndpoint, http.StripPrefix(
 		proxy.SingleJoiningSlash(s.BaseURL.Path, k8sProxyEndpoint),
 		authHandlerWithUser(func(user *auth.User, w http.ResponseWriter, r *http.Request) {
@@ -308,22 +405,57 @@ func (s *Server) HTTPHandler() http.Handler {
 				return
 			}
 
-			r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", user.Token))
-			k8sProxy.ServeHTTP(w, r)
+			// The exec policy is only enforced by the pod exec endpoint, so
+			// sessions can't bypass it through the API server.
+			if s.PodExecPolicy.Enabled() {
+				if _, _, ok := recording.ParseExecPath(path.Clean("/" + r.URL.Path)); ok {
+					http.Error(w, "Pod exec and attach sessions must go through "+podexec.Endpoint+" when an exec policy is configured", http.StatusForbidden)
+					return
+				}
+			}
+
+			// Without a token, e.g. with a kubeconfig user authenticating with a
+			// client certificate, the proxy's TLS config authenticates the request.
+			if user.Token != "" {
+				r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", user.Token))
+			}
+			k8sProxy.ServeObservedHTTP(w, r, s.terminalRecordingSession(userInfoResolvers, user, cluster, r))
 		})),
 	)
 
 	handleFunc(devfileEndpoint, s.devfileHandler)
 	handleFunc(devfileSamplesEndpoint, s.devfileSamplesHandler)
 
+	// Managed clusters without a console token source have the web terminal
+	// operator detected with the user's token.
+	serviceAccountTokenSources := map[string]auth.TokenSource{serverutils.LocalClusterName: s.ServiceAccountTokenSource}
+	for cluster, tokenSource := range s.ManagedClusterTokenSources {
+		serviceAccountTokenSources[cluster] = tokenSource
+	}
 	terminalProxy := terminal.NewProxy(
 		s.TerminalProxyTLSConfig,
-		localK8sProxyConfig.TLSClientConfig,
-		localK8sProxyConfig.Endpoint)
+		s.K8sProxyConfigs,
+		s.K8sClients,
+		serviceAccountTokenSources,
+		userInfoResolvers,
+		s.TerminalAdminNamespace)
 
 	handle(terminal.ProxyEndpoint, authHandlerWithUser(terminalProxy.HandleProxy))
-	handleFunc(terminal.AvailableEndpoint, terminalProxy.HandleProxyEnabled)
-	handleFunc(terminal.InstalledNamespaceEndpoint, terminalProxy.HandleTerminalInstalledNamespace)
+	handle(terminal.AvailableEndpoint, authHandlerWithUser(terminalProxy.HandleProxyEnabled))
+	handle(terminal.InstalledNamespaceEndpoint, authHandlerWithUser(terminalProxy.HandleTerminalInstalledNamespace))
+	handle(terminal.ProvisionEndpoint, authHandlerWithUser(terminalProxy.HandleProvision))
+
+	podExecHandler := podexec.NewHandler(podexec.Config{
+		K8sProxyConfigs:   s.K8sProxyConfigs,
+		K8sClients:        s.K8sClients,
+		UserInfoResolvers: userInfoResolvers,
+		Policy:            s.PodExecPolicy,
+		Recorder:          s.TerminalRecorder,
+	})
+	handle(podexec.Endpoint, http.StripPrefix(
+		proxy.SingleJoiningSlash(s.BaseURL.Path, podexec.Endpoint),
+		authHandlerWithUser(podExecHandler.HandleExec),
+	))
 
 	graphQLSchema, err := ioutil.ReadFile("pkg/graphql/schema.graphql")
 	if err != nil {
@@ -515,13 +647,31 @@ func (s *Server) HTTPHandler() http.Handler {
 	handle("/api/console/knative-event-sources", authHandler(s.handleKnativeEventSourceCRDs))
 	handle("/api/console/knative-channels", authHandler(s.handleKnativeChannelCRDs))
 	handle("/api/console/version", authHandler(s.versionHandler))
+	handle(auth.UserActivityEndpoint, authHandler(s.handleUserActivity))
+	handle(clusterStatusEndpoint, authHandler(s.handleClusterStatus))
+
+	handle(whoamiEndpoint, authHandlerWithUser(func(user *auth.User, w http.ResponseWriter, r *http.Request) {
+		s.handleWhoami(userInfoResolvers, user, w, r)
+	}))
+	handle(kubeconfigEndpoint, authHandlerWithUser(func(user *auth.User, w http.ResponseWriter, r *http.Request) {
+		s.handleKubeconfig(userInfoResolvers, user, w, r)
+	}))
+	if !s.authDisabled() {
+		sessionsHandler := authHandlerWithUser(func(user *auth.User, w http.ResponseWriter, r *http.Request) {
+			s.handleSessions(userInfoResolvers, user, w, r)
+		})
+		handle(sessionsEndpoint, sessionsHandler)
+		// A single session: /api/console/sessions/<id>
+		handle(sessionsEndpoint+"/", sessionsHandler)
+	}
 
 	// User settings
 	userSettingHandler := usersettings.UserSettingsHandler{
-		K8sProxyConfig:      localK8sProxyConfig,
-		Client:              localK8sClient,
-		Endpoint:            localK8sProxyConfig.Endpoint.String(),
-		ServiceAccountToken: s.ServiceAccountToken,
+		K8sProxyConfig:            localK8sProxyConfig,
+		Client:                    localK8sClient,
+		Endpoint:                  localK8sProxyConfig.Endpoint.String(),
+		ServiceAccountTokenSource: s.ServiceAccountTokenSource,
+		UserInfoResolver:          userInfoResolvers[serverutils.LocalClusterName],
 	}
 	handle("/api/console/user-settings", authHandlerWithUser(userSettingHandler.HandleUserSettings))
 
@@ -536,6 +686,9 @@ func (s *Server) HTTPHandler() http.Handler {
 		},
 		s.EnabledConsolePlugins,
 		s.PublicDir,
+		s.PluginManifestChecker,
+		s.PluginAssetCache,
+		s.PluginIntegrityVerifier,
 	)
 
 	handle(pluginAssetsEndpoint, http.StripPrefix(
@@ -551,7 +704,12 @@ func (s *Server) HTTPHandler() http.Handler {
 			klog.Fatalf("Error parsing plugin proxy config: %s", err)
 			os.Exit(1)
 		}
-		proxyServiceHandlers, err := plugins.GetPluginProxyServiceHandlers(proxyConfig, s.PluginsProxyTLSConfig, pluginProxyEndpoint)
+		proxyServiceHandlers, err := plugins.GetPluginProxyServiceHandlers(
+			proxyConfig,
+			s.PluginsProxyTLSConfig,
+			pluginProxyEndpoint,
+			userInfoResolvers[serverutils.LocalClusterName],
+		)
 		if err != nil {
 			klog.Fatalf("Error getting plugin proxy handlers: %s", err)
 			os.Exit(1)
@@ -560,15 +718,21 @@ func (s *Server) HTTPHandler() http.Handler {
 			klog.Infoln("The following console endpoints are now proxied to these services:")
 		}
 		for _, proxyServiceHandler := range proxyServiceHandlers {
+			proxyServiceHandler := proxyServiceHandler
 			klog.Infof(" - %s -> %s\n", proxyServiceHandler.ConsoleEndpoint, proxyServiceHandler.ProxyConfig.Endpoint)
 			serviceProxy := proxy.NewProxy(proxyServiceHandler.ProxyConfig)
 			f := func(w http.ResponseWriter, r *http.Request) {
-				serviceProxy.ServeHTTP(w, r)
+				proxyServiceHandler.ProxyRequest(serviceProxy, nil, w, r)
 			}
 			var h http.Handler
-			if proxyServiceHandler.Authorize {
+			switch {
+			case proxyServiceHandler.RequiresUser():
+				h = authHandlerWithUser(func(user *auth.User, w http.ResponseWriter, r *http.Request) {
+					proxyServiceHandler.ProxyRequest(serviceProxy, user, w, r)
+				})
+			case proxyServiceHandler.Authorization == "" && proxyServiceHandler.Authorize:
 				h = authHandler(f)
-			} else {
+			default:
 				h = http.HandlerFunc(f)
 			}
 			handle(proxyServiceHandler.ConsoleEndpoint, http.StripPrefix(
@@ -580,6 +744,12 @@ func (s *Server) HTTPHandler() http.Handler {
 
 	handle(updatesEndpoint, authHandler(pluginsHandler.HandleCheckUpdates))
 
+	if s.PluginManifestChecker != nil {
+		handle(pluginStatusEndpoint, authHandlerWithUser(func(user *auth.User, w http.ResponseWriter, r *http.Request) {
+			s.handlePluginStatus(userInfoResolvers[serverutils.LocalClusterName], user, w, r)
+		}))
+	}
+
 	// we need to create another instance of `PluginsHandler` with shorter timeout,
 	// so calls for plugins that doesnt contain locales will fail sooner
 	i18nPluginsHandler := plugins.NewPluginsHandler(
@@ -589,6 +759,9 @@ func (s *Server) HTTPHandler() http.Handler {
 		},
 		s.EnabledConsolePlugins,
 		s.PublicDir,
+		nil,
+		nil,
+		nil,
 	)
 
 	handleFunc(localesEndpoint, func(w http.ResponseWriter, r *http.Request) {
@@ -674,6 +847,10 @@ func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
 
 	plugins := make([]string, 0, len(s.EnabledConsolePlugins))
 	for plugin := range s.EnabledConsolePlugins {
+		// Incompatible plugins would break the console for every user.
+		if s.PluginManifestChecker != nil && s.PluginManifestChecker.IsExcluded(plugin) {
+			continue
+		}
 		plugins = append(plugins, plugin)
 	}
 
@@ -697,6 +874,7 @@ func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
 		Branding:                   s.Branding,
 		CustomProductName:          s.CustomProductName,
 		ControlPlaneTopology:       s.ControlPlaneTopology,
+		TerminalAdminNamespace:     s.TerminalAdminNamespace,
 		StatuspageID:               s.StatuspageID,
 		InactivityTimeout:          s.InactivityTimeout,
 		DocumentationBaseURL:       s.DocumentationBaseURL.String(),
@@ -722,6 +900,9 @@ func (s *Server) indexHandler(w http.ResponseWriter, r *http.Request) {
 	if !s.authDisabled() {
 		specialAuthURLs := localAuther.GetSpecialURLs()
 		jsg.RequestTokenURL = specialAuthURLs.RequestToken
+		if localAuther.TokenRequestEnabled() {
+			jsg.RequestTokenURL = s.tokenRequestEndpoint(serverutils.LocalClusterName)
+		}
 		jsg.KubeAdminLogoutURL = specialAuthURLs.KubeAdminLogout
 	}
 
@@ -767,70 +948,267 @@ func (s *Server) versionHandler(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func notFoundHandler(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	w.Write([]byte("not found"))
+// handleUserActivity acknowledges user activity reports from the frontend. The
+// activity itself is recorded by the auth middleware.
+func (s *Server) handleUserActivity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		serverutils.SendResponse(w, http.StatusMethodNotAllowed, serverutils.ApiError{Err: "Invalid method: only POST is allowed"})
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (s *Server) handleOpenShiftTokenDeletion(user *auth.User, w http.ResponseWriter, r *http.Request) {
-	if r.Method != "POST" {
-		serverutils.SendResponse(w, http.StatusMethodNotAllowed, serverutils.ApiError{Err: "Invalid method: only POST is allowed"})
+// handleClusterStatus reports whether login is available for each cluster.
+func (s *Server) handleClusterStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		serverutils.SendResponse(w, http.StatusMethodNotAllowed, serverutils.ApiError{Err: "Invalid method: only GET is allowed"})
+		return
+	}
+
+	statuses := []auth.Status{}
+	for _, auther := range s.Authers {
+		if auther != nil {
+			statuses = append(statuses, auther.Status())
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Cluster < statuses[j].Cluster
+	})
+	w.Header().Set("Cache-Control", "no-store")
+	serverutils.SendResponse(w, http.StatusOK, statuses)
+}
+
+func (s *Server) handleWhoami(resolvers map[string]*auth.UserInfoResolver, user *auth.User, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		serverutils.SendResponse(w, http.StatusMethodNotAllowed, serverutils.ApiError{Err: "Invalid method: only GET is allowed"})
 		return
 	}
 
-	// Proxy request to correct cluster
 	cluster := serverutils.GetCluster(r)
-	k8sProxy, k8sProxyFound := s.K8sProxyConfigs[cluster]
-	k8sClient, k8sClientFound := s.K8sClients[cluster]
-	if !k8sProxyFound || !k8sClientFound {
-		klog.Errorf("Bad Request. Invalid cluster: %v", cluster)
-		w.WriteHeader(http.StatusBadRequest)
+	resolver, ok := resolvers[cluster]
+	if !ok {
+		serverutils.SendResponse(w, http.StatusBadRequest, serverutils.ApiError{Err: fmt.Sprintf("Invalid cluster: %v", cluster)})
 		return
 	}
 
-	tokenName := user.Token
-	if strings.HasPrefix(tokenName, sha256Prefix) {
-		tokenName = tokenToObjectName(tokenName)
+	userInfo, err := resolver.Resolve(r.Context(), user.Token)
+	if errors.Is(err, auth.ErrUnauthorized) {
+		serverutils.SendResponse(w, http.StatusUnauthorized, serverutils.ApiError{Err: err.Error()})
+		return
+	}
+	if err != nil {
+		klog.Errorf("failed to resolve user info: %v", err)
+		serverutils.SendResponse(w, http.StatusBadGateway, serverutils.ApiError{Err: fmt.Sprintf("Failed to get user info: %v", err)})
+		return
 	}
+	w.Header().Set("Cache-Control", "no-store")
+	serverutils.SendResponse(w, http.StatusOK, userInfo)
+}
 
-	// Delete the OpenShift OAuthAccessToken.
-	path := "/apis/oauth.openshift.io/v1/oauthaccesstokens/" + tokenName
-	url := proxy.SingleJoiningSlash(k8sProxy.Endpoint.String(), path)
-	req, err := http.NewRequest("DELETE", url, nil)
+// handlePluginStatus reports the status of the plugins to users allowed to
+// list the console plugins.
+func (s *Server) handlePluginStatus(resolver *auth.UserInfoResolver, user *auth.User, w http.ResponseWriter, r *http.Request) {
+	allowed, err := resolver.Authorize(r.Context(), user.Token, pluginStatusAttributes)
 	if err != nil {
-		serverutils.SendResponse(w, http.StatusInternalServerError, serverutils.ApiError{Err: fmt.Sprintf("Failed to create token DELETE request: %v", err)})
+		klog.Errorf("failed to review access to the plugin status: %v", err)
+		serverutils.SendResponse(w, http.StatusBadGateway, serverutils.ApiError{Err: fmt.Sprintf("Failed to review access: %v", err)})
 		return
 	}
+	if !allowed {
+		serverutils.SendResponse(w, http.StatusForbidden, serverutils.ApiError{Err: "Not allowed to get the plugin status"})
+		return
+	}
+	s.PluginManifestChecker.HandleStatus(w, r)
+}
 
-	r.Header.Set("Authorization", fmt.Sprintf("Bearer %s", user.Token))
-	resp, err := k8sClient.Do(req)
+// handleSessions lists and ends the console sessions of the user on the
+// request's cluster. Admins can manage the sessions of other users by passing
+// the `user` query parameter or the ID of their session.
+func (s *Server) handleSessions(resolvers map[string]*auth.UserInfoResolver, user *auth.User, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "GET, DELETE")
+		serverutils.SendResponse(w, http.StatusMethodNotAllowed, serverutils.ApiError{Err: "Invalid method: only GET and DELETE are allowed"})
+		return
+	}
+
+	cluster := serverutils.GetCluster(r)
+	auther, resolver := s.Authers[cluster], resolvers[cluster]
+	if auther == nil || resolver == nil {
+		serverutils.SendResponse(w, http.StatusBadRequest, serverutils.ApiError{Err: fmt.Sprintf("Invalid cluster: %v", cluster)})
+		return
+	}
+
+	username := user.Username
+	if username == "" {
+		userInfo, err := resolver.ResolveIdentity(r.Context(), user.Token)
+		if err != nil {
+			klog.Errorf("failed to resolve user info: %v", err)
+			serverutils.SendResponse(w, http.StatusBadGateway, serverutils.ApiError{Err: fmt.Sprintf("Failed to get user info: %v", err)})
+			return
+		}
+		username = userInfo.Username
+	}
+
+	target := username
+	if u := r.URL.Query().Get("user"); u != "" {
+		target = u
+	}
+	id := strings.TrimPrefix(r.URL.Path, proxy.SingleJoiningSlash(s.BaseURL.Path, sessionsEndpoint))
+	id = strings.Trim(id, "/")
+	found := true
+	if id != "" {
+		var session *auth.SessionInfo
+		if session, found = auther.Session(id); found {
+			target = session.Username
+		}
+	}
+
+	if !found || target != username {
+		allowed, err := resolver.Authorize(r.Context(), user.Token, sessionAdminAttributes)
+		if err != nil {
+			klog.Errorf("failed to review access to sessions of other users: %v", err)
+			serverutils.SendResponse(w, http.StatusBadGateway, serverutils.ApiError{Err: fmt.Sprintf("Failed to review access: %v", err)})
+			return
+		}
+		// Sessions of other users look like missing ones, so that users can't
+		// probe which session IDs exist.
+		if !allowed && id != "" {
+			serverutils.SendResponse(w, http.StatusNotFound, serverutils.ApiError{Err: "Session not found"})
+			return
+		}
+		if !allowed {
+			serverutils.SendResponse(w, http.StatusForbidden, serverutils.ApiError{Err: "Not allowed to manage the sessions of other users"})
+			return
+		}
+	}
+	if !found {
+		serverutils.SendResponse(w, http.StatusNotFound, serverutils.ApiError{Err: "Session not found"})
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if r.Method == http.MethodGet {
+		sessions := auther.Sessions(r, target)
+		if id != "" {
+			for _, session := range sessions {
+				if session.ID == id {
+					serverutils.SendResponse(w, http.StatusOK, session)
+					return
+				}
+			}
+			serverutils.SendResponse(w, http.StatusNotFound, serverutils.ApiError{Err: "Session not found"})
+			return
+		}
+		serverutils.SendResponse(w, http.StatusOK, struct {
+			Sessions []auth.SessionInfo `json:"sessions"`
+		}{sessions})
+		return
+	}
+
+	revoked, err := auther.RevokeSessions(r.Context(), target, id)
+	if target != username && len(revoked) != 0 {
+		klog.Infof("user %q ended %d sessions of user %q on cluster %s", username, len(revoked), target, cluster)
+	}
 	if err != nil {
-		serverutils.SendResponse(w, http.StatusBadGateway, serverutils.ApiError{Err: fmt.Sprintf("Failed to delete token: %v", err)})
+		// The sessions whose token couldn't be revoked are still valid.
+		serverutils.SendResponse(w, http.StatusBadGateway, struct {
+			Revoked []auth.SessionInfo `json:"revoked"`
+			Error   string             `json:"error"`
+		}{revoked, err.Error()})
+		return
+	}
+	if id != "" && len(revoked) == 0 {
+		serverutils.SendResponse(w, http.StatusNotFound, serverutils.ApiError{Err: "Session not found"})
 		return
 	}
+	serverutils.SendResponse(w, http.StatusOK, struct {
+		Revoked []auth.SessionInfo `json:"revoked"`
+	}{revoked})
+}
 
-	w.WriteHeader(resp.StatusCode)
-	io.Copy(w, resp.Body)
-	resp.Body.Close()
+func notFoundHandler(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotFound)
+	w.Write([]byte("not found"))
 }
 
-func (s *Server) handleLogoutMulticluster(w http.ResponseWriter, r *http.Request) {
-	for cluster, auther := range s.Authers {
-		cookieName := auth.GetCookieName(cluster)
-		if cookie, _ := r.Cookie(cookieName); cookie != nil {
-			clearedCookie := http.Cookie{
-				Name:     cookie.Name,
-				Value:    "",
-				MaxAge:   0,
-				HttpOnly: cookie.HttpOnly,
-				Path:     auther.GetCookiePath(),
-				Secure:   cookie.Secure,
-			}
-			klog.Infof("Deleting cookie %v", cookie.Name)
-			http.SetCookie(w, &clearedCookie)
+// logoutClusters logs the user out of every cluster they have a session for,
+// or only of the given cluster if not empty.
+func (s *Server) logoutClusters(w http.ResponseWriter, r *http.Request, only string) []*auth.LogoutResult {
+	clusters := make([]string, 0, len(s.Authers))
+	for cluster := range s.Authers {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+
+	results := []*auth.LogoutResult{}
+	for _, cluster := range clusters {
+		auther := s.Authers[cluster]
+		if auther == nil || (only != "" && cluster != only) || !auther.HasSession(r) {
+			continue
 		}
+		klog.Infof("Logging out of cluster %v", cluster)
+		results = append(results, auther.Logout(w, r))
 	}
+	return results
+}
 
+// handleLogout revokes the user's tokens and deletes their sessions on all
+// clusters, or on the cluster named in the path.
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		serverutils.SendResponse(w, http.StatusMethodNotAllowed, serverutils.ApiError{Err: "Invalid method: only POST is allowed"})
+		return
+	}
+	if !verifyCSRF(s.getLocalAuther(), w, r) {
+		return
+	}
+
+	cluster := strings.TrimPrefix(r.URL.Path, proxy.SingleJoiningSlash(s.BaseURL.Path, authLogoutEndpoint))
+	cluster = strings.Trim(cluster, "/")
+	if _, ok := s.Authers[cluster]; cluster != "" && !ok {
+		serverutils.SendResponse(w, http.StatusBadRequest, serverutils.ApiError{Err: fmt.Sprintf("Invalid cluster: %v", cluster)})
+		return
+	}
+
+	results := s.logoutClusters(w, r, cluster)
+	resp := struct {
+		Results []*auth.LogoutResult `json:"results"`
+		// EndSessionURL is where the browser should go to end the identity provider session.
+		EndSessionURL string `json:"endSessionURL,omitempty"`
+	}{Results: results}
+	for _, result := range results {
+		if result.EndSessionURL != "" {
+			resp.EndSessionURL = result.EndSessionURL
+			break
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	serverutils.SendResponse(w, http.StatusOK, resp)
+}
+
+// handleLogoutMulticluster revokes the user's tokens and deletes their sessions
+// on all clusters, then renders the logout page. A GET logs nothing out, so that
+// links from other sites can't, and only redirects to the console.
+func (s *Server) handleLogoutMulticluster(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		http.Redirect(w, r, s.BaseURL.Path, http.StatusSeeOther)
+		return
+	case http.MethodPost:
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		serverutils.SendResponse(w, http.StatusMethodNotAllowed, serverutils.ApiError{Err: "Invalid method: only GET and POST are allowed"})
+		return
+	}
+	if !verifyCSRF(s.getLocalAuther(), w, r) {
+		return
+	}
+
+	s.logoutClusters(w, r, "")
 	jsg := struct {
 		BasePath          string `json:"basePath"`
 		Branding          string `json:"branding"`
@@ -854,14 +1232,6 @@ func (s *Server) handleLogoutMulticluster(w http.ResponseWriter, r *http.Request
 	}
 }
 
-// tokenToObjectName returns the oauthaccesstokens object name for the given raw token,
-// i.e. the sha256 hash prefixed with "sha256~".
-func tokenToObjectName(token string) string {
-	name := strings.TrimPrefix(token, sha256Prefix)
-	h := sha256.Sum256([]byte(name))
-	return sha256Prefix + base64.RawURLEncoding.EncodeToString(h[0:])
-}
-
 func getMapKeys(m map[string]string) []string {
 	keys := []string{}
 	for key := range m {
@@ -0,0 +1,41 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/plugins"
+)
+
+func TestHandlePluginStatus(t *testing.T) {
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		review := &authorizationv1.SelfSubjectAccessReview{}
+		json.NewDecoder(r.Body).Decode(review)
+		attributes := review.Spec.ResourceAttributes
+		if attributes.Verb != "list" || attributes.Group != "console.openshift.io" || attributes.Resource != "consoleplugins" {
+			t.Errorf("expected a review of listing console plugins, got %#v", attributes)
+		}
+		review.Status.Allowed = r.Header.Get("Authorization") == "Bearer admin-token"
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(review)
+	}))
+	defer apiServer.Close()
+
+	endpoint, _ := url.Parse(apiServer.URL)
+	resolver := auth.NewUserInfoResolver(apiServer.Client(), endpoint, nil)
+	s := &Server{PluginManifestChecker: plugins.NewManifestChecker(http.DefaultClient, map[string]string{})}
+
+	for token, expected := range map[string]int{"admin-token": http.StatusOK, "user-token": http.StatusForbidden} {
+		rr := httptest.NewRecorder()
+		s.handlePluginStatus(resolver, &auth.User{Token: token}, rr, httptest.NewRequest("GET", pluginStatusEndpoint, nil))
+		if rr.Code != expected {
+			t.Errorf("expected status %d for %s, got %d: %s", expected, token, rr.Code, rr.Body)
+		}
+	}
+}
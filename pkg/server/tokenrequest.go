@@ -0,0 +1,83 @@
+package server
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/proxy"
+	"github.com/openshift/console/pkg/serverutils"
+)
+
+// tokenRequestEndpoint returns the console path starting the token request
+// flow for cluster.
+func (s *Server) tokenRequestEndpoint(cluster string) string {
+	endpoint := proxy.SingleJoiningSlash(s.BaseURL.Path, authTokenRequestEndpoint)
+	if cluster != serverutils.LocalClusterName {
+		endpoint = fmt.Sprintf("%s/%s", endpoint, cluster)
+	}
+	return endpoint
+}
+
+// renderTokenRequest shows a token issued for command line tools along with
+// commands to use it, or hands it out in a kubeconfig file if it was requested
+// for one.
+func (s *Server) renderTokenRequest(resolvers map[string]*auth.UserInfoResolver, tokenRequest *auth.TokenRequest, w http.ResponseWriter, r *http.Request) {
+	if tokenRequest.Kubeconfig && tokenRequest.KubeconfigChain != "" {
+		s.continueKubeconfigChain(resolvers, tokenRequest, w, r)
+		return
+	}
+	if tokenRequest.Kubeconfig {
+		users := map[string]*auth.User{tokenRequest.Cluster: {Token: tokenRequest.Token}}
+		s.writeKubeconfig(r.Context(), resolvers, tokenRequest.Cluster, users, w)
+		return
+	}
+
+	server := s.KubeAPIServerURL
+	if kubeconfigCluster, ok := s.KubeconfigClusters[tokenRequest.Cluster]; ok {
+		server = kubeconfigCluster.Server
+	}
+	expiry := ""
+	if !tokenRequest.Expiry.IsZero() {
+		expiry = tokenRequest.Expiry.UTC().Format(time.RFC1123)
+	}
+	data := struct {
+		Cluster           string
+		Token             string
+		Expiry            string
+		Server            string
+		WhoAmIURL         string
+		RequestAnotherURL string
+		ConsoleURL        string
+	}{
+		Cluster:           tokenRequest.Cluster,
+		Token:             tokenRequest.Token,
+		Expiry:            expiry,
+		Server:            server,
+		WhoAmIURL:         proxy.SingleJoiningSlash(server, tokenRequest.WhoAmIPath),
+		RequestAnotherURL: s.tokenRequestEndpoint(tokenRequest.Cluster),
+		ConsoleURL:        s.BaseURL.String(),
+	}
+
+	// The page holds a credential.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	w.Header().Set("X-Frame-Options", "DENY")
+
+	tpl := template.New(tokenRequestPageTemplateName)
+	tpl.Delims("[[", "]]")
+	tpls, err := tpl.ParseFiles(path.Join(s.PublicDir, tokenRequestPageTemplateName))
+	if err != nil {
+		fmt.Printf("%v not found in configured public-dir path: %v", tokenRequestPageTemplateName, err)
+		os.Exit(1)
+	}
+
+	if err := tpls.ExecuteTemplate(w, tokenRequestPageTemplateName, data); err != nil {
+		fmt.Printf("%v", err)
+		os.Exit(1)
+	}
+}
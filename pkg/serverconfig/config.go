@@ -99,10 +99,15 @@ func SetFlagsFromConfig(fs *flag.FlagSet, filename string) (err error) {
 	addHelmConfig(fs, &config.Helm)
 	addPlugins(fs, config.Plugins)
 	addManagedClusters(fs, config.ManagedClusterConfigFile)
+	addTerminal(fs, &config.Terminal)
 	err = addProxy(fs, &config.Proxy)
 	if err != nil {
 		return err
 	}
+	err = addPluginIntegrity(fs, config.PluginIntegrity)
+	if err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -119,6 +124,29 @@ func addProxy(fs *flag.FlagSet, proxyConfig *Proxy) error {
 	return nil
 }
 
+func addPluginIntegrity(fs *flag.FlagSet, pluginIntegrity map[string]PluginIntegrity) error {
+	if len(pluginIntegrity) != 0 {
+		marshaledPluginIntegrity, err := json.Marshal(pluginIntegrity)
+		if err != nil {
+			return fmt.Errorf("could not marshal ConsoleConfig 'pluginIntegrity' field: %v", err)
+		}
+		fs.Set("plugin-integrity", string(marshaledPluginIntegrity))
+	}
+	return nil
+}
+
+func addTerminal(fs *flag.FlagSet, terminal *Terminal) {
+	if terminal.AdminNamespace != "" {
+		fs.Set("terminal-admin-namespace", terminal.AdminNamespace)
+	}
+	if terminal.IdleTimeout != "" {
+		fs.Set("terminal-idle-timeout", terminal.IdleTimeout)
+	}
+	if terminal.IdleAction != "" {
+		fs.Set("terminal-idle-action", terminal.IdleAction)
+	}
+}
+
 func addHelmConfig(fs *flag.FlagSet, helmConfig *Helm) (err error) {
 	if helmConfig.ChartRepo.URL != "" {
 		fs.Set("helm-chart-repo-url", helmConfig.ChartRepo.URL)
@@ -225,6 +253,14 @@ func addAuth(fs *flag.FlagSet, auth *Auth) {
 	if auth.InactivityTimeoutSeconds != 0 {
 		fs.Set("inactivity-timeout", strconv.Itoa(auth.InactivityTimeoutSeconds))
 	}
+
+	if auth.TokenRequestClientID != "" {
+		fs.Set("user-auth-token-request-client-id", auth.TokenRequestClientID)
+	}
+
+	if auth.TokenRequestClientSecretFile != "" {
+		fs.Set("user-auth-token-request-client-secret-file", auth.TokenRequestClientSecretFile)
+	}
 }
 
 func addProviders(fs *flag.FlagSet, providers *Providers) {
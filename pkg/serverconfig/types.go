@@ -22,6 +22,9 @@ type Config struct {
 	Plugins                  map[string]string `yaml:"plugins,omitempty"`
 	ManagedClusterConfigFile string            `yaml:"managedClusterConfigFile,omitempty"`
 	Proxy                    Proxy             `yaml:"proxy,omitempty"`
+	Terminal                 Terminal          `yaml:"terminal,omitempty"`
+	// PluginIntegrity declares how the assets of plugins are verified, by plugin name.
+	PluginIntegrity map[string]PluginIntegrity `yaml:"pluginIntegrity,omitempty"`
 }
 
 type Proxy struct {
@@ -33,6 +36,45 @@ type ProxyService struct {
 	ConsoleAPIPath string `yaml:"consoleAPIPath"`
 	CACertificate  string `yaml:"caCertificate"`
 	Authorize      bool   `yaml:"authorize"`
+	// Authorization is how requests to the service are authorized: None,
+	// UserToken or ServiceAccount. When set, it takes precedence over Authorize.
+	Authorization string `yaml:"authorization,omitempty"`
+	// Headers are set on every request to the service.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Timeout bounds requests to the service, like 30s.
+	Timeout string `yaml:"timeout,omitempty"`
+	// PathRewrites rewrite the paths of requests to the service. The first
+	// rule matching a path is applied.
+	PathRewrites []ProxyPathRewrite `yaml:"pathRewrites,omitempty"`
+	// ServiceAccountTokenFile is the file holding the token forwarded to the
+	// service with the ServiceAccount authorization mode. It should belong to
+	// a service account dedicated to the service, allowed to impersonate the
+	// users of the console.
+	ServiceAccountTokenFile string `yaml:"serviceAccountTokenFile,omitempty"`
+}
+
+// Authorization modes of proxy services.
+const (
+	// ProxyAuthorizationNone proxies requests of anonymous users as they are.
+	ProxyAuthorizationNone = "None"
+	// ProxyAuthorizationUserToken requires users to be logged in and forwards
+	// their bearer token.
+	ProxyAuthorizationUserToken = "UserToken"
+	// ProxyAuthorizationServiceAccount requires users to be logged in and
+	// forwards the token of the service's ServiceAccountTokenFile, impersonating
+	// the user with the Impersonate-User and Impersonate-Group headers, so that
+	// the API server checks the service account may impersonate the user. The
+	// console's own service account token is never forwarded.
+	ProxyAuthorizationServiceAccount = "ServiceAccount"
+)
+
+// ProxyPathRewrite replaces the paths matching a regular expression.
+type ProxyPathRewrite struct {
+	// From is a regular expression matched against the path, without the
+	// service's console API path.
+	From string `yaml:"from"`
+	// To replaces the match, and can refer to its groups like $1.
+	To string `yaml:"to"`
 }
 
 // ServingInfo holds configuration for serving HTTP.
@@ -76,6 +118,10 @@ type Auth struct {
 	OAuthEndpointCAFile      string `yaml:"oauthEndpointCAFile,omitempty"`
 	LogoutRedirect           string `yaml:"logoutRedirect,omitempty"`
 	InactivityTimeoutSeconds int    `yaml:"inactivityTimeoutSeconds,omitempty"`
+	// TokenRequestClientID and TokenRequestClientSecretFile configure the OAuth
+	// client of the console's own token request flow.
+	TokenRequestClientID         string `yaml:"tokenRequestClientID,omitempty"`
+	TokenRequestClientSecretFile string `yaml:"tokenRequestClientSecretFile,omitempty"`
 }
 
 // Customization holds configuration such as what logo to use.
@@ -139,6 +185,33 @@ type Providers struct {
 	StatuspageID string `yaml:"statuspageID,omitempty"`
 }
 
+// PluginIntegrity declares how the assets a plugin serves are verified. Assets
+// that don't match are refused.
+type PluginIntegrity struct {
+	// Digests of the plugin's assets by path, like plugin-entry.js, in the
+	// subresource integrity format, like sha256-<base64 digest>.
+	Digests map[string]string `json:"digests,omitempty" yaml:"digests,omitempty"`
+	// PublicKey is the PEM encoded Ed25519, ECDSA or RSA public key the
+	// plugin's manifest is signed with. The plugin serves the base64 encoded
+	// signature as plugin-manifest.json.sig, and the integrity field of the
+	// manifest declares the digests of the other assets.
+	PublicKey string `json:"publicKey,omitempty" yaml:"publicKey,omitempty"`
+	// RequireDigests refuses the assets that have no declared digest. It
+	// defaults to true.
+	RequireDigests *bool `json:"requireDigests,omitempty" yaml:"requireDigests,omitempty"`
+}
+
+// Terminal holds configuration for the web terminal.
+type Terminal struct {
+	// AdminNamespace is where the terminals of cluster admins run.
+	AdminNamespace string `yaml:"adminNamespace,omitempty"`
+	// IdleTimeout is how long a terminal can go without activity before it is
+	// culled, for example 30m. Terminals aren't culled by bridge when empty.
+	IdleTimeout string `yaml:"idleTimeout,omitempty"`
+	// IdleAction is how idle terminals are culled, either stop or delete.
+	IdleAction string `yaml:"idleAction,omitempty"`
+}
+
 type HelmChartRepo struct {
 	URL    string `yaml:"url,omitempty"`
 	CAFile string `yaml:"caFile,omitempty"`
@@ -159,6 +232,9 @@ type ManagedClusterOAuthConfig struct {
 	ClientID     string `json:"clientID" yaml:"clientID"`
 	ClientSecret string `json:"clientSecret" yaml:"clientSecret"`
 	CAFile       string `json:"caFile" yaml:"caFile"`
+	// The optional OAuth client issuing tokens for command line tools.
+	TokenRequestClientID     string `json:"tokenRequestClientID,omitempty" yaml:"tokenRequestClientID,omitempty"`
+	TokenRequestClientSecret string `json:"tokenRequestClientSecret,omitempty" yaml:"tokenRequestClientSecret,omitempty"`
 }
 
 // ManagedClusterConfig enables proxying to an ACM managed cluster
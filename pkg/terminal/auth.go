@@ -7,11 +7,11 @@ import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// isClusterAdmin does a subject access review to see if the user can create pods in openshift-terminal
+// isClusterAdmin does a subject access review to see if the user can create pods in the admin namespace
 // if they can then they are considered a cluster admin
 // if they cannot they are not a cluster admin
-func (p *Proxy) isClusterAdmin(token string) (bool, error) {
-	client, err := p.createTypedClient(token)
+func (p *Proxy) isClusterAdmin(cluster, token string) (bool, error) {
+	client, err := p.createTypedClient(cluster, token)
 	if err != nil {
 		return false, err
 	}
@@ -19,7 +19,7 @@ func (p *Proxy) isClusterAdmin(token string) (bool, error) {
 	sar := &authv1.SelfSubjectAccessReview{
 		Spec: authv1.SelfSubjectAccessReviewSpec{
 			ResourceAttributes: &authv1.ResourceAttributes{
-				Namespace: "openshift-terminal",
+				Namespace: p.adminNamespace,
 				Verb:      "create",
 				Resource:  "pods",
 			},
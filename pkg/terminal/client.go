@@ -1,14 +1,16 @@
 package terminal
 
 import (
+	"fmt"
+
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 )
 
-// createDynamicClient create dynamic client with the configured token to be used
-func (p *Proxy) createDynamicClient(token string) (dynamic.Interface, error) {
-	config, err := p.getConfig(token)
+// createDynamicClient create dynamic client for the cluster with the configured token to be used
+func (p *Proxy) createDynamicClient(cluster, token string) (dynamic.Interface, error) {
+	config, err := p.getConfig(cluster, token)
 	if err != nil {
 		return nil, err
 	}
@@ -20,8 +22,8 @@ func (p *Proxy) createDynamicClient(token string) (dynamic.Interface, error) {
 	return client, nil
 }
 
-func (p *Proxy) createTypedClient(token string) (*kubernetes.Clientset, error) {
-	config, err := p.getConfig(token)
+func (p *Proxy) createTypedClient(cluster, token string) (*kubernetes.Clientset, error) {
+	config, err := p.getConfig(cluster, token)
 	if err != nil {
 		return nil, err
 	}
@@ -29,22 +31,21 @@ func (p *Proxy) createTypedClient(token string) (*kubernetes.Clientset, error) {
 	return kubernetes.NewForConfig(config)
 }
 
-func (p *Proxy) getConfig(token string) (*rest.Config, error) {
-	var tlsClientConfig rest.TLSClientConfig
-	if p.TLSClientConfig.InsecureSkipVerify {
-		// off-cluster mode
-		tlsClientConfig.Insecure = true
-	} else {
-		inCluster, err := rest.InClusterConfig()
-		if err != nil {
-			return nil, err
-		}
-		tlsClientConfig = inCluster.TLSClientConfig
+// getConfig returns a config for the API server of the cluster. The transport
+// of the cluster's client carries its TLS setup.
+func (p *Proxy) getConfig(cluster, token string) (*rest.Config, error) {
+	k8sProxyConfig, ok := p.k8sProxyConfigs[cluster]
+	if !ok {
+		return nil, fmt.Errorf("unknown cluster %q", cluster)
+	}
+	k8sClient, ok := p.k8sClients[cluster]
+	if !ok {
+		return nil, fmt.Errorf("no client for cluster %q", cluster)
 	}
 
 	return &rest.Config{
-		Host:            p.ClusterEndpoint.Host,
-		TLSClientConfig: tlsClientConfig,
-		BearerToken:     token,
+		Host:        k8sProxyConfig.Endpoint.String(),
+		Transport:   k8sClient.Transport,
+		BearerToken: token,
 	}, nil
 }
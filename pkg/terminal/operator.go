@@ -3,14 +3,12 @@ package terminal
 import (
 	"context"
 	"errors"
+	"time"
 
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
 )
 
 var (
@@ -31,61 +29,137 @@ const (
 	webTerminalOperatorName = "web-terminal"
 )
 
-// checkWebTerminalOperatorIsRunning checks if the workspace operator is running and webhooks are enabled,
-// which is a prerequisite for sending a user's token to a workspace.
-func checkWebTerminalOperatorIsRunning() (bool, error) {
-	config, err := rest.InClusterConfig()
+// operatorStateCacheTTL is how long the state of the web terminal operator on
+// a cluster is cached. The proxy checks it on every request.
+const operatorStateCacheTTL = time.Minute
+
+// operatorState is the state of the web terminal operator on a cluster. It is
+// detected with the console's credential for the cluster, as users usually
+// can't read webhook configurations or list subscriptions cluster-wide. The
+// console has no credential for managed clusters outside of kubeconfig mode,
+// so there the state is detected with the user's token for every request.
+type operatorState struct {
+	running       bool
+	subscriptions *unstructured.UnstructuredList
+	// workspaceResource is the newest DevWorkspace version the operator serves.
+	workspaceResource schema.GroupVersionResource
+	expires           time.Time
+}
+
+// getOperatorState returns the state of the web terminal operator on the cluster.
+// States detected with the console's credential are cached, those detected with
+// userToken are not, as they depend on what the user may see.
+func (p *Proxy) getOperatorState(cluster, userToken string) (*operatorState, error) {
+	tokenSource, ok := p.serviceAccountTokenSources[cluster]
+	if !ok {
+		return p.detectOperatorState(cluster, userToken)
+	}
+
+	p.operatorStatesLock.Lock()
+	state, ok := p.operatorStates[cluster]
+	p.operatorStatesLock.Unlock()
+	if ok && time.Now().Before(state.expires) {
+		return state, nil
+	}
+
+	token, err := tokenSource.Token()
 	if err != nil {
-		return false, err
+		return nil, err
 	}
-	client, err := kubernetes.NewForConfig(config)
+	state, err = p.detectOperatorState(cluster, token)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
+	state.expires = time.Now().Add(operatorStateCacheTTL)
+	p.operatorStatesLock.Lock()
+	p.operatorStates[cluster] = state
+	p.operatorStatesLock.Unlock()
+	return state, nil
+}
 
-	_, err = client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), webhookName, metav1.GetOptions{})
+func (p *Proxy) detectOperatorState(cluster, token string) (*operatorState, error) {
+	running, err := p.checkWebhooksEnabled(cluster, token)
+	if err != nil {
+		return nil, err
+	}
+	subscriptions, err := p.getWebTerminalSubscriptions(cluster, token)
+	if err != nil {
+		return nil, err
+	}
+	workspaceResource, err := p.getWorkspaceResource(cluster, token)
+	if err != nil {
+		return nil, err
+	}
+	return &operatorState{running: running, subscriptions: subscriptions, workspaceResource: workspaceResource}, nil
+}
+
+// getWorkspaceResource returns the v1alpha2 DevWorkspace resource if the cluster
+// serves it, and the v1alpha1 one otherwise, like the console's terminal does.
+func (p *Proxy) getWorkspaceResource(cluster, token string) (schema.GroupVersionResource, error) {
+	client, err := p.createTypedClient(cluster, token)
+	if err != nil {
+		return schema.GroupVersionResource{}, err
+	}
+	resources, err := client.Discovery().ServerResourcesForGroupVersion(WorkspaceV1alpha2GroupVersionResource.GroupVersion().String())
 	if err != nil {
 		if k8sErrors.IsNotFound(err) {
-			return false, nil
+			return WorkspaceGroupVersionResource, nil
 		}
+		return schema.GroupVersionResource{}, err
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Name == WorkspaceV1alpha2GroupVersionResource.Resource {
+			return WorkspaceV1alpha2GroupVersionResource, nil
+		}
+	}
+	return WorkspaceGroupVersionResource, nil
+}
+
+// checkWebTerminalOperatorIsRunning checks if the workspace operator is running and webhooks are enabled on the cluster,
+// which is a prerequisite for sending a user's token to a workspace.
+func (p *Proxy) checkWebTerminalOperatorIsRunning(cluster, userToken string) (bool, error) {
+	state, err := p.getOperatorState(cluster, userToken)
+	if err != nil {
 		return false, err
 	}
+	return state.running, nil
+}
 
-	_, err = client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), webhookName, metav1.GetOptions{})
+func (p *Proxy) checkWebhooksEnabled(cluster, token string) (bool, error) {
+	client, err := p.createTypedClient(cluster, token)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = client.AdmissionregistrationV1().MutatingWebhookConfigurations().Get(context.TODO(), webhookName, metav1.GetOptions{})
 	if err != nil {
 		if k8sErrors.IsNotFound(err) {
 			return false, nil
 		}
 		return false, err
 	}
-	return true, nil
-}
-
-// checkWebTerminalOperatorIsInstalled checks to see that a web-terminal-operator is installed on the cluster
-func checkWebTerminalOperatorIsInstalled() (bool, error) {
 
-	subs, err := getWebTerminalSubscriptions()
+	_, err = client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(context.TODO(), webhookName, metav1.GetOptions{})
 	if err != nil {
-		// Web Terminal subscription is not found but it's technically not a real error so we don't want to propogate it. Just say that the operator is not installed
 		if k8sErrors.IsNotFound(err) {
 			return false, nil
 		}
-
 		return false, err
 	}
-	return len(subs.Items) > 0, nil
+	return true, nil
 }
 
-func getWebTerminalSubscriptions() (*unstructured.UnstructuredList, error) {
-	config, err := rest.InClusterConfig()
+// getCachedWebTerminalSubscriptions returns the web terminal subscriptions of the cluster from the operator state.
+func (p *Proxy) getCachedWebTerminalSubscriptions(cluster, userToken string) (*unstructured.UnstructuredList, error) {
+	state, err := p.getOperatorState(cluster, userToken)
 	if err != nil {
 		return nil, err
 	}
+	return state.subscriptions, nil
+}
 
-	config.GroupVersion = OperatorGroupVersion
-	config.APIPath = "apis"
-
-	client, err := dynamic.NewForConfig(config)
+func (p *Proxy) getWebTerminalSubscriptions(cluster, token string) (*unstructured.UnstructuredList, error) {
+	client, err := p.createDynamicClient(cluster, token)
 	if err != nil {
 		return nil, err
 	}
@@ -93,6 +167,10 @@ func getWebTerminalSubscriptions() (*unstructured.UnstructuredList, error) {
 		FieldSelector: "metadata.name=" + webTerminalOperatorName,
 	})
 	if err != nil {
+		// Web Terminal subscription is not found but it's technically not a real error so we don't want to propogate it. Just say that the operator is not installed
+		if k8sErrors.IsNotFound(err) {
+			return &unstructured.UnstructuredList{}, nil
+		}
 		return nil, err
 	}
 	return subs, err
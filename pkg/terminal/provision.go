@@ -0,0 +1,332 @@
+package terminal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/auth"
+)
+
+const (
+	// ProvisionEndpoint path used to find or create the user's terminal and initialize it
+	ProvisionEndpoint = "/api/terminal/provision"
+	// TerminalLabel marks the workspaces that are web terminals
+	TerminalLabel = "console.openshift.io/terminal"
+	// WorkspaceSourceAnnotation records what created a workspace
+	WorkspaceSourceAnnotation = "controller.devfile.io/devworkspace-source"
+)
+
+const (
+	// defaultWorkspaceStartPollInterval is how often the workspace is checked while waiting for it to start.
+	defaultWorkspaceStartPollInterval = 2 * time.Second
+	// workspaceStartTimeout is how long to wait for the workspace to start.
+	workspaceStartTimeout = 5 * time.Minute
+)
+
+// ProvisionRequest is the body of a provisioning request.
+type ProvisionRequest struct {
+	// Namespace to find or create the terminal in. Cluster admins always get
+	// their terminal in the admin namespace, so they can omit it.
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ProvisionEvent reports the progress of provisioning a terminal. Events are
+// streamed to the client as newline delimited JSON. The last event has the
+// phase Ready or Failed.
+type ProvisionEvent struct {
+	Phase     string `json:"phase"`
+	Message   string `json:"message,omitempty"`
+	Workspace string `json:"workspace,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+	// Init is the response of the workspace's exec/init endpoint.
+	Init json.RawMessage `json:"init,omitempty"`
+}
+
+const (
+	ProvisionPhaseCreating     = "Creating"
+	ProvisionPhaseStarting     = "Starting"
+	ProvisionPhaseInitializing = "Initializing"
+	ProvisionPhaseReady        = "Ready"
+	ProvisionPhaseFailed       = "Failed"
+)
+
+// HandleProvision finds the user's terminal workspace, or creates it, waits for it to start
+// and initializes it, like the console's terminal does.
+func (p *Proxy) HandleProvision(user *auth.User, w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.Header().Set("Allow", "POST")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	cluster, ok := p.getCluster(w, r)
+	if !ok {
+		return
+	}
+
+	var provisionRequest ProvisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&provisionRequest); err != nil && err != io.EOF {
+		http.Error(w, "Failed to parse the request body: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	operatorState, err := p.getOperatorState(cluster, user.Token)
+	if err != nil {
+		http.Error(w, "Failed to check web terminal operator state. Cause: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !operatorState.running {
+		http.Error(w, "Terminal endpoint is disabled: web terminal operator is not deployed.", http.StatusForbidden)
+		return
+	}
+	// v1alpha2 workspaces reference the web terminal templates in the operator's namespace.
+	operatorNamespace := ""
+	if operatorState.workspaceResource == WorkspaceV1alpha2GroupVersionResource {
+		namespace, found, err := getWebTerminalNamespace(operatorState.subscriptions)
+		if err != nil {
+			http.Error(w, "Failed to get the namespace of the web terminal operator. Cause: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Terminal endpoint is disabled: web terminal operator is not installed.", http.StatusServiceUnavailable)
+			return
+		}
+		operatorNamespace = namespace
+	}
+
+	isClusterAdmin, err := p.isClusterAdmin(cluster, user.Token)
+	if err != nil {
+		http.Error(w, "Failed to check the current users privileges. Cause: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	namespace := provisionRequest.Namespace
+	if isClusterAdmin {
+		// Cluster admin terminals must live in the admin namespace to prevent privilege escalation
+		if namespace != "" && namespace != p.adminNamespace {
+			http.Error(w, "cluster-admin users must create and use terminals in the "+p.adminNamespace+" namespace", http.StatusForbidden)
+			return
+		}
+		namespace = p.adminNamespace
+	} else if namespace == "" {
+		http.Error(w, "A namespace is required", http.StatusBadRequest)
+		return
+	}
+
+	client, err := p.createDynamicClient(cluster, user.Token)
+	if err != nil {
+		http.Error(w, "Failed to create k8s client for the authenticated user. Cause: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	userId, username, err := p.getUserInfo(r.Context(), cluster, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// From here on, failures are reported as events.
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	send := func(event ProvisionEvent) {
+		if err := encoder.Encode(event); err != nil {
+			klog.Errorf("failed to send terminal provisioning event: %v", err)
+			return
+		}
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+	}
+	fail := func(message string) {
+		send(ProvisionEvent{Phase: ProvisionPhaseFailed, Message: message})
+	}
+
+	workspaces := client.Resource(operatorState.workspaceResource).Namespace(namespace)
+	ws, err := findTerminalWorkspace(workspaces, userId)
+	if err != nil {
+		fail("Failed to list the workspaces. Cause: " + err.Error())
+		return
+	}
+	if ws == nil {
+		send(ProvisionEvent{Phase: ProvisionPhaseCreating, Namespace: namespace})
+		ws, err = workspaces.Create(r.Context(), newTerminalWorkspace(operatorState.workspaceResource, namespace, operatorNamespace, userId), metav1.CreateOptions{})
+		if err != nil {
+			fail("Failed to create the workspace. Cause: " + err.Error())
+			return
+		}
+	} else if started, _, _ := unstructured.NestedBool(ws.UnstructuredContent(), "spec", "started"); !started {
+		ws, err = workspaces.Patch(r.Context(), ws.GetName(), types.MergePatchType, []byte(`{"spec":{"started":true}}`), metav1.PatchOptions{})
+		if err != nil {
+			fail("Failed to start the workspace. Cause: " + err.Error())
+			return
+		}
+	}
+	send(ProvisionEvent{Phase: ProvisionPhaseStarting, Workspace: ws.GetName(), Namespace: namespace})
+
+	ctx, cancel := context.WithTimeout(r.Context(), workspaceStartTimeout)
+	defer cancel()
+	name := ws.GetName()
+	lastPhase := ""
+	err = wait.PollImmediateUntil(p.workspaceStartPollInterval, func() (bool, error) {
+		ws, err = workspaces.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		phase, _, _ := unstructured.NestedString(ws.UnstructuredContent(), "status", "phase")
+		if phase == "Failed" {
+			message, _, _ := unstructured.NestedString(ws.UnstructuredContent(), "status", "message")
+			return false, fmt.Errorf("the workspace failed to start: %s", message)
+		}
+		if phase != lastPhase {
+			lastPhase = phase
+			send(ProvisionEvent{Phase: ProvisionPhaseStarting, Message: phase, Workspace: name, Namespace: namespace})
+		}
+		ideUrl, _, _ := unstructured.NestedString(ws.UnstructuredContent(), "status", "ideUrl")
+		mainUrl, _, _ := unstructured.NestedString(ws.UnstructuredContent(), "status", "mainUrl")
+		return ideUrl != "" || mainUrl != "", nil
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		fail("Timed out waiting for the workspace to start")
+		return
+	}
+	if err != nil {
+		fail("Failed to wait for the workspace to start. Cause: " + err.Error())
+		return
+	}
+
+	send(ProvisionEvent{Phase: ProvisionPhaseInitializing, Workspace: name, Namespace: namespace})
+	initData, err := p.initWorkspace(ws, username, user.Token)
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if err := recordActivity(r.Context(), workspaces, ws); err != nil {
+		klog.Errorf("Failed to record the activity of terminal %s/%s: %v", namespace, name, err)
+	}
+	send(ProvisionEvent{Phase: ProvisionPhaseReady, Workspace: name, Namespace: namespace, Init: initData})
+}
+
+// findTerminalWorkspace returns the terminal workspace of the user in the namespace, or nil if there is none
+// HandleProxy would accept.
+func findTerminalWorkspace(workspaces dynamic.ResourceInterface, userId string) (*unstructured.Unstructured, error) {
+	list, err := workspaces.List(context.TODO(), metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("%s=true,%s=%s", TerminalLabel, WorkspaceCreatorLabel, userId),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		ws := &list.Items[i]
+		if ws.GetAnnotations()[WorkspaceRestrictedAcccessAnnotation] == "true" && ws.GetDeletionTimestamp() == nil {
+			return ws, nil
+		}
+	}
+	return nil, nil
+}
+
+// newTerminalWorkspace returns the workspace of a new terminal, like the one the console creates.
+// v1alpha2 workspaces use the web terminal templates in operatorNamespace.
+func newTerminalWorkspace(resource schema.GroupVersionResource, namespace, operatorNamespace, userId string) *unstructured.Unstructured {
+	components := []interface{}{
+		map[string]interface{}{
+			"plugin": map[string]interface{}{
+				"name": "web-terminal",
+				"id":   "redhat-developer/web-terminal/latest",
+			},
+		},
+	}
+	if resource == WorkspaceV1alpha2GroupVersionResource {
+		components = []interface{}{}
+		for _, name := range []string{"web-terminal-tooling", "web-terminal-exec"} {
+			components = append(components, map[string]interface{}{
+				"name": name,
+				"plugin": map[string]interface{}{
+					"kubernetes": map[string]interface{}{
+						"name":      name,
+						"namespace": operatorNamespace,
+					},
+				},
+			})
+		}
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": resource.GroupVersion().String(),
+		"kind":       "DevWorkspace",
+		"metadata": map[string]interface{}{
+			"generateName": "terminal-",
+			"namespace":    namespace,
+			"labels": map[string]interface{}{
+				TerminalLabel:         "true",
+				WorkspaceCreatorLabel: userId,
+			},
+			"annotations": map[string]interface{}{
+				WorkspaceRestrictedAcccessAnnotation: "true",
+				WorkspaceSourceAnnotation:            "web-terminal",
+			},
+		},
+		"spec": map[string]interface{}{
+			"started":      true,
+			"routingClass": "web-terminal",
+			"template": map[string]interface{}{
+				"components": components,
+			},
+		},
+	}}
+}
+
+// initWorkspace calls the exec/init endpoint of the started workspace and returns its response.
+func (p *Proxy) initWorkspace(ws *unstructured.Unstructured, username, token string) (json.RawMessage, error) {
+	terminalHost, err := p.getBaseTerminalHost(ws)
+	if err != nil {
+		return nil, err
+	}
+	if terminalHost.Scheme != "https" {
+		return nil, fmt.Errorf("Workspace is not served over https")
+	}
+	terminalHost.Path = WorkspaceInitEndpoint
+
+	body, err := json.Marshal(map[string]interface{}{
+		"kubeconfig": map[string]string{
+			"username":  username,
+			"namespace": ws.GetNamespace(),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	wkspReq, err := http.NewRequest(http.MethodPost, terminalHost.String(), ioutil.NopCloser(bytes.NewReader(body)))
+	if err != nil {
+		return nil, err
+	}
+	wkspReq.Header.Set("Content-type", "application/json")
+	wkspReq.Header.Set("X-Forwarded-Access-Token", token)
+
+	wkspResp, err := p.workspaceHttpClient.Do(wkspReq)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to initialize the workspace. Cause: %v", err)
+	}
+	defer wkspResp.Body.Close()
+	respBody, err := ioutil.ReadAll(wkspResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read the workspace's response. Cause: %v", err)
+	}
+	if wkspResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to initialize the workspace: %s: %s", wkspResp.Status, respBody)
+	}
+	return respBody, nil
+}
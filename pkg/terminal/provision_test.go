@@ -0,0 +1,153 @@
+package terminal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/proxy"
+)
+
+func TestHandleProvision(t *testing.T) {
+	for _, version := range []string{"v1alpha1", "v1alpha2"} {
+		t.Run(version, func(t *testing.T) {
+			testHandleProvision(t, version)
+		})
+	}
+}
+
+func testHandleProvision(t *testing.T, version string) {
+	workspace := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/"+WorkspaceInitEndpoint || r.Header.Get("X-Forwarded-Access-Token") != "admin-token" {
+			t.Errorf("unexpected workspace request %s", r.URL)
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(body), `"username":"admin"`) {
+			t.Errorf("expected the kubeconfig of the user, got %s", body)
+		}
+		fmt.Fprint(w, `{"pod": "workspace-pod", "container": "web-terminal-tooling", "cmd": ["/bin/bash"]}`)
+	}))
+	defer workspace.Close()
+
+	var created map[string]interface{}
+	gets := 0
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		workspaces := "/apis/workspace.devfile.io/" + version + "/namespaces/openshift-terminal/devworkspaces"
+		switch {
+		case r.URL.Path == "/apis/workspace.devfile.io/v1alpha2" && version == "v1alpha2":
+			fmt.Fprint(w, `{"kind": "APIResourceList", "groupVersion": "workspace.devfile.io/v1alpha2", "resources": [{"name": "devworkspaces", "kind": "DevWorkspace", "namespaced": true}]}`)
+		case r.URL.Path == "/apis/operators.coreos.com/v1alpha1/subscriptions":
+			fmt.Fprint(w, `{"apiVersion": "operators.coreos.com/v1alpha1", "kind": "SubscriptionList", "items": [{"apiVersion": "operators.coreos.com/v1alpha1", "kind": "Subscription", "metadata": {"name": "web-terminal", "namespace": "openshift-operators"}}]}`)
+		case strings.HasPrefix(r.URL.Path, "/apis/admissionregistration.k8s.io/v1/"):
+			fmt.Fprintf(w, `{"metadata": {"name": %q}}`, webhookName)
+		case r.URL.Path == "/apis/user.openshift.io/v1/users/~":
+			fmt.Fprint(w, `{"metadata": {"name": "admin", "uid": "admin-uid"}}`)
+		case r.URL.Path == "/apis/authorization.k8s.io/v1/selfsubjectaccessreviews":
+			fmt.Fprint(w, `{"status": {"allowed": true}}`)
+		case r.URL.Path == workspaces && r.Method == "GET":
+			fmt.Fprintf(w, `{"apiVersion": "workspace.devfile.io/%s", "kind": "DevWorkspaceList", "items": []}`, version)
+		case r.URL.Path == workspaces && r.Method == "POST":
+			if err := json.NewDecoder(r.Body).Decode(&created); err != nil {
+				t.Fatal(err)
+			}
+			metadata := created["metadata"].(map[string]interface{})
+			metadata["name"] = "terminal-abc"
+			json.NewEncoder(w).Encode(created)
+		case r.URL.Path == workspaces+"/terminal-abc":
+			gets++
+			status := `{"phase": "Starting"}`
+			if gets > 1 {
+				// v1alpha2 workspaces call the URL mainUrl.
+				urlField := "ideUrl"
+				if version == "v1alpha2" {
+					urlField = "mainUrl"
+				}
+				status = fmt.Sprintf(`{"phase": "Running", %q: %q}`, urlField, workspace.URL+"/ide")
+			}
+			fmt.Fprintf(w, `{"apiVersion": "workspace.devfile.io/%s", "kind": "DevWorkspace", "metadata": {"name": "terminal-abc", "namespace": "openshift-terminal"}, "status": %s}`, version, status)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer apiServer.Close()
+
+	endpoint, err := url.Parse(apiServer.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProxy(
+		workspace.Client().Transport.(*http.Transport).TLSClientConfig,
+		map[string]*proxy.Config{"local-cluster": {Endpoint: endpoint}},
+		map[string]*http.Client{"local-cluster": apiServer.Client()},
+		map[string]auth.TokenSource{"local-cluster": auth.NewStaticTokenSource("console-token")},
+		map[string]*auth.UserInfoResolver{"local-cluster": auth.NewUserInfoResolver(apiServer.Client(), endpoint, nil)},
+		"openshift-terminal",
+	)
+	p.workspaceStartPollInterval = time.Millisecond
+
+	rr := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", ProvisionEndpoint, strings.NewReader(`{"namespace": "my-project"}`))
+	p.HandleProvision(&auth.User{ID: "admin-uid", Username: "admin", Token: "admin-token"}, rr, r)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected cluster admins to be denied terminals outside of openshift-terminal, got status %d", rr.Code)
+	}
+
+	// OpenShift OAuth sessions don't carry the user's identity, which is resolved instead.
+	rr = httptest.NewRecorder()
+	r = httptest.NewRequest("POST", ProvisionEndpoint, nil)
+	p.HandleProvision(&auth.User{Token: "admin-token"}, rr, r)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", rr.Code, rr.Body)
+	}
+
+	var events []ProvisionEvent
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		var event ProvisionEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	if len(events) == 0 {
+		t.Fatal("expected progress events")
+	}
+	last := events[len(events)-1]
+	if last.Phase != ProvisionPhaseReady || last.Workspace != "terminal-abc" || !strings.Contains(string(last.Init), "workspace-pod") {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+
+	metadata := created["metadata"].(map[string]interface{})
+	if metadata["labels"].(map[string]interface{})[WorkspaceCreatorLabel] != "admin-uid" {
+		t.Errorf("expected the workspace to be labeled with its creator, got %v", metadata["labels"])
+	}
+	if metadata["annotations"].(map[string]interface{})[WorkspaceRestrictedAcccessAnnotation] != "true" {
+		t.Errorf("expected the workspace to be restricted, got %v", metadata["annotations"])
+	}
+	components, _, _ := unstructured.NestedSlice(created, "spec", "template", "components")
+	if version == "v1alpha1" && (len(components) != 1 || components[0].(map[string]interface{})["plugin"].(map[string]interface{})["id"] != "redhat-developer/web-terminal/latest") {
+		t.Errorf("expected the web terminal plugin, got %v", components)
+	}
+	if version == "v1alpha2" {
+		if len(components) != 2 {
+			t.Fatalf("expected the web terminal templates, got %v", components)
+		}
+		for _, component := range components {
+			template, _, _ := unstructured.NestedMap(component.(map[string]interface{}), "plugin", "kubernetes")
+			if template["namespace"] != "openshift-operators" {
+				t.Errorf("expected the templates of the operator's namespace, got %v", component)
+			}
+		}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -18,6 +19,8 @@ import (
 	"k8s.io/klog"
 
 	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/proxy"
+	"github.com/openshift/console/pkg/serverutils"
 )
 
 const (
@@ -43,18 +46,38 @@ const (
 type Proxy struct {
 	// A client with the correct TLS setup for communicating with servers withing cluster.
 	workspaceHttpClient *http.Client
-	TLSClientConfig     *tls.Config
-	ClusterEndpoint     *url.URL
+	// The API server endpoints and clients of the clusters, by cluster name.
+	k8sProxyConfigs map[string]*proxy.Config
+	k8sClients      map[string]*http.Client
+	// The console's credentials for the clusters, by cluster name, used to
+	// detect the web terminal operator.
+	serviceAccountTokenSources map[string]auth.TokenSource
+	// The resolvers of the users' identities, by cluster name.
+	userInfoResolvers map[string]*auth.UserInfoResolver
+	// Cluster admins' terminals must live in this namespace.
+	adminNamespace string
+
+	operatorStatesLock sync.Mutex
+	operatorStates     map[string]*operatorState
+
+	workspaceStartPollInterval time.Duration
 }
 
-func NewProxy(serviceTLS *tls.Config, TLSClientConfig *tls.Config, clusterEndpoint *url.URL) *Proxy {
+func NewProxy(serviceTLS *tls.Config, k8sProxyConfigs map[string]*proxy.Config, k8sClients map[string]*http.Client, serviceAccountTokenSources map[string]auth.TokenSource, userInfoResolvers map[string]*auth.UserInfoResolver, adminNamespace string) *Proxy {
 	return &Proxy{
 		workspaceHttpClient: &http.Client{
 			Timeout:   10 * time.Second,
 			Transport: &http.Transport{TLSClientConfig: serviceTLS},
 		},
-		TLSClientConfig: TLSClientConfig,
-		ClusterEndpoint: clusterEndpoint,
+		k8sProxyConfigs: k8sProxyConfigs,
+		k8sClients:      k8sClients,
+		adminNamespace:  adminNamespace,
+		operatorStates:  make(map[string]*operatorState),
+
+		serviceAccountTokenSources: serviceAccountTokenSources,
+		userInfoResolvers:          userInfoResolvers,
+
+		workspaceStartPollInterval: defaultWorkspaceStartPollInterval,
 	}
 }
 
@@ -65,10 +88,12 @@ var (
 		Resource: "devworkspaces",
 	}
 
-	UserGroupVersionResource = schema.GroupVersionResource{
-		Group:    "user.openshift.io",
-		Version:  "v1",
-		Resource: "users",
+	// WorkspaceV1alpha2GroupVersionResource is served by newer versions of the
+	// operator, which no longer resolve the v1alpha1 web terminal plugin.
+	WorkspaceV1alpha2GroupVersionResource = schema.GroupVersionResource{
+		Group:    "workspace.devfile.io",
+		Version:  "v1alpha2",
+		Resource: "devworkspaces",
 	}
 )
 
@@ -81,7 +106,12 @@ func (p *Proxy) HandleProxy(user *auth.User, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	isWebTerminalOperatorRunning, err := checkWebTerminalOperatorIsRunning()
+	cluster, ok := p.getCluster(w, r)
+	if !ok {
+		return
+	}
+
+	isWebTerminalOperatorRunning, err := p.checkWebTerminalOperatorIsRunning(cluster, user.Token)
 	if err != nil {
 		http.Error(w, "Failed to check web terminal operator state. Cause: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -97,14 +127,14 @@ func (p *Proxy) HandleProxy(user *auth.User, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	isClusterAdmin, err := p.isClusterAdmin(user.Token)
+	isClusterAdmin, err := p.isClusterAdmin(cluster, user.Token)
 	if err != nil {
 		http.Error(w, "Failed to check the current users privileges. Cause: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	// Cluster admin terminals must live in the openshift-terminal namespace to prevent privilege escalation
-	if isClusterAdmin && namespace != "openshift-terminal" {
-		http.Error(w, "cluster-admin users must create and use terminals in the openshift-terminal namespace", http.StatusForbidden)
+	// Cluster admin terminals must live in the admin namespace to prevent privilege escalation
+	if isClusterAdmin && namespace != p.adminNamespace {
+		http.Error(w, "cluster-admin users must create and use terminals in the "+p.adminNamespace+" namespace", http.StatusForbidden)
 		return
 	}
 
@@ -113,29 +143,16 @@ func (p *Proxy) HandleProxy(user *auth.User, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	client, err := p.createDynamicClient(user.Token)
+	client, err := p.createDynamicClient(cluster, user.Token)
 	if err != nil {
 		http.Error(w, "Failed to create k8s client for the authenticated user. Cause: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	userId := user.ID
-	if userId == "" {
-		// user id is missing, auth is used that does not support user info propagated, like OpenShift OAuth
-		userInfo, err := client.Resource(UserGroupVersionResource).Get(context.TODO(), "~", metav1.GetOptions{})
-		if err != nil {
-			http.Error(w, "Failed to retrieve the current user info. Cause: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		userId = string(userInfo.GetUID())
-		if userId == "" {
-			// uid is missing. it must be kube:admin
-			if "kube:admin" != userInfo.GetName() {
-				http.Error(w, "User must have UID to proceed authorization", http.StatusInternalServerError)
-				return
-			}
-		}
+	userId, _, err := p.getUserInfo(r.Context(), cluster, user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	ws, err := client.Resource(WorkspaceGroupVersionResource).Namespace(namespace).Get(context.TODO(), workspaceName, metav1.GetOptions{})
@@ -166,6 +183,11 @@ func (p *Proxy) HandleProxy(user *auth.User, w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	workspaces := client.Resource(WorkspaceGroupVersionResource).Namespace(namespace)
+	if err := recordActivity(r.Context(), workspaces, ws); err != nil {
+		klog.Errorf("Failed to record the activity of terminal %s/%s: %v", namespace, workspaceName, err)
+	}
+
 	terminalHost.Path = path
 	if path == WorkspaceInitEndpoint {
 		p.handleExecInit(terminalHost, user.Token, r, w)
@@ -176,45 +198,49 @@ func (p *Proxy) HandleProxy(user *auth.User, w http.ResponseWriter, r *http.Requ
 	}
 }
 
-func (p *Proxy) HandleProxyEnabled(w http.ResponseWriter, r *http.Request) {
+func (p *Proxy) HandleProxyEnabled(user *auth.User, w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		w.Header().Set("Allow", "GET")
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	isWebTerminalOperatorInstalled, err := checkWebTerminalOperatorIsInstalled()
+	cluster, ok := p.getCluster(w, r)
+	if !ok {
+		return
+	}
+
+	state, err := p.getOperatorState(cluster, user.Token)
 	if err != nil {
-		klog.Errorf("Failed to check if the web terminal operator is installed: %s", err)
+		klog.Errorf("Failed to check the web terminal operator state: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
-	if !isWebTerminalOperatorInstalled {
+	if len(state.subscriptions.Items) == 0 {
 		klog.Error("web terminal operator is not installed")
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
-	isWebTerminalOperatorRunning, err := checkWebTerminalOperatorIsRunning()
-	if err != nil {
-		klog.Errorf("Failed to check if web terminal operator is running: %s", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
-	}
-	if !isWebTerminalOperatorRunning {
+	if !state.running {
 		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (p *Proxy) HandleTerminalInstalledNamespace(w http.ResponseWriter, r *http.Request) {
+func (p *Proxy) HandleTerminalInstalledNamespace(user *auth.User, w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		w.Header().Set("Allow", "GET")
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
 
-	subscription, err := getWebTerminalSubscriptions()
+	cluster, ok := p.getCluster(w, r)
+	if !ok {
+		return
+	}
+
+	subscription, err := p.getCachedWebTerminalSubscriptions(cluster, user.Token)
 	if err != nil {
 		klog.Errorf("Failed to check the web terminal subscription: %s", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -265,6 +291,45 @@ func (p *Proxy) handleActivity(host *url.URL, token string, w http.ResponseWrite
 	p.proxyToWorkspace(wkspReq, w)
 }
 
+// getUserInfo returns the UID and name of the user, which are looked up if
+// the auth in use doesn't propagate them.
+func (p *Proxy) getUserInfo(ctx context.Context, cluster string, user *auth.User) (userId string, username string, err error) {
+	if user.ID != "" {
+		return user.ID, user.Username, nil
+	}
+
+	// user id is missing, auth is used that does not support user info propagated, like OpenShift OAuth
+	resolver, ok := p.userInfoResolvers[cluster]
+	if !ok {
+		return "", "", errors.New("Failed to retrieve the current user info. Cause: no user info resolver for cluster " + cluster)
+	}
+	userInfo, err := resolver.ResolveIdentity(ctx, user.Token)
+	if err != nil {
+		return "", "", errors.New("Failed to retrieve the current user info. Cause: " + err.Error())
+	}
+
+	userId = userInfo.UID
+	if userId == "" {
+		// uid is missing. it must be kube:admin
+		if "kube:admin" != userInfo.Username {
+			return "", "", errors.New("User must have UID to proceed authorization")
+		}
+	}
+	return userId, userInfo.Username, nil
+}
+
+// getCluster returns the cluster the request is for, or responds with an error
+// if the cluster is unknown.
+func (p *Proxy) getCluster(w http.ResponseWriter, r *http.Request) (string, bool) {
+	cluster := serverutils.GetCluster(r)
+	if _, ok := p.k8sProxyConfigs[cluster]; !ok {
+		klog.Errorf("Bad Request. Invalid cluster: %v", cluster)
+		http.Error(w, "Invalid cluster "+cluster, http.StatusBadRequest)
+		return "", false
+	}
+	return cluster, true
+}
+
 // stripTerminalAPIPrefix strips path prefix that is expected for Terminal API request
 func stripTerminalAPIPrefix(requestPath string) (ok bool, namespace string, workspaceName string, path string) {
 	// URL is supposed to have the following format
@@ -283,9 +348,13 @@ func stripTerminalAPIPrefix(requestPath string) (ok bool, namespace string, work
 	}
 }
 
-// getBaseTerminalHost evaluates ideUrl from the specified workspace and extract host from it
+// getBaseTerminalHost evaluates ideUrl from the specified workspace and extract host from it.
+// v1alpha2 workspaces call it mainUrl.
 func (p *Proxy) getBaseTerminalHost(ws *unstructured.Unstructured) (*url.URL, error) {
 	ideUrl, success, err := unstructured.NestedString(ws.UnstructuredContent(), "status", "ideUrl")
+	if !success && err == nil {
+		ideUrl, success, err = unstructured.NestedString(ws.UnstructuredContent(), "status", "mainUrl")
+	}
 	if !success {
 		return nil, errors.New("the specified workspace does not have ideUrl in its status")
 	}
@@ -0,0 +1,130 @@
+package terminal
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/proxy"
+)
+
+func TestHandleProxyEnabledPerCluster(t *testing.T) {
+	webhookRequests := 0
+	spoke := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Users usually can't see the operator, so the console detects it with its own credential.
+		if r.Header.Get("Authorization") != "Bearer spoke-console-token" {
+			t.Errorf("expected the console's token for the managed cluster, got %q", r.Header.Get("Authorization"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/apis/operators.coreos.com/v1alpha1/subscriptions":
+			fmt.Fprint(w, `{"apiVersion": "operators.coreos.com/v1alpha1", "kind": "SubscriptionList", "items": [{"apiVersion": "operators.coreos.com/v1alpha1", "kind": "Subscription", "metadata": {"name": "web-terminal", "namespace": "openshift-operators"}}]}`)
+		case "/apis/admissionregistration.k8s.io/v1/mutatingwebhookconfigurations/" + webhookName:
+			webhookRequests++
+			fmt.Fprintf(w, `{"metadata": {"name": %q}}`, webhookName)
+		case "/apis/admissionregistration.k8s.io/v1/validatingwebhookconfigurations/" + webhookName:
+			fmt.Fprintf(w, `{"metadata": {"name": %q}}`, webhookName)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer spoke.Close()
+	local := httptest.NewServer(http.NotFoundHandler())
+	defer local.Close()
+
+	k8sProxyConfigs := make(map[string]*proxy.Config)
+	k8sClients := make(map[string]*http.Client)
+	for cluster, s := range map[string]*httptest.Server{"local-cluster": local, "spoke": spoke} {
+		endpoint, err := url.Parse(s.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		k8sProxyConfigs[cluster] = &proxy.Config{Endpoint: endpoint}
+		k8sClients[cluster] = s.Client()
+	}
+	p := NewProxy(nil, k8sProxyConfigs, k8sClients, map[string]auth.TokenSource{
+		"local-cluster": auth.NewStaticTokenSource("local-console-token"),
+		"spoke":         auth.NewStaticTokenSource("spoke-console-token"),
+	}, nil, "openshift-terminal")
+
+	available := func(cluster, token string) int {
+		r := httptest.NewRequest("GET", AvailableEndpoint, nil)
+		r.Header.Set("X-Cluster", cluster)
+		rr := httptest.NewRecorder()
+		p.HandleProxyEnabled(&auth.User{Token: token}, rr, r)
+		return rr.Code
+	}
+
+	if code := available("spoke", "spoke-token"); code != http.StatusNoContent {
+		t.Errorf("expected the terminal to be available on the managed cluster, got status %d", code)
+	}
+	if code := available("spoke", "spoke-token"); code != http.StatusNoContent {
+		t.Errorf("expected the terminal to stay available on the managed cluster, got status %d", code)
+	}
+	if webhookRequests != 1 {
+		t.Errorf("expected the operator state of the managed cluster to be cached, got %d webhook requests", webhookRequests)
+	}
+	if code := available("local-cluster", "local-token"); code != http.StatusServiceUnavailable {
+		t.Errorf("expected the terminal to be unavailable on the local cluster, got status %d", code)
+	}
+	if code := available("unknown", "local-token"); code != http.StatusBadRequest {
+		t.Errorf("expected an unknown cluster to be rejected, got status %d", code)
+	}
+}
+
+func TestHandleProxyEnabledWithoutConsoleToken(t *testing.T) {
+	webhookRequests := 0
+	spoke := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The console has no credential for managed clusters configured with --managed-clusters.
+		if r.Header.Get("Authorization") != "Bearer spoke-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/apis/operators.coreos.com/v1alpha1/subscriptions":
+			fmt.Fprint(w, `{"apiVersion": "operators.coreos.com/v1alpha1", "kind": "SubscriptionList", "items": [{"apiVersion": "operators.coreos.com/v1alpha1", "kind": "Subscription", "metadata": {"name": "web-terminal", "namespace": "openshift-operators"}}]}`)
+		case "/apis/admissionregistration.k8s.io/v1/mutatingwebhookconfigurations/" + webhookName:
+			webhookRequests++
+			fmt.Fprintf(w, `{"metadata": {"name": %q}}`, webhookName)
+		case "/apis/admissionregistration.k8s.io/v1/validatingwebhookconfigurations/" + webhookName:
+			fmt.Fprintf(w, `{"metadata": {"name": %q}}`, webhookName)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer spoke.Close()
+	endpoint, err := url.Parse(spoke.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProxy(nil,
+		map[string]*proxy.Config{"spoke": {Endpoint: endpoint}},
+		map[string]*http.Client{"spoke": spoke.Client()},
+		map[string]auth.TokenSource{},
+		nil,
+		"openshift-terminal",
+	)
+
+	available := func(token string) int {
+		r := httptest.NewRequest("GET", AvailableEndpoint, nil)
+		r.Header.Set("X-Cluster", "spoke")
+		rr := httptest.NewRecorder()
+		p.HandleProxyEnabled(&auth.User{Token: token}, rr, r)
+		return rr.Code
+	}
+
+	if code := available("spoke-token"); code != http.StatusNoContent {
+		t.Errorf("expected the terminal to be available on the managed cluster, got status %d", code)
+	}
+	// What a user sees isn't cached for other users.
+	if code := available("other-token"); code != http.StatusInternalServerError {
+		t.Errorf("expected the operator state to be detected with the user's token, got status %d", code)
+	}
+	if webhookRequests != 1 {
+		t.Errorf("expected the operator to be detected once with the user's token, got %d webhook requests", webhookRequests)
+	}
+}
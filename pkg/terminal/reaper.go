@@ -0,0 +1,153 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/klog"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/proxy"
+)
+
+const (
+	// WorkspaceLastActivityAnnotation records when the terminal was last used, in RFC 3339 format
+	WorkspaceLastActivityAnnotation = "console.openshift.io/terminal-last-activity"
+	// WorkspaceStoppedByAnnotation tells the web terminal operator why a workspace was stopped
+	WorkspaceStoppedByAnnotation = "controller.devfile.io/stopped-by"
+)
+
+// Ways the reaper culls idle terminals.
+const (
+	IdleActionStop   = "stop"
+	IdleActionDelete = "delete"
+)
+
+const (
+	// activityRecordInterval limits how often the activity of a terminal is written to its workspace.
+	activityRecordInterval = time.Minute
+	// defaultReapInterval is how often the reaper looks for idle terminals.
+	defaultReapInterval = time.Minute
+)
+
+// recordActivity annotates the workspace with the current time, unless it was
+// annotated recently.
+func recordActivity(ctx context.Context, workspaces dynamic.ResourceInterface, ws *unstructured.Unstructured) error {
+	now := time.Now()
+	if lastActivity, err := time.Parse(time.RFC3339, ws.GetAnnotations()[WorkspaceLastActivityAnnotation]); err == nil && now.Sub(lastActivity) < activityRecordInterval {
+		return nil
+	}
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, WorkspaceLastActivityAnnotation, now.UTC().Format(time.RFC3339))
+	_, err := workspaces.Patch(ctx, ws.GetName(), types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	return err
+}
+
+// Reaper stops or deletes the terminal workspaces of the cluster that have had
+// no activity for the idle timeout.
+type Reaper struct {
+	k8sProxyConfig *proxy.Config
+	k8sClient      *http.Client
+	// tokenSource supplies the token of the console service account, which
+	// must be allowed to list, patch and delete workspaces in all namespaces.
+	tokenSource auth.TokenSource
+	idleTimeout time.Duration
+	action      string
+	interval    time.Duration
+}
+
+func NewReaper(k8sProxyConfig *proxy.Config, k8sClient *http.Client, tokenSource auth.TokenSource, idleTimeout time.Duration, action string) (*Reaper, error) {
+	if action != IdleActionStop && action != IdleActionDelete {
+		return nil, fmt.Errorf("unknown idle action %q, must be one of: %s, %s", action, IdleActionStop, IdleActionDelete)
+	}
+	return &Reaper{
+		k8sProxyConfig: k8sProxyConfig,
+		k8sClient:      k8sClient,
+		tokenSource:    tokenSource,
+		idleTimeout:    idleTimeout,
+		action:         action,
+		interval:       defaultReapInterval,
+	}, nil
+}
+
+// Run culls idle terminals until the context is done.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		if err := r.reap(ctx); err != nil {
+			klog.Errorf("Failed to cull idle terminals: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reap culls the terminals that are idle now.
+func (r *Reaper) reap(ctx context.Context) error {
+	token, err := r.tokenSource.Token()
+	if err != nil {
+		return err
+	}
+	client, err := dynamic.NewForConfig(dynamic.ConfigFor(&rest.Config{
+		Host:        r.k8sProxyConfig.Endpoint.String(),
+		Transport:   r.k8sClient.Transport,
+		BearerToken: token,
+	}))
+	if err != nil {
+		return err
+	}
+
+	list, err := client.Resource(WorkspaceGroupVersionResource).List(ctx, metav1.ListOptions{
+		LabelSelector: TerminalLabel + "=true",
+	})
+	if err != nil {
+		return err
+	}
+	for i := range list.Items {
+		ws := &list.Items[i]
+		if !r.isIdle(ws) {
+			continue
+		}
+		workspaces := client.Resource(WorkspaceGroupVersionResource).Namespace(ws.GetNamespace())
+		switch r.action {
+		case IdleActionStop:
+			patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:"inactivity"}},"spec":{"started":false}}`, WorkspaceStoppedByAnnotation)
+			_, err = workspaces.Patch(ctx, ws.GetName(), types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+		case IdleActionDelete:
+			err = workspaces.Delete(ctx, ws.GetName(), metav1.DeleteOptions{})
+		}
+		if err != nil {
+			klog.Errorf("Failed to %s idle terminal %s/%s: %v", r.action, ws.GetNamespace(), ws.GetName(), err)
+			continue
+		}
+		klog.Infof("Culled idle terminal %s/%s: %s", ws.GetNamespace(), ws.GetName(), r.action)
+	}
+	return nil
+}
+
+// isIdle tells whether the terminal has had no activity for the idle timeout. Terminals that
+// are starting are never idle, since they may have just been restarted.
+func (r *Reaper) isIdle(ws *unstructured.Unstructured) bool {
+	started, _, _ := unstructured.NestedBool(ws.UnstructuredContent(), "spec", "started")
+	if !started && r.action == IdleActionStop {
+		return false
+	}
+	if phase, _, _ := unstructured.NestedString(ws.UnstructuredContent(), "status", "phase"); phase == "Starting" {
+		return false
+	}
+	lastActivity := ws.GetCreationTimestamp().Time
+	if annotated, err := time.Parse(time.RFC3339, ws.GetAnnotations()[WorkspaceLastActivityAnnotation]); err == nil {
+		lastActivity = annotated
+	}
+	return time.Since(lastActivity) > r.idleTimeout
+}
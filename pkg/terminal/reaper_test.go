@@ -0,0 +1,102 @@
+package terminal
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/openshift/console/pkg/auth"
+	"github.com/openshift/console/pkg/proxy"
+)
+
+func TestReap(t *testing.T) {
+	longAgo := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	recently := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	workspace := func(name string, started bool, phase, lastActivity string) string {
+		return fmt.Sprintf(`{
+			"metadata": {"name": %q, "namespace": "my-project", "creationTimestamp": %q, "annotations": {%q: %q}},
+			"spec": {"started": %t},
+			"status": {"phase": %q}
+		}`, name, longAgo, WorkspaceLastActivityAnnotation, lastActivity, started, phase)
+	}
+	items := []string{
+		workspace("idle", true, "Running", longAgo),
+		workspace("active", true, "Running", recently),
+		workspace("stopped", false, "Stopped", longAgo),
+		workspace("restarting", true, "Starting", longAgo),
+		workspace("unannotated", true, "Running", ""),
+	}
+
+	tests := []struct {
+		action   string
+		expected []string
+	}{
+		{
+			action:   IdleActionStop,
+			expected: []string{"PATCH idle", "PATCH unannotated"},
+		},
+		{
+			action:   IdleActionDelete,
+			expected: []string{"DELETE idle", "DELETE stopped", "DELETE unannotated"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			var lock sync.Mutex
+			culled := []string{}
+			apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if r.Header.Get("Authorization") != "Bearer sa-token" {
+					t.Errorf("expected the service account token, got %q", r.Header.Get("Authorization"))
+				}
+				if r.URL.Path == "/apis/workspace.devfile.io/v1alpha1/devworkspaces" {
+					if selector := r.URL.Query().Get("labelSelector"); selector != TerminalLabel+"=true" {
+						t.Errorf("expected only terminals to be listed, got selector %q", selector)
+					}
+					fmt.Fprintf(w, `{"apiVersion": "workspace.devfile.io/v1alpha1", "kind": "DevWorkspaceList", "items": [%s]}`, strings.Join(items, ","))
+					return
+				}
+				name := strings.TrimPrefix(r.URL.Path, "/apis/workspace.devfile.io/v1alpha1/namespaces/my-project/devworkspaces/")
+				if r.Method == "PATCH" {
+					body, _ := ioutil.ReadAll(r.Body)
+					if !strings.Contains(string(body), `"started":false`) {
+						t.Errorf("expected the workspace to be stopped, got %s", body)
+					}
+				}
+				lock.Lock()
+				culled = append(culled, r.Method+" "+name)
+				lock.Unlock()
+				fmt.Fprintf(w, `{"apiVersion": "workspace.devfile.io/v1alpha1", "kind": "DevWorkspace", "metadata": {"name": %q}}`, name)
+			}))
+			defer apiServer.Close()
+
+			endpoint, err := url.Parse(apiServer.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reaper, err := NewReaper(&proxy.Config{Endpoint: endpoint}, apiServer.Client(), auth.NewStaticTokenSource("sa-token"), time.Hour, tt.action)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := reaper.reap(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(culled)
+			if strings.Join(culled, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("expected %v to be culled, got %v", tt.expected, culled)
+			}
+		})
+	}
+
+	if _, err := NewReaper(nil, nil, nil, time.Hour, "hibernate"); err == nil {
+		t.Error("expected an unknown idle action to be rejected")
+	}
+}
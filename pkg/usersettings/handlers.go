@@ -9,7 +9,6 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog"
@@ -28,10 +27,11 @@ var USER_RESOURCE = schema.GroupVersionResource{
 }
 
 type UserSettingsHandler struct {
-	K8sProxyConfig      *proxy.Config
-	Client              *http.Client
-	Endpoint            string
-	ServiceAccountToken string
+	K8sProxyConfig            *proxy.Config
+	Client                    *http.Client
+	Endpoint                  string
+	ServiceAccountTokenSource auth.TokenSource
+	UserInfoResolver          *auth.UserInfoResolver
 }
 
 func (h *UserSettingsHandler) HandleUserSettings(user *auth.User, w http.ResponseWriter, r *http.Request) {
@@ -148,33 +148,22 @@ func (h *UserSettingsHandler) deleteUserSettings(ctx context.Context, client *ku
 }
 
 func (h *UserSettingsHandler) createServiceAccountClient() (*kubernetes.Clientset, error) {
-	config := &rest.Config{
-		Host:        h.Endpoint,
-		BearerToken: h.ServiceAccountToken,
-		Transport:   h.Client.Transport,
+	token, err := h.ServiceAccountTokenSource.Token()
+	if err != nil {
+		return nil, err
 	}
-	return kubernetes.NewForConfig(config)
-}
-
-func (h *UserSettingsHandler) createUserProxyClient(user *auth.User) (dynamic.Interface, error) {
 	config := &rest.Config{
 		Host:        h.Endpoint,
-		BearerToken: user.Token,
+		BearerToken: token,
 		Transport:   h.Client.Transport,
 	}
-	return dynamic.NewForConfig(config)
+	return kubernetes.NewForConfig(config)
 }
 
 func (h *UserSettingsHandler) getUserSettingMeta(context context.Context, user *auth.User) (*UserSettingMeta, error) {
-	client, err := h.createUserProxyClient(user)
+	userInfo, err := h.UserInfoResolver.ResolveIdentity(context, user.Token)
 	if err != nil {
 		return nil, err
 	}
-
-	userInfo, err := client.Resource(USER_RESOURCE).Get(context, "~", meta.GetOptions{})
-	if err != nil {
-		return nil, err
-	}
-
-	return newUserSettingMeta(userInfo)
+	return newUserSettingMeta(userInfo.Username, userInfo.UID)
 }
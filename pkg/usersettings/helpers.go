@@ -6,26 +6,24 @@ import (
 	core "k8s.io/api/core/v1"
 	rbac "k8s.io/api/rbac/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
 )
 
-func newUserSettingMeta(userInfo *unstructured.Unstructured) (*UserSettingMeta, error) {
-	uid := userInfo.GetUID()
-	name := userInfo.GetName()
+func newUserSettingMeta(username, uid string) (*UserSettingMeta, error) {
 	resourceIdentifier := ""
 	ownerReferences := []meta.OwnerReference{}
 
 	if uid != "" {
-		resourceIdentifier = string(uid)
+		resourceIdentifier = uid
 		ownerReferences = []meta.OwnerReference{
 			meta.OwnerReference{
-				APIVersion: userInfo.GetAPIVersion(),
-				Kind:       userInfo.GetKind(),
-				Name:       name,
-				UID:        uid,
+				APIVersion: USER_RESOURCE.GroupVersion().String(),
+				Kind:       "User",
+				Name:       username,
+				UID:        types.UID(uid),
 			},
 		}
-	} else if name == "kube:admin" {
+	} else if username == "kube:admin" {
 		resourceIdentifier = "kubeadmin"
 		ownerReferences = []meta.OwnerReference{}
 	} else {
@@ -33,8 +31,8 @@ func newUserSettingMeta(userInfo *unstructured.Unstructured) (*UserSettingMeta,
 	}
 
 	return &UserSettingMeta{
-		Username:           name,
-		UID:                string(uid),
+		Username:           username,
+		UID:                uid,
 		ResourceIdentifier: resourceIdentifier,
 		OwnerReferences:    ownerReferences,
 	}, nil